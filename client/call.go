@@ -0,0 +1,84 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// Caller is a client that commands can be sent to with Call,
+// i.e. a *SmartPlugClient, a *RawClient or a *Pool.
+type Caller interface {
+	exchange(ctx context.Context, name codes.MessageCode, v any) (commandReply, codes.PluginExitReason, error)
+}
+
+// commandReply is the reply of a plug to a command, with the codec of the plug session.
+type commandReply struct {
+	messages.Envelope
+	codec codec.Codec
+}
+
+// ResponseTypeError is returned by Call when the response of the plug cannot be decoded
+// into the requested response type.
+type ResponseTypeError struct {
+	Command codes.MessageCode
+	Type    string       // the result type reported by the plug
+	Want    reflect.Type // the requested response type
+	Err     error        // the decoding error
+}
+
+func (e *ResponseTypeError) Error() string {
+	return fmt.Sprintf("%s: cannot decode %q response into %s: %v", e.Command, e.Type, e.Want, e.Err)
+}
+
+// Unwrap returns the decoding error.
+func (e *ResponseTypeError) Unwrap() error {
+	return e.Err
+}
+
+// Call sends the command name with req to the plug and decodes the value of its response
+// directly into Resp. Unlike RunCommand, no handler registered with HandleMessageType is involved.
+//
+// A failed command is reported as a *plugkit.RemoteError, also when the plug returned a result
+// with a failing exit code; the response decoded so far is returned with it. A response that
+// does not fit Resp is reported as a *ResponseTypeError. Other errors are the ones of RunCommand.
+func Call[Req, Resp any](ctx context.Context, c Caller, name codes.MessageCode, req Req) (Resp, error) {
+	var resp Resp
+	msg, _, err := c.exchange(ctx, name, req)
+	if err != nil {
+		return resp, err
+	}
+	if msg.Type != string(codes.PluginResponse) {
+		return resp, fmt.Errorf("%s: unexpected %q message in answer to the command", name, msg.Type)
+	}
+
+	var result messages.RawResult
+	if err := msg.codec.Unmarshal(msg.Raw, &result); err != nil {
+		return resp, fmt.Errorf("%s: malformed response: %w", name, err)
+	}
+	if result.Error != nil {
+		return resp, plugkit.NewRemoteError(result.Error)
+	}
+	if len(result.Value) > 0 {
+		if err := msg.codec.Unmarshal(result.Value, &resp); err != nil {
+			return resp, &ResponseTypeError{Command: name, Type: result.Type, Want: reflect.TypeFor[Resp](), Err: err}
+		}
+	}
+	switch result.ExitCode {
+	case codes.OperationSuccess, codes.OperationSucceededWithWarnings:
+		return resp, nil
+	}
+	return resp, &plugkit.RemoteError{Code: result.ExitCode}
+}
+
+// errNotACaller is returned by Call on a Pool whose members cannot serve it.
+var errNotACaller = errors.New("pool member does not support Call")
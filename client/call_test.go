@@ -0,0 +1,78 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestCall(t *testing.T) {
+	// No handler is registered for the result type: Call decodes the response itself.
+	c := client.NewSmartClient(plugCommand(t, "echo"))
+	if err := c.StartLocal(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Stop() })
+
+	got, err := client.Call[text, text](context.Background(), c, "echo", text{"hi"})
+	if err != nil || got.Text != "hi" {
+		t.Errorf("Call() = %+v, %v", got, err)
+	}
+	warned, err := client.Call[text, text](context.Background(), c, "exit", text{fmt.Sprint(int(codes.OperationSucceededWithWarnings))})
+	if err != nil || warned.Text == "" {
+		t.Errorf("Call() succeeding with warnings = %+v, %v", warned, err)
+	}
+}
+
+func TestCallResponseType(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	got, err := client.Call[text, int](context.Background(), c, "echo", text{"hi"})
+	var typeErr *client.ResponseTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("Call() = %v, %v, want a *client.ResponseTypeError", got, err)
+	}
+	if typeErr.Command != "echo" || typeErr.Type != "echo" || typeErr.Want != reflect.TypeFor[int]() || typeErr.Err == nil {
+		t.Errorf("ResponseTypeError = %+v", typeErr)
+	}
+}
+
+func TestCallFails(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	_, err := client.Call[text, text](context.Background(), c, "fail", text{"bad input"})
+	var remote *plugkit.RemoteError
+	if !errors.As(err, &remote) || remote.Code != codes.DataFormatError || remote.Message != "bad input" {
+		t.Errorf("Call() of a failing command = %v, want a *plugkit.RemoteError", err)
+	}
+
+	// A result with a failing exit code is an error too, but the response is kept.
+	got, err := client.Call[text, text](context.Background(), c, "exit", text{fmt.Sprint(int(codes.OperationError))})
+	if !errors.As(err, &remote) || remote.Code != codes.OperationError {
+		t.Errorf("Call() of a failing result = %v, want a *plugkit.RemoteError with %v", err, codes.OperationError)
+	}
+	if got.Text != fmt.Sprint(int(codes.OperationError)) {
+		t.Errorf("Call() of a failing result = %+v, want the response", got)
+	}
+
+	if _, err := client.Call[text, text](context.Background(), c, "unknown", text{}); err == nil {
+		t.Error("Call() of an unknown command succeeded")
+	}
+}
+
+func TestCallPool(t *testing.T) {
+	p := startPool(t, "echo", 1, 2, nil)
+	got, err := client.Call[text, text](context.Background(), p, "echo", text{"pooled"})
+	if err != nil || got.Text != "pooled" {
+		t.Errorf("Call() = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// callHandlers serve the calls a plug makes to host services, by method.
+type callHandlers map[string]func(any) (any, error)
+
+// serve runs the handler of call with its argument decoded with c.
+func (h callHandlers) serve(c codec.Codec, call *messages.Call) (any, error) {
+	handler, ok := h[call.Method]
+	if !ok {
+		return nil, &messages.Error{Code: codes.CommandNotFound, Message: fmt.Sprintf("no host handler for call %q", call.Method)}
+	}
+	var args any
+	if len(call.Args) > 0 {
+		if err := c.Unmarshal(call.Args, &args); err != nil {
+			return nil, &messages.Error{Code: codes.DataFormatError, Message: err.Error()}
+		}
+	}
+	return handler(args)
+}
+
+// serveCall answers a codes.CallMessage from the plug with the result of c.onCall.
+// It runs in its own goroutine, so calls may be served while the host waits for the plug.
+func (c *conn) serveCall(msg messages.Envelope) {
+	var res messages.CallResult
+	var call messages.Call
+	if err := c.codec.Unmarshal(msg.Raw, &call); err != nil {
+		res.Error = &messages.Error{Code: codes.DataFormatError, Message: err.Error()}
+	} else if value, err := c.onCall(c.codec, &call); err != nil {
+		res.Error = messages.NewError(err, codes.OperationError)
+	} else {
+		res.Value = c.raw(value)
+	}
+	if res.Error != nil {
+		c.log.LogAttrs(context.Background(), slog.LevelDebug, "plug call failed",
+			slog.String("method", call.Method), slog.Uint64("id", msg.ID), slog.Any("error", res.Error))
+	}
+
+	_, err := c.send(context.Background(), msg.ID, string(codes.CallResultMessage), c.raw(&res))
+	if err != nil {
+		c.log.LogAttrs(context.Background(), slog.LevelWarn, "answering plug call failed",
+			slog.String("method", call.Method), slog.Uint64("id", msg.ID), slog.Any("error", err))
+	}
+}
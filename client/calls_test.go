@@ -0,0 +1,74 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/helpers"
+)
+
+func TestHostCall(t *testing.T) {
+	c := startEcho(t, "echo", func(c *client.SmartPlugClient) {
+		c.HandleCall("config", helpers.WrapHandler(func(in text) (text, error) {
+			return text{"config for " + in.Text}, nil
+		}))
+	})
+
+	// The plug calls the host while the host waits for the result of the command.
+	if _, got, err := echo(context.Background(), c, "call", "config"); err != nil || got != "config for plug" {
+		t.Errorf("command calling the host = %q, %v", got, err)
+	}
+}
+
+func TestHostCallConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	c := startEcho(t, "echo", func(c *client.SmartPlugClient) {
+		c.HandleCall("count", helpers.WrapHandler(func(in text) (text, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return in, nil
+		}))
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, got, err := echo(context.Background(), c, "call", "count"); err != nil || got != "plug" {
+				t.Errorf("command calling the host = %q, %v", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 10 {
+		t.Errorf("host served %d calls, want 10", calls)
+	}
+}
+
+func TestHostCallFails(t *testing.T) {
+	c := startEcho(t, "echo", func(c *client.SmartPlugClient) {
+		c.HandleCall("secret", func(any) (any, error) { return nil, errors.New("access denied") })
+	})
+
+	// The plug handler returns the error of the host, which comes back with the result.
+	_, _, err := echo(context.Background(), c, "call", "secret")
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("command calling a failing host handler = %v, want the host error", err)
+	}
+
+	_, _, err = echo(context.Background(), c, "call", "unknown")
+	if !errors.Is(err, codes.CommandNotFound) {
+		t.Errorf("command calling an unknown host method = %v, want %v", err, codes.CommandNotFound)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestCommandCancelled(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	reason, _, err := echo(ctx, c, "wait", "")
+	if reason != codes.OperationCancelledByClient || !errors.Is(err, context.Canceled) {
+		t.Errorf("RunCommandContext() = %v, %v, want %v and context.Canceled", reason, err, codes.OperationCancelledByClient)
+	}
+}
+
+func TestCancellationReachesHandler(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	for range 2 {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, _, _ = echo(ctx, c, "wait", "")
+		cancel()
+	}
+
+	// Handlers run one at a time, so both waits have returned once this one runs.
+	if _, got, err := echo(context.Background(), c, "cancellations", ""); err != nil || got != "2" {
+		t.Errorf("plug saw %q cancellations, %v, want 2", got, err)
+	}
+}
+
+func TestCancellationWhileClosing(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, _ = echo(ctx, c, "wait", "")
+
+	// The cancellation may reach the plug after the end of the session;
+	// the plug drains the abandoned command anyway.
+	closed := make(chan error, 1)
+	go func() { closed <- c.Stop() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Stop: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop hangs on a plug draining a cancelled command")
+	}
+}
@@ -7,13 +7,13 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
+	"log/slog"
+	"sort"
 
-	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit"
 	"github.com/mjwhodur/plugkit/codes"
 	"github.com/mjwhodur/plugkit/helpers"
 	"github.com/mjwhodur/plugkit/messages"
@@ -24,48 +24,42 @@ import (
 //
 // Communication is handled via stdin/stdout pipes using CBOR encoding.
 // Messages are exchanged as Envelope structures with a defined message type and payload.
+//
+// Once started, RunCommand is safe for concurrent use: many commands may be in flight
+// at once, and every response is routed to its caller by request ID.
 type SmartPlugClient struct {
-	encoder  *cbor.Encoder
-	decoder  *cbor.Decoder
-	command  string
+	common
 	Handlers map[string]func(any) (any, error)
 	isReady  bool
+	calls    callHandlers
 }
 
 // StartLocal starts the plugin process using the provided command.
 //
-// It sets up CBOR encoding/decoding over stdin/stdout pipes.
-// Returns an error if the plugin cannot be started or the communication setup fails.
+// It sets up CBOR encoding/decoding over stdin/stdout pipes and performs the hello
+// exchange with the plug. Returns an error if the plugin cannot be started or the
+// communication setup fails. A *HandshakeError is returned when the process is not
+// a PlugKit plug or speaks an incompatible protocol.
 func (c *SmartPlugClient) StartLocal() error {
+	return c.StartLocalContext(context.Background())
+}
 
-	if c.command == "" {
-		return errors.New("command executable is required")
+// StartLocalContext is like StartLocal, but gives up waiting for the plug's hello when ctx ends.
+// The plug process is killed in that case. Once started, the plug outlives ctx.
+func (c *SmartPlugClient) StartLocalContext(ctx context.Context) error {
+	types := make([]string, 0, len(c.Handlers))
+	for t := range c.Handlers {
+		types = append(types, t)
 	}
+	sort.Strings(types)
 
-	cmd := exec.Command(c.command) // #nosec G204
-	stdin, err := cmd.StdinPipe()
-
-	if err != nil {
-		return err
-	}
-	stdout, err := cmd.StdoutPipe()
+	conn, info, err := c.dial(ctx, types)
 	if err != nil {
 		return err
 	}
-
-	if e := cmd.Start(); e != nil {
-		return e
-	}
-
-	c.encoder = cbor.NewEncoder(stdin)
-	c.decoder = cbor.NewDecoder(stdout)
-
-	if c.decoder == nil {
-		return errors.New("failed to create decoder")
-	}
-	if c.encoder == nil {
-		return errors.New("failed to create encoder")
-	}
+	conn.start(nil, c.calls.serve)
+	c.conn.Store(conn)
+	c.plugInfo = info
 
 	return nil
 }
@@ -76,7 +70,7 @@ func NewSmartClient(name string) *SmartPlugClient {
 	isReady := name != ""
 
 	return &SmartPlugClient{
-		command:  name,
+		common:   common{command: name},
 		Handlers: make(map[string]func(any) (any, error)),
 		isReady:  isReady,
 	}
@@ -93,63 +87,51 @@ func NewSmartClient(name string) *SmartPlugClient {
 // and the corresponding handler executes successfully, its return value is passed back to the caller.
 //
 // If no matching handler is found or the handler fails, the returned result will be nil.
+// The returned PluginExitReason is the one reported by the plug handler. If the plug handler
+// failed, a *plugkit.RemoteError carrying its exit reason and message is returned as the error.
+// A response that cannot be decoded is reported as codes.PluginToHostCommunicationError.
 // In general, it's recommended that plugins return a single, well-defined response type,
 // or exit with an appropriate error code when things go wrong. Supporting multiple possible
 // response types is possible, but may require custom decoding logic on the client side.
 func (c *SmartPlugClient) RunCommand(name codes.MessageCode, v any) (codes.PluginExitReason, any, error) {
-	if !c.isReady {
+	return c.RunCommandContext(context.Background(), name, v)
+}
+
+// RunCommandContext is like RunCommand, but stops waiting for the response when ctx ends.
+//
+// In that case codes.OperationTimeout (deadline exceeded) or codes.OperationCancelledByClient
+// (cancelled) is returned together with ctx.Err(), and the plug is told with codes.CancelMessage
+// that the request was abandoned. The plug keeps running and may serve further commands.
+func (c *SmartPlugClient) RunCommandContext(ctx context.Context, name codes.MessageCode, v any) (codes.PluginExitReason, any, error) {
+	conn := c.conn.Load()
+	if !c.isReady || conn == nil {
 		return codes.PlugNotStarted, nil, errors.New("client is not ready")
 	}
-	err := c.encoder.Encode(&messages.Envelope{
-		Version: 0,
-		Type:    string(name),
-		Raw:     helpers.MustRaw(v),
-	})
+	msg, reason, err := conn.command(ctx, name, v)
 	if err != nil {
-		fmt.Println("Error during encoding of the envelope")
-		return codes.PlugCrashed, nil, err
-	}
-	var msg messages.Envelope
-	if err := c.decoder.Decode(&msg); err != nil {
-		if err == io.EOF {
-			// FIXME: Log Error?
-			fmt.Println("Plugin finished prematurely - broken pipe")
-			return codes.PlugCrashed, nil, err
-		}
-		fmt.Fprintln(os.Stderr, "decode error:", err)
-		return codes.PluginToHostCommunicationError, nil, err
-	}
-	if msg.Type == string(codes.FinishMessage) {
-		fmt.Println("Plugin finished its job")
-		fmt.Println("Cleaning up")
-		var fin *messages.PluginFinish
-		err := cbor.Unmarshal(msg.Raw, &fin)
-		if err != nil {
-			return codes.PluginToHostCommunicationError, nil, err
-		}
-		return fin.Reason, nil, errors.New(fin.Message)
-	}
-	if msg.Type == string(codes.Unsupported) {
-		return codes.CommandInvokedCannotExecute, nil, errors.New("unsupported message type")
+		return reason, nil, err
 	}
 	if msg.Type == string(codes.PluginResponse) {
 		var result messages.Result
-		if e := cbor.Unmarshal(msg.Raw, &result); e != nil {
-			panic(e)
+		if e := conn.codec.Unmarshal(msg.Raw, &result); e != nil {
+			return codes.PluginToHostCommunicationError, nil, fmt.Errorf("%s: %w: malformed response: %w", name, codes.PluginToHostCommunicationError, e)
+		}
+		if result.Error != nil {
+			return result.ExitCode, nil, plugkit.NewRemoteError(result.Error)
 		}
 		if handler, ok := c.Handlers[result.Type]; ok {
 			if result.Value == nil {
-				fmt.Println("Received message with no raw payload")
+				conn.log.LogAttrs(ctx, slog.LevelDebug, "response carries no value", slog.String("type", result.Type))
 			}
 			res, e := handler(result.Value)
-			return codes.OperationSuccess, res, e
+			return result.ExitCode, res, e
 		}
 	}
 
-	e := c.respond(codes.Unsupported, &messages.MessageUnsupported{})
+	e := c.respond(msg.ID, codes.Unsupported, &messages.MessageUnsupported{})
 	if e != nil {
 		// FIXME: Maybe too vague?
-		return codes.PlugCrashed, nil, errors.New("plug crashed " + err.Error())
+		return codes.PlugCrashed, nil, errors.New("plug crashed " + e.Error())
 	}
 	return codes.OperationError, nil, errors.New("unsupported response message type")
 
@@ -158,6 +140,7 @@ func (c *SmartPlugClient) RunCommand(name codes.MessageCode, v any) (codes.Plugi
 // HandleMessageType registers a handler for a specific incoming message type.
 //
 // Handlers are called when a message of the given type is received from the plugin.
+// They receive values decoded with the codec of the session, see Codec.
 func (c *SmartPlugClient) HandleMessageType(name string, handler func(any) (any, error)) {
 	c.Handlers[name] = handler
 }
@@ -180,34 +163,73 @@ func HandleMessage[In any, Out any](c WrappedMessageHandler, name string, handle
 //
 // This method bypasses the MessageCode abstraction and can be used for ad-hoc messages.
 func (c *SmartPlugClient) RespondRaw(t string, v any) error {
+	conn := c.conn.Load()
 	// FIXME: Lacking test?
-	err := c.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    t,
-		Raw:     helpers.MustRaw(v),
-	})
-
+	_, err := conn.send(context.Background(), 0, t, conn.raw(v))
 	return err
-
 }
 
 // respond is a helper method that sends a typed message to the plugin.
 //
 // It wraps the message code and value into an Envelope.
 // This is the preferred way to respond using predefined MessageCode values.
-func (c *SmartPlugClient) respond(messageCode codes.MessageCode, v any) error {
+// replyTo is the ID of the plug message being answered.
+func (c *SmartPlugClient) respond(replyTo uint64, messageCode codes.MessageCode, v any) error {
+	conn := c.conn.Load()
 	// FIXME: Lacking test?
-	err := c.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    string(messageCode),
-		Raw:     helpers.MustRaw(v),
-	})
-
+	_, err := conn.send(context.Background(), replyTo, string(messageCode), conn.raw(v))
 	return err
 }
 
-// SetCommand sets the executable path or name of the plugin binary.
-// This must be set before calling StartLocal().
-func (c *SmartPlugClient) SetCommand(command string) {
-	c.command = command
+// Stop ends the plug session and waits for the plug process to exit.
+// It is a shortcut for Close(context.Background()).
+//
+// After Stop, the plug has to be started again with StartLocal before sending further commands.
+func (c *SmartPlugClient) Stop() error {
+	return c.Close(context.Background())
+}
+
+// Close ends the plug session with codes.ExitMessage and shuts the plug process down.
+//
+// The plug serves the commands in flight and answers with a PluginFinish; Close waits for
+// it until ctx ends. Then the plug gets the grace periods set with SetShutdownGrace to exit,
+// before it is sent SIGTERM and finally SIGKILL. The plug process is always reaped.
+// Commands sent once Close has begun fail with ErrSessionClosed.
+func (c *SmartPlugClient) Close(ctx context.Context) error {
+	conn := c.conn.Load()
+	if conn == nil {
+		return nil
+	}
+	return conn.terminate(ctx, c.grace)
+}
+
+// exchange sends a command to the plug and returns its reply, see Call.
+func (c *SmartPlugClient) exchange(ctx context.Context, name codes.MessageCode, v any) (commandReply, codes.PluginExitReason, error) {
+	conn := c.conn.Load()
+	if !c.isReady || conn == nil {
+		return commandReply{}, codes.PlugNotStarted, errors.New("client is not ready")
+	}
+	msg, reason, err := conn.command(ctx, name, v)
+	return commandReply{Envelope: msg, codec: conn.codec}, reason, err
+}
+
+// HandleCall registers a handler for calls the plug makes to the host service method,
+// see plug.Host.Call. Calls are served while the host waits for the plug, e.g. in RunCommand.
+//
+// Like with HandleMessageType, the handler receives the decoded argument, and can be
+// built from a typed function with helpers.WrapHandler. Its result is sent back to the plug;
+// an error is reported to the plug as a *messages.Error. Must be called before StartLocal.
+func (c *SmartPlugClient) HandleCall(method string, handler func(any) (any, error)) {
+	if c.calls == nil {
+		c.calls = make(callHandlers)
+	}
+	c.calls[method] = handler
+}
+
+func (c *SmartPlugClient) spawn(ctx context.Context) error {
+	return c.StartLocalContext(ctx)
+}
+
+func (c *SmartPlugClient) halt() error {
+	return c.Stop()
 }
@@ -0,0 +1,85 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/helpers"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/plug"
+)
+
+func init() {
+	// echo-msgpack prefers MessagePack, whichever codec the host speaks.
+	plugs["echo-msgpack"] = func() { echoPlug(func(p *plug.SmartPlug) { p.SetCodec(codec.MsgPack) }) }
+	// picks-unknown picks a codec the host did not offer.
+	plugs["picks-unknown"] = func() {
+		fakePlug(func(host *messages.Hello) *messages.Hello {
+			hello := plugHello(host)
+			hello.Codec = "xml"
+			return hello
+		}, nil)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.CBOR, codec.JSON, codec.MsgPack} {
+		t.Run(cd.Name(), func(t *testing.T) {
+			c := startEcho(t, "echo", func(c *client.SmartPlugClient) {
+				c.SetCodec(cd)
+				c.HandleCall("config", helpers.WrapHandler(func(in text) (text, error) { return text{"host " + in.Text}, nil }))
+			})
+			if c.Codec() != cd {
+				t.Errorf("session codec = %v, want %s", c.Codec(), cd.Name())
+			}
+
+			// Every kind of exchange works in the codec of the host.
+			if _, got, err := echo(context.Background(), c, "echo", "hi"); err != nil || got != "hi" {
+				t.Errorf("echo = %q, %v", got, err)
+			}
+			if n, err := client.Call[text, int](context.Background(), c, "length", text{"four"}); err != nil || n != 4 {
+				t.Errorf("length = %d, %v", n, err)
+			}
+			if _, got, err := echo(context.Background(), c, "call", "config"); err != nil || got != "host plug" {
+				t.Errorf("call = %q, %v", got, err)
+			}
+			_, _, err := echo(context.Background(), c, "fail", "bad")
+			var remote *plugkit.RemoteError
+			if !errors.As(err, &remote) || remote.Code != codes.DataFormatError || remote.Details["field"] != "text" {
+				t.Errorf("fail = %v, want a *plugkit.RemoteError with its details", err)
+			}
+			if d, err := c.Describe(context.Background()); err != nil || d.MessageType("length") == nil {
+				t.Errorf("Describe() = %+v, %v", d, err)
+			}
+		})
+	}
+}
+
+func TestCodecPickedByPlug(t *testing.T) {
+	// The host says hello in JSON, and the plug switches the session to MessagePack.
+	c := startEcho(t, "echo-msgpack", func(c *client.SmartPlugClient) { c.SetCodec(codec.JSON) })
+	if c.Codec() != codec.MsgPack {
+		t.Errorf("session codec = %v, want %s", c.Codec(), codec.MsgPack.Name())
+	}
+	if _, got, err := echo(context.Background(), c, "echo", "hi"); err != nil || got != "hi" {
+		t.Errorf("echo = %q, %v", got, err)
+	}
+	if info := c.PlugInfo(); info.Codec != codec.MsgPack.Name() {
+		t.Errorf("plug hello names codec %q", info.Codec)
+	}
+}
+
+func TestCodecNotOffered(t *testing.T) {
+	c := client.NewSmartClient(plugCommand(t, "picks-unknown"))
+	if err := c.StartLocal(); !errors.Is(err, client.ErrIncompatiblePlug) {
+		t.Errorf("StartLocal() = %v, want client.ErrIncompatiblePlug", err)
+	}
+}
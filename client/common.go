@@ -0,0 +1,174 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// common holds the plug session and the settings shared by SmartPlugClient, RawClient
+// and RawStreamClient. Settings must be changed before the plug is started.
+type common struct {
+	conn             atomic.Pointer[conn]
+	command          string
+	plugInfo         *messages.Hello
+	handshakeTimeout time.Duration
+	logSink          LogSink
+	logger           *slog.Logger
+	grace            shutdownGrace
+	heartbeat        heartbeatOptions
+	limits           messages.DecoderLimits
+	codec            codec.Codec
+}
+
+// dial starts the plug process and performs the handshake, advertising messageTypes.
+func (c *common) dial(ctx context.Context, messageTypes []string) (*conn, *messages.Hello, error) {
+	return dial(ctx, dialOptions{
+		command:      c.command,
+		messageTypes: messageTypes,
+		timeout:      c.handshakeTimeout,
+		logSink:      c.logSink,
+		logger:       c.logger,
+		heartbeat:    c.heartbeat,
+		limits:       c.limits,
+		codec:        c.codec,
+	})
+}
+
+// SetCommand sets the executable path or name of the plugin binary.
+// This must be set before the plug is started.
+func (c *common) SetCommand(command string) {
+	c.command = command
+}
+
+// PlugInfo returns the Hello received from the plug during the handshake,
+// or nil if the plug has not been started yet.
+func (c *common) PlugInfo() *messages.Hello {
+	return c.plugInfo
+}
+
+// SetLogSink sets where the output of the plug process goes. Every line the plug writes
+// to stderr (and to stdout, when the protocol runs over dedicated pipes) is passed to sink,
+// tagged with the plug name and PID; see SlogSink for forwarding to a *slog.Logger.
+// By default, the output is copied to the host's stderr. Must be called before the plug is started.
+func (c *common) SetLogSink(sink LogSink) {
+	c.logSink = sink
+}
+
+// SetLogger sets the logger used for diagnostics of the client itself, e.g. failed or
+// abandoned commands. Records carry the plug name and PID, and where it applies the
+// message type, request ID and duration. By default, nothing is logged.
+func (c *common) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+// SetHandshakeTimeout sets how long starting the plug waits for it to answer the hello.
+// Zero means DefaultHandshakeTimeout.
+func (c *common) SetHandshakeTimeout(timeout time.Duration) {
+	c.handshakeTimeout = timeout
+}
+
+// SetDecoderLimits sets the limits of the messages the client accepts from the plug, see
+// messages.DecoderLimits. A plug sending a message exceeding them is told with
+// codes.PayloadMalformed and killed, as the stream cannot be read any further; pending
+// commands fail with a *messages.LimitError. Zero limits take the defaults.
+// Must be called before the plug is started.
+func (c *common) SetDecoderLimits(limits messages.DecoderLimits) {
+	c.limits = limits
+}
+
+// SetCodec sets the codec the client speaks to the plug, see package codec. The plug is told
+// with messages.CodecEnv, and may still pick another codec this library speaks for the session.
+// By default, CBOR is used. Must be called before the plug is started.
+func (c *common) SetCodec(cd codec.Codec) {
+	c.codec = cd
+}
+
+// Codec returns the codec of the session with the running plug, or nil if the plug is not running.
+func (c *common) Codec() codec.Codec {
+	conn := c.conn.Load()
+	if conn == nil {
+		return nil
+	}
+	return conn.codec
+}
+
+// SetHeartbeat makes the client send a heartbeat to the plug every interval, once it is
+// started. A plug that misses the given number of heartbeats in a row (zero means
+// DefaultHeartbeatMisses) is considered unresponsive: pending commands fail with
+// ErrPlugUnresponsive and the plug process is killed. A slow command does not count,
+// as plugs answer heartbeats while their handlers run. Zero interval disables heartbeats,
+// which is the default. Must be called before the plug is started.
+func (c *common) SetHeartbeat(interval time.Duration, misses int) {
+	c.heartbeat = heartbeatOptions{interval: interval, misses: misses}
+}
+
+// SetShutdownGrace sets how long a closed plug may take to exit before it is sent SIGTERM,
+// and how long it may take after SIGTERM before it is killed. Zero means DefaultTerminateGrace
+// and DefaultKillGrace respectively.
+func (c *common) SetShutdownGrace(terminate, kill time.Duration) {
+	c.grace = shutdownGrace{terminate: terminate, kill: kill}
+}
+
+// Health returns a snapshot of the state of the plug: whether it is alive, when it was last
+// heard from, and the round-trip time of the last heartbeat (see SetHeartbeat and Ping).
+func (c *common) Health() Health {
+	conn := c.conn.Load()
+	if conn == nil {
+		return Health{}
+	}
+	return conn.health()
+}
+
+// Ping sends a heartbeat to the plug and waits for the answer until ctx ends.
+// It returns the round-trip time, or ErrHeartbeatUnsupported if the plug does not
+// answer heartbeats.
+func (c *common) Ping(ctx context.Context) (time.Duration, error) {
+	conn := c.conn.Load()
+	if conn == nil {
+		return 0, errors.New("client is not ready")
+	}
+	return conn.ping(ctx)
+}
+
+// Describe asks the plug for its description: its name and metadata, and the message types
+// it handles with the schemas of their requests and responses, where known. It waits for the
+// answer until ctx ends, and returns ErrDescribeUnsupported if the plug does not describe itself.
+func (c *common) Describe(ctx context.Context) (*messages.Description, error) {
+	conn := c.conn.Load()
+	if conn == nil {
+		return nil, errors.New("client is not ready")
+	}
+	return conn.describe(ctx)
+}
+
+// Exited returns a channel closed once the plug process exits, or nil if the plug has not
+// been started. After a restart by a Supervisor, it refers to the new process.
+func (c *common) Exited() <-chan struct{} {
+	conn := c.conn.Load()
+	if conn == nil {
+		return nil
+	}
+	return conn.exited
+}
+
+// ExitStatus returns how the plug process ended, or nil while it is running or before it is started.
+func (c *common) ExitStatus() *ExitStatus {
+	conn := c.conn.Load()
+	if conn == nil {
+		return nil
+	}
+	return conn.exitStatus()
+}
+
+func (c *common) current() *conn {
+	return c.conn.Load()
+}
@@ -0,0 +1,537 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// discardLogger is used by clients and connections without a logger.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// loggerOrDiscard returns l, or a logger discarding every record if l is nil.
+func loggerOrDiscard(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return discardLogger
+	}
+	return l
+}
+
+// errConnClosed is reported to callers waiting on a connection that was shut down by the host.
+var errConnClosed = errors.New("connection to plug closed")
+
+// contextReason maps an error caused by an expired or cancelled context to the
+// PluginExitReason reported to the caller. ok is false for any other error.
+func contextReason(err error) (reason codes.PluginExitReason, ok bool) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.OperationTimeout, true
+	case errors.Is(err, context.Canceled):
+		return codes.OperationCancelledByClient, true
+	}
+	return 0, false
+}
+
+// conn is the message channel between a client and a running plug process.
+//
+// A single reader goroutine decodes envelopes sent by the plug and routes every reply
+// to the caller waiting for it, matched by Envelope.ReplyTo. Writes are serialized,
+// so conn is safe for concurrent use. Messages that answer no pending request are
+// passed to the unsolicited handler, if any.
+type conn struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	files   []io.Closer // read ends of the plug's pipes, closed with the connection
+	output  *plugOutput
+	log     *slog.Logger // carries the plug name and PID
+	codec   codec.Codec  // negotiated during the handshake
+	encoder codec.Encoder
+	decoder codec.Decoder
+	version int
+	ids     atomic.Uint64
+
+	sessions bool        // the plug serves more than one command
+	finished atomic.Bool // the plug session is over
+
+	heartbeats  bool // the plug answers heartbeats
+	describable bool // the plug answers describe requests
+	beats       heartbeatOptions
+	lastSeen    atomic.Int64 // UnixNano of the last message from the plug
+	rtt         atomic.Int64 // round-trip time of the last heartbeat
+	misses      atomic.Int32 // heartbeats missed in a row
+
+	writeLock chan struct{} // held while an envelope is being written
+	closeOnce sync.Once
+	closeErr  error
+	closing   atomic.Bool // the host is shutting the plug down
+
+	exited chan struct{} // closed once the plug process is reaped
+	status *ExitStatus
+
+	mu          sync.Mutex
+	pending     map[uint64]chan messages.Envelope
+	order       []uint64 // pending IDs, oldest first
+	unsolicited func(messages.Envelope)
+	onCall      func(codec.Codec, *messages.Call) (any, error) // serves calls from the plug, if set
+	started     bool
+	err         error
+	done        chan struct{}
+}
+
+// dialOptions configure how a plug process is started.
+type dialOptions struct {
+	command      string
+	messageTypes []string      // message types advertised by the host
+	timeout      time.Duration // handshake timeout
+	logSink      LogSink       // receives the plug's output, or nil for the host's stderr
+	logger       *slog.Logger
+	heartbeat    heartbeatOptions
+	limits       messages.DecoderLimits // of the messages accepted from the plug
+	codec        codec.Codec            // of the Hello, and preferred for the session
+}
+
+// dial starts the plug process and performs the handshake.
+//
+// The host offers the plug dedicated protocol pipes (see messages.FeatureFDTransport).
+// If the plug takes them, its stdout carries plain output, which is captured together with
+// the plug's stderr (see LogSink). Otherwise, the protocol runs over stdin/stdout.
+//
+// ctx bounds the handshake only; it does not control the lifetime of the plug process.
+// The returned connection is not reading from the plug yet, see conn.start.
+func dial(ctx context.Context, opts dialOptions) (*conn, *messages.Hello, error) {
+	if opts.command == "" {
+		return nil, nil, errors.New("command executable is required")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(opts.command) // #nosec G204
+	// The pipes are created by hand, as the ones from cmd.StdoutPipe and cmd.StderrPipe
+	// are closed by cmd.Wait, possibly before all the output has been read.
+	// pipes holds the host ends, closed if the plug cannot be started.
+	var pipes []io.Closer
+	abort := func(fds *fdPipes, err error) (*conn, *messages.Hello, error) {
+		for _, p := range pipes {
+			_ = p.Close()
+		}
+		fds.close()
+		return nil, nil, err
+	}
+	plugStdin, stdin, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	pipes = append(pipes, stdin, plugStdin)
+	stdout, plugStdout, err := os.Pipe()
+	if err != nil {
+		return abort(nil, err)
+	}
+	pipes = append(pipes, stdout, plugStdout)
+	helloCodec := opts.codec
+	if helloCodec == nil {
+		helloCodec = codec.CBOR
+	}
+	dec, err := helloCodec.NewDecoder(stdout, opts.limits)
+	if err != nil {
+		return abort(nil, err)
+	}
+	stderr, plugStderr, err := os.Pipe()
+	if err != nil {
+		return abort(nil, err)
+	}
+	pipes = append(pipes, stderr, plugStderr)
+	cmd.Stdin = plugStdin
+	cmd.Stdout = plugStdout
+	cmd.Stderr = plugStderr
+	fds, err := newFDPipes(cmd)
+	if err != nil {
+		return abort(nil, err)
+	}
+	cmd.Env = append(cmd.Environ(), messages.CodecEnv+"="+helloCodec.Name())
+
+	e := cmd.Start()
+	_ = plugStdin.Close()
+	_ = plugStdout.Close()
+	_ = plugStderr.Close()
+	fds.started()
+	if e != nil {
+		return abort(fds, e)
+	}
+
+	output := &plugOutput{sink: opts.logSink, pid: cmd.Process.Pid, name: filepath.Base(opts.command)}
+	output.capture(StreamStderr, stderr, stderr)
+
+	hello := hostHello(opts.messageTypes)
+	if fds != nil {
+		hello.Features = append(hello.Features, messages.FeatureFDTransport)
+	}
+	hello.Codecs = codec.Names(helloCodec)
+	log := loggerOrDiscard(opts.logger)
+	info, version, sessionCodec, err := handshake(ctx, cmd, helloCodec, stdin, dec, hello, opts.timeout)
+	if err != nil {
+		log.LogAttrs(ctx, slog.LevelWarn, "plug handshake failed",
+			slog.String("command", opts.command), slog.Any("error", err))
+		// The plug is killed and reaped before its pipes are closed, so it cannot block on them.
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		_, _, err = abort(fds, err)
+		output.wait()
+		return nil, nil, err
+	}
+	if info.Name != "" {
+		output.setName(info.Name)
+	}
+
+	var c *conn
+	if fds != nil && info.HasFeature(messages.FeatureFDTransport) {
+		// The plug moved to the protocol pipes; anything it prints from now on is plain output.
+		_ = stdin.Close()
+		output.capture(StreamStdout, io.MultiReader(dec.Buffered(), stdout), stdout)
+		// The limits were validated with the first decoder.
+		fdsDec, _ := sessionCodec.NewDecoder(fds.out, opts.limits)
+		c = newConn(cmd, fds.in, sessionCodec, fdsDec, version)
+		c.files = []io.Closer{fds.out}
+	} else {
+		fds.close()
+		if sessionCodec != helloCodec {
+			dec, _ = sessionCodec.NewDecoder(io.MultiReader(dec.Buffered(), stdout), opts.limits)
+		}
+		c = newConn(cmd, stdin, sessionCodec, dec, version)
+		c.files = []io.Closer{stdout}
+	}
+	c.output = output
+	c.log = log.With(slog.String("plug", info.Name), slog.Int("pid", cmd.Process.Pid))
+	c.sessions = info.HasFeature(messages.FeatureSessions)
+	c.heartbeats = info.HasFeature(messages.FeatureHeartbeat)
+	c.describable = info.HasFeature(messages.FeatureDescribe)
+	c.beats = opts.heartbeat
+	c.lastSeen.Store(time.Now().UnixNano())
+	go c.reap()
+	c.log.LogAttrs(ctx, slog.LevelDebug, "plug started",
+		slog.Int("version", version), slog.String("codec", sessionCodec.Name()), slog.Any("features", info.Features))
+	return c, info, nil
+}
+
+// newConn wraps the pipes of an already started and handshaken plug process,
+// talking the negotiated codec c.
+func newConn(cmd *exec.Cmd, stdin io.WriteCloser, c codec.Codec, dec codec.Decoder, version int) *conn {
+	return &conn{
+		cmd:       cmd,
+		log:       discardLogger,
+		stdin:     stdin,
+		codec:     c,
+		encoder:   c.NewEncoder(stdin),
+		decoder:   dec,
+		version:   version,
+		writeLock: make(chan struct{}, 1),
+		pending:   make(map[uint64]chan messages.Envelope),
+		done:      make(chan struct{}),
+		exited:    make(chan struct{}),
+	}
+}
+
+// start launches the reader goroutine, and the heartbeats if they are enabled.
+// Messages answering no pending request are passed to unsolicited, which may be nil.
+// Calls from the plug are served by onCall; if it is nil, they are treated like any
+// other message. start is idempotent.
+func (c *conn) start(unsolicited func(messages.Envelope), onCall func(codec.Codec, *messages.Call) (any, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
+	c.started = true
+	c.unsolicited = unsolicited
+	c.onCall = onCall
+	go c.readLoop()
+	if c.beats.interval > 0 && c.heartbeats {
+		go c.beat(c.beats)
+	}
+}
+
+// raw encodes v with the codec of the session. It panics if v cannot be encoded.
+func (c *conn) raw(v any) messages.RawMessage {
+	return codec.MustMarshal(c.codec, v)
+}
+
+// send writes a message to the plug and returns the ID assigned to it.
+// replyTo is the ID of the plug message being answered, or zero.
+func (c *conn) send(ctx context.Context, replyTo uint64, messageCode string, payload messages.RawMessage) (uint64, error) {
+	id := c.ids.Add(1)
+	return id, c.write(ctx, messages.Envelope{
+		Version: c.version,
+		ID:      id,
+		ReplyTo: replyTo,
+		Type:    messageCode,
+		Raw:     payload,
+	})
+}
+
+// write encodes a single envelope, serialized with all other writes.
+//
+// ctx bounds the wait for other writers only: once started, an envelope is always
+// written as a whole, so the stream stays intact.
+func (c *conn) write(ctx context.Context, msg messages.Envelope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case c.writeLock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-c.writeLock }()
+	return c.encoder.Encode(&msg)
+}
+
+// request sends a message to the plug and waits for the plug's reply to it.
+//
+// If ctx ends first, the request is abandoned: the plug is told with codes.CancelMessage,
+// a late reply is dropped, and ctx.Err() is returned.
+func (c *conn) request(ctx context.Context, messageCode string, payload messages.RawMessage) (messages.Envelope, error) {
+	if err := ctx.Err(); err != nil {
+		return messages.Envelope{}, err
+	}
+	id := c.ids.Add(1)
+	reply := make(chan messages.Envelope, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return messages.Envelope{}, c.err
+	}
+	c.pending[id] = reply
+	c.order = append(c.order, id)
+	c.mu.Unlock()
+
+	err := c.write(ctx, messages.Envelope{
+		Version: c.version,
+		ID:      id,
+		Type:    messageCode,
+		Raw:     payload,
+	})
+	if err != nil {
+		c.forget(id)
+		return messages.Envelope{}, err
+	}
+
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-c.done:
+		// The reply may have been routed right before the connection broke.
+		select {
+		case msg := <-reply:
+			return msg, nil
+		default:
+		}
+		c.forget(id)
+		return messages.Envelope{}, c.err
+	case <-ctx.Done():
+		select {
+		case msg := <-reply:
+			return msg, nil
+		default:
+		}
+		c.abandon(id)
+		return messages.Envelope{}, ctx.Err()
+	}
+}
+
+// abandon stops waiting for the reply to the request with the given ID and tells the plug
+// about it. The cancellation is written in the background, so a plug that does not read
+// its input cannot block the caller; the write fails once the connection is closed.
+func (c *conn) abandon(id uint64) {
+	c.forget(id)
+	if c.isDone() {
+		return
+	}
+	go func() {
+		_, _ = c.send(context.Background(), 0, string(codes.CancelMessage), c.raw(&messages.Cancel{ID: id}))
+	}()
+}
+
+// forget removes a pending request, e.g. after its caller stopped waiting.
+func (c *conn) forget(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.take(id)
+}
+
+// take removes the pending request with the given ID and returns its reply channel.
+// c.mu must be held.
+func (c *conn) take(id uint64) chan messages.Envelope {
+	reply, ok := c.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(c.pending, id)
+	for i, p := range c.order {
+		if p == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return reply
+}
+
+// readLoop decodes messages from the plug until the stream breaks.
+func (c *conn) readLoop() {
+	for {
+		var msg messages.Envelope
+		if err := c.decoder.Decode(&msg); err != nil {
+			if errors.Is(err, messages.ErrLimitExceeded) {
+				c.reject(err)
+				return
+			}
+			c.log.LogAttrs(context.Background(), slog.LevelDebug, "plug stream ended", slog.Any("error", err))
+			c.shutdown(err)
+			return
+		}
+		c.lastSeen.Store(time.Now().UnixNano())
+		if err := checkVersion(&msg); err != nil {
+			c.log.LogAttrs(context.Background(), slog.LevelWarn, "message rejected", slog.Any("error", err))
+			_, _ = c.send(context.Background(), msg.ID, string(codes.VersionUnsupported), c.raw(messages.NewVersionUnsupported(msg.Version)))
+			continue
+		}
+		if msg.Type == string(codes.PluginCrashed) {
+			c.logCrash(&msg)
+		}
+		if msg.Type == string(codes.CallMessage) && c.onCall != nil {
+			go c.serveCall(msg)
+			continue
+		}
+		c.route(msg)
+	}
+}
+
+// reject tears the connection down after the plug sent a message exceeding the decoder limits,
+// which leaves the stream unreadable. The plug is told with codes.PayloadMalformed, callers
+// waiting for it fail with err, and the plug process is killed.
+func (c *conn) reject(err error) {
+	c.log.LogAttrs(context.Background(), slog.LevelError, "plug message rejected, killing the plug", slog.Any("error", err))
+	// A plug that does not read its input cannot hold the teardown up; killing it ends the write.
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		_, _ = c.send(context.Background(), 0, string(codes.PayloadMalformed), c.raw(&messages.Error{
+			Code:    codes.DataFormatError,
+			Message: err.Error(),
+		}))
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+	}
+	c.shutdown(err)
+	_ = c.cmd.Process.Kill()
+}
+
+// logCrash logs a panic reported by the plug.
+func (c *conn) logCrash(msg *messages.Envelope) {
+	var crash messages.PluginCrash
+	_ = c.codec.Unmarshal(msg.Raw, &crash)
+	c.log.LogAttrs(context.Background(), slog.LevelError, "plug handler panicked",
+		slog.String("type", crash.Type), slog.Uint64("id", msg.ReplyTo),
+		slog.String("panic", crash.Panic), slog.String("stack", crash.Stack))
+}
+
+// route hands a message over to the request it answers.
+//
+// Messages without ReplyTo are passed to the unsolicited handler. Without one, they are
+// matched with the oldest pending request, as PlugKit plugs answer requests in order.
+func (c *conn) route(msg messages.Envelope) {
+	c.mu.Lock()
+	var reply chan messages.Envelope
+	switch {
+	case msg.ReplyTo != 0:
+		reply = c.take(msg.ReplyTo)
+	case c.unsolicited == nil && len(c.order) > 0:
+		reply = c.take(c.order[0])
+	}
+	unsolicited := c.unsolicited
+	c.mu.Unlock()
+
+	switch {
+	case reply != nil:
+		reply <- msg
+	case unsolicited != nil:
+		unsolicited(msg)
+	default:
+		// Most likely the answer to a request its caller stopped waiting for.
+		c.log.LogAttrs(context.Background(), slog.LevelDebug, "message dropped",
+			slog.String("type", msg.Type), slog.Uint64("id", msg.ID), slog.Uint64("replyTo", msg.ReplyTo))
+	}
+}
+
+// logCommand logs the outcome of the command messageType sent at started.
+// reply is the plug's answer, if there is one.
+func (c *conn) logCommand(ctx context.Context, level slog.Level, msg string, messageType string, reply *messages.Envelope, started time.Time, attrs ...slog.Attr) {
+	attrs = append(attrs, slog.String("type", messageType), slog.Duration("duration", time.Since(started)))
+	if reply != nil {
+		attrs = append(attrs, slog.Uint64("id", reply.ReplyTo), slog.String("reply", reply.Type))
+	}
+	c.log.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// shutdown marks the connection as broken and wakes up every waiting caller.
+func (c *conn) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// isDone reports whether the connection to the plug is broken.
+func (c *conn) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes the plug's input, waits for the plug to close its end of the stream
+// and for the process to be reaped. close is idempotent.
+func (c *conn) close() error {
+	c.closeOnce.Do(func() {
+		c.closing.Store(true)
+		_ = c.stdin.Close()
+		c.mu.Lock()
+		started := c.started
+		c.mu.Unlock()
+		if started {
+			<-c.done
+		} else {
+			c.shutdown(errConnClosed)
+		}
+		<-c.exited
+		c.closeErr = c.status.Err
+		for _, f := range c.files {
+			_ = f.Close()
+		}
+		if c.output != nil {
+			c.output.wait()
+		}
+	})
+	return c.closeErr
+}
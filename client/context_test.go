@@ -0,0 +1,44 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestCommandDeadline(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	reason, _, err := echo(ctx, c, "wait", "")
+	if reason != codes.OperationTimeout || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunCommandContext() = %v, %v, want %v and context.DeadlineExceeded", reason, err, codes.OperationTimeout)
+	}
+	// The plug outlives the abandoned command.
+	if _, got, err := echo(context.Background(), c, "echo", "still there"); err != nil || got != "still there" {
+		t.Errorf("command after the deadline = %q, %v", got, err)
+	}
+}
+
+func TestCommandContextDone(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if reason, _, err := echo(ctx, c, "echo", ""); reason != codes.OperationCancelledByClient || !errors.Is(err, context.Canceled) {
+		t.Errorf("RunCommandContext() = %v, %v, want %v and context.Canceled", reason, err, codes.OperationCancelledByClient)
+	}
+	if _, err := c.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping() = %v, want context.Canceled", err)
+	}
+	if _, err := c.Describe(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Describe() = %v, want context.Canceled", err)
+	}
+}
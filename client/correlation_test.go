@@ -0,0 +1,68 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func init() {
+	// reorder collects two commands, then answers them in reverse order, after a response
+	// to a request that was never sent.
+	plugs["reorder"] = func() {
+		var held []messages.Envelope
+		fakePlug(plugHello, func(p *fake, msg messages.Envelope) {
+			held = append(held, msg)
+			if len(held) < 2 {
+				return
+			}
+			p.send(999, string(codes.PluginResponse), &messages.Result{Type: "echo", Value: text{"stray"}})
+			for i := len(held) - 1; i >= 0; i-- {
+				var in text
+				_ = p.codec.Unmarshal(held[i].Raw, &in)
+				p.send(held[i].ID, string(codes.PluginResponse), &messages.Result{Type: "echo", Value: in})
+			}
+			held = nil
+		})
+	}
+}
+
+func TestResponseCorrelation(t *testing.T) {
+	c := startEcho(t, "reorder", nil)
+
+	var wg sync.WaitGroup
+	for _, want := range []string{"first", "second"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, got, err := echo(context.Background(), c, "echo", want); err != nil || got != want {
+				t.Errorf("command %q got %q, %v", want, got, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentCommands(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			want := fmt.Sprint("command ", i)
+			if _, got, err := echo(context.Background(), c, "echo", want); err != nil || got != want {
+				t.Errorf("command %q got %q, %v", want, got, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
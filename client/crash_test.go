@@ -0,0 +1,139 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/plug"
+)
+
+func init() {
+	plugs["echo-finish-on-panic"] = func() {
+		echoPlug(func(p *plug.SmartPlug) { p.SetPanicPolicy(plug.FinishOnPanic) })
+	}
+	plugs["stream-finish-on-panic"] = func() {
+		p := plug.NewRawStreamPlug(&panicky{})
+		p.SetPanicPolicy(plug.FinishOnPanic)
+		if err := p.Main(); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// panicky is a stream plug panicking on "panic", and echoing every other message.
+type panicky struct {
+	p *plug.RawStreamPlug
+}
+
+func (s *panicky) Mount(p *plug.RawStreamPlug) { s.p = p }
+
+func (s *panicky) CloseSignal() {}
+
+func (s *panicky) Handle(kind string, payload messages.RawMessage, id, _ uint64) {
+	if kind == "panic" {
+		panic("boom")
+	}
+	s.p.Reply(id, kind, payload)
+}
+
+// received collects the types of the messages a stream client receives.
+type received struct {
+	types chan string
+}
+
+func (r *received) Mount(*client.RawStreamClient) {}
+
+func (r *received) CloseSignal() {}
+
+func (r *received) Handle(kind string, _ *messages.RawMessage, _, _ uint64) {
+	r.types <- kind
+}
+
+func TestPanicReported(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	reason, _, err := echo(context.Background(), c, "panic", "boom")
+	if reason != codes.PlugCrashed {
+		t.Errorf("reason = %v, want %v", reason, codes.PlugCrashed)
+	}
+	var remote *plugkit.RemoteError
+	if !errors.As(err, &remote) {
+		t.Fatalf("RunCommand() = %v, want a *plugkit.RemoteError", err)
+	}
+	if remote.Message != "panic: boom" || remote.Details["type"] != "panic" {
+		t.Errorf("crash reported as %+v", remote)
+	}
+	if stack, _ := remote.Details["stack"].(string); !strings.Contains(stack, "main_test.go") {
+		t.Errorf("stack trace does not show the handler:\n%s", stack)
+	}
+
+	// ContinueOnPanic keeps the session going.
+	if _, got, err := echo(context.Background(), c, "echo", "alive"); err != nil || got != "alive" {
+		t.Errorf("command after the panic = %q, %v", got, err)
+	}
+}
+
+func TestFinishOnPanic(t *testing.T) {
+	c := startEcho(t, "echo-finish-on-panic", nil)
+
+	if reason, _, _ := echo(context.Background(), c, "panic", "boom"); reason != codes.PlugCrashed {
+		t.Errorf("reason = %v, want %v", reason, codes.PlugCrashed)
+	}
+	if _, _, err := echo(context.Background(), c, "echo", "dead"); !errors.Is(err, client.ErrSessionClosed) {
+		t.Errorf("command after the panic = %v, want client.ErrSessionClosed", err)
+	}
+	select {
+	case <-c.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("plug did not exit after the panic")
+	}
+}
+
+func TestStreamFinishOnPanic(t *testing.T) {
+	r := &received{types: make(chan string, 10)}
+	c := client.NewRawStreamClient(r, plugCommand(t, "stream-finish-on-panic"))
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close(context.Background()) })
+	stopped := make(chan struct{})
+	go func() {
+		c.Run()
+		close(stopped)
+	}()
+
+	if _, err := c.SendContext(context.Background(), "panic", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The client handles every message in its own goroutine, so they may arrive in any order.
+	var got []string
+	for range 2 {
+		select {
+		case kind := <-r.types:
+			got = append(got, kind)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %q, want a crash report and a finish", got)
+		}
+	}
+	slices.Sort(got)
+	if want := []string{string(codes.FinishMessage), string(codes.PluginCrashed)}; !slices.Equal(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the plug finished")
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// ErrDescribeUnsupported is returned by Describe for plugs that do not describe themselves,
+// see messages.FeatureDescribe.
+var ErrDescribeUnsupported = errors.New("plug does not support describe")
+
+// describe asks the plug for its description.
+func (c *conn) describe(ctx context.Context) (*messages.Description, error) {
+	if !c.describable {
+		return nil, ErrDescribeUnsupported
+	}
+	msg, err := c.request(ctx, string(codes.DescribeMessage), c.raw(&messages.Describe{}))
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != string(codes.DescriptionMessage) {
+		return nil, fmt.Errorf("unexpected %q message in answer to describe", msg.Type)
+	}
+	var d messages.Description
+	if err := c.codec.Unmarshal(msg.Raw, &d); err != nil {
+		return nil, fmt.Errorf("decoding plug description: %w", err)
+	}
+	return &d, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+func TestDescribe(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	d, err := c.Describe(context.Background())
+	if err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if d.Name != "echo" || d.LibraryVersion != messages.LibraryVersion {
+		t.Errorf("plug described as %q of library %s", d.Name, d.LibraryVersion)
+	}
+	if d.Metadata != (messages.Metadata{Version: "1.2.3", Author: "PlugKit"}) {
+		t.Errorf("metadata = %+v", d.Metadata)
+	}
+
+	// Typed handlers describe their request and response, other handlers their request only.
+	length := d.MessageType("length")
+	if length == nil {
+		t.Fatalf("description lacks %q: %+v", "length", d.MessageTypes)
+	}
+	if length.Request == nil || length.Request.Kind != schema.Object || len(length.Request.Fields) != 1 {
+		t.Errorf("length request = %+v, want the text object", length.Request)
+	}
+	if length.Response == nil || length.Response.Kind != schema.Integer {
+		t.Errorf("length response = %+v, want an integer", length.Response)
+	}
+	if echo := d.MessageType("echo"); echo == nil || echo.Request == nil || echo.Response != nil {
+		t.Errorf("echo described as %+v, want its request only", echo)
+	}
+	if d.MessageType("unknown") != nil {
+		t.Error("description lists an unknown message type")
+	}
+}
+
+func TestDescribeUnsupported(t *testing.T) {
+	c := startEcho(t, "reorder", nil)
+	if _, err := c.Describe(context.Background()); !errors.Is(err, client.ErrDescribeUnsupported) {
+		t.Errorf("Describe() = %v, want client.ErrDescribeUnsupported", err)
+	}
+}
+
+func TestDescribeNotStarted(t *testing.T) {
+	c := client.NewSmartClient(plugCommand(t, "echo"))
+	if _, err := c.Describe(context.Background()); err == nil {
+		t.Error("Describe() succeeded before StartLocal")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// ExitStatus describes how a plug process ended.
+type ExitStatus struct {
+	PID    int
+	Code   int       // exit code, or -1 if the process was killed by a signal
+	Signal os.Signal // the signal that killed the process, if any
+	Err    error     // the error returned by waiting for the process, e.g. *exec.ExitError
+}
+
+// Success reports whether the plug process exited on its own with exit code zero.
+func (s *ExitStatus) Success() bool {
+	return s.Err == nil && s.Code == 0 && s.Signal == nil
+}
+
+// String returns a short description of the exit status, e.g. "exit code 1" or "signal: killed".
+func (s *ExitStatus) String() string {
+	switch {
+	case s.Signal != nil:
+		return "signal: " + s.Signal.String()
+	case s.Code >= 0:
+		return fmt.Sprintf("exit code %d", s.Code)
+	case s.Err != nil:
+		return s.Err.Error()
+	}
+	return "unknown exit status"
+}
+
+// reap waits for the plug process to exit and records its ExitStatus. It is started
+// together with the connection, so a plug that dies is reaped even if nobody asks for it.
+func (c *conn) reap() {
+	err := c.cmd.Wait()
+	status := &ExitStatus{PID: c.cmd.Process.Pid, Code: -1, Err: err}
+	if state := c.cmd.ProcessState; state != nil {
+		status.Code = state.ExitCode()
+		if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			status.Signal = ws.Signal()
+		}
+	}
+	c.status = status
+	close(c.exited)
+
+	level := slog.LevelInfo
+	if !status.Success() && !c.closing.Load() {
+		level = slog.LevelWarn
+	}
+	c.log.LogAttrs(context.Background(), level, "plug exited",
+		slog.Int("code", status.Code), slog.Any("signal", status.Signal))
+}
+
+// exitStatus returns the ExitStatus of the plug process, or nil while it is running.
+func (c *conn) exitStatus() *ExitStatus {
+	select {
+	case <-c.exited:
+		return c.status
+	default:
+		return nil
+	}
+}
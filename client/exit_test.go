@@ -0,0 +1,57 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func init() {
+	// malformed answers every command with a response that is not a result.
+	plugs["malformed"] = func() {
+		fakePlug(plugHello, func(p *fake, msg messages.Envelope) {
+			p.send(msg.ID, string(codes.PluginResponse), "not a result")
+		})
+	}
+}
+
+func TestExitReason(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	for _, want := range []codes.PluginExitReason{codes.OperationSuccess, codes.OperationError, codes.DataFormatError} {
+		reason, got, err := echo(context.Background(), c, "exit", fmt.Sprint(int(want)))
+		if err != nil || reason != want || got != fmt.Sprint(int(want)) {
+			t.Errorf("exit %d = %v, %q, %v, want %v with the result", want, reason, got, err, want)
+		}
+	}
+}
+
+func TestExitReasonOfFinish(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	reason, _, err := echo(context.Background(), c, "finish", fmt.Sprint(int(codes.DataFormatError)))
+	if reason != codes.DataFormatError {
+		t.Errorf("finish = %v, want %v", reason, codes.DataFormatError)
+	}
+	var remote *plugkit.RemoteError
+	if !errors.As(err, &remote) || remote.Code != codes.DataFormatError {
+		t.Errorf("finish = %v, want a *plugkit.RemoteError with %v", err, codes.DataFormatError)
+	}
+}
+
+func TestMalformedResult(t *testing.T) {
+	c := startEcho(t, "malformed", nil)
+	reason, res, err := echo(context.Background(), c, "echo", "hi")
+	if reason != codes.PluginToHostCommunicationError || !errors.Is(err, codes.PluginToHostCommunicationError) {
+		t.Errorf("RunCommand() = %v, %v, want %v", reason, err, codes.PluginToHostCommunicationError)
+	}
+	if res != "" {
+		t.Errorf("RunCommand() result = %q, want none", res)
+	}
+}
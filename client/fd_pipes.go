@@ -0,0 +1,65 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// fdPipes are the dedicated protocol pipes passed to the plug process,
+// see messages.FeatureFDTransport.
+type fdPipes struct {
+	in      *os.File // host end of the host to plug pipe
+	out     *os.File // host end of the plug to host pipe
+	plugIn  *os.File
+	plugOut *os.File
+}
+
+// newFDPipes creates the protocol pipes and attaches them to cmd as messages.FDTransportIn
+// and messages.FDTransportOut. It returns nil where extra file descriptors cannot be
+// passed to a child process, and the plug talks over stdin/stdout.
+func newFDPipes(cmd *exec.Cmd) (*fdPipes, error) {
+	if runtime.GOOS == "windows" {
+		return nil, nil
+	}
+
+	plugIn, in, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	out, plugOut, err := os.Pipe()
+	if err != nil {
+		_ = plugIn.Close()
+		_ = in.Close()
+		return nil, err
+	}
+
+	// ExtraFiles[i] becomes file descriptor 3+i in the child.
+	cmd.ExtraFiles = []*os.File{plugIn, plugOut}
+	cmd.Env = append(os.Environ(), messages.FDTransportEnv+"=1")
+	return &fdPipes{in: in, out: out, plugIn: plugIn, plugOut: plugOut}, nil
+}
+
+// started closes the plug ends of the pipes in the host, once the plug process holds them.
+func (p *fdPipes) started() {
+	if p == nil {
+		return
+	}
+	_ = p.plugIn.Close()
+	_ = p.plugOut.Close()
+}
+
+// close closes the host ends of the pipes, e.g. when the plug does not use them.
+func (p *fdPipes) close() {
+	if p == nil {
+		return
+	}
+	p.started()
+	_ = p.in.Close()
+	_ = p.out.Close()
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// DefaultHandshakeTimeout is the time a client waits for the plug to answer the hello
+// before it gives up and kills the process.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+var (
+	// ErrNotAPlug is reported when the started process does not answer the hello
+	// with a PlugKit handshake (it exits, prints garbage or stays silent).
+	ErrNotAPlug = errors.New("process is not a PlugKit plug")
+
+	// ErrIncompatiblePlug is reported when the plug answers the hello, but speaks
+	// a protocol the host does not support.
+	ErrIncompatiblePlug = errors.New("plug is incompatible with this host")
+)
+
+// HandshakeError is returned by StartLocal (and RawStreamClient.Start) when the
+// hello exchange with the plug fails. The plug process is killed before the error is returned.
+//
+// Use errors.Is with ErrNotAPlug or ErrIncompatiblePlug to tell the two cases apart.
+type HandshakeError struct {
+	Command string
+	Kind    error           // ErrNotAPlug or ErrIncompatiblePlug
+	Plug    *messages.Hello // Hello received from the plug, if any
+	Cause   error
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Cause == nil {
+		return fmt.Sprintf("%s: %s", e.Command, e.Kind)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Command, e.Kind, e.Cause)
+}
+
+// Unwrap exposes both the kind of the failure and its underlying cause to errors.Is and errors.As.
+func (e *HandshakeError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Cause}
+}
+
+// Reason maps the handshake failure to a PluginExitReason.
+func (e *HandshakeError) Reason() codes.PluginExitReason {
+	if errors.Is(e.Kind, ErrIncompatiblePlug) {
+		return codes.RemoteErrorInProtocol
+	}
+	return codes.PlugNotStarted
+}
+
+// hostHello builds the Hello message sent by the host.
+func hostHello(messageTypes []string) *messages.Hello {
+	return &messages.Hello{
+		ProtocolVersion:    messages.ProtocolVersion,
+		MinProtocolVersion: messages.MinProtocolVersion,
+		LibraryVersion:     messages.LibraryVersion,
+		MessageTypes:       messageTypes,
+		Features:           []string{messages.FeatureCalls},
+	}
+}
+
+// handshake sends the host Hello to a freshly started plug and waits for the plug's Hello,
+// both encoded with c. It returns the plug's Hello, the negotiated protocol version and the
+// codec the plug picked for the rest of the session from local.Codecs (c if it picked none).
+//
+// On failure, or when ctx ends before the plug answers, the caller has to kill the plug
+// process and close its pipes, which also ends the wait for the plug's Hello.
+func handshake(ctx context.Context, cmd *exec.Cmd, c codec.Codec, w io.Writer, dec codec.Decoder, local *messages.Hello, timeout time.Duration) (*messages.Hello, int, codec.Codec, error) {
+	fail := func(kind error, plug *messages.Hello, cause error) (*messages.Hello, int, codec.Codec, error) {
+		return nil, 0, nil, &HandshakeError{Command: cmd.Path, Kind: kind, Plug: plug, Cause: cause}
+	}
+
+	err := c.NewEncoder(w).Encode(messages.Envelope{
+		Version: messages.ProtocolVersion,
+		Type:    string(codes.HelloMessage),
+		Raw:     codec.MustMarshal(c, local),
+	})
+	if err != nil {
+		return fail(ErrNotAPlug, nil, err)
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	type reply struct {
+		msg messages.Envelope
+		err error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		var r reply
+		r.err = dec.Decode(&r.msg)
+		replies <- r
+	}()
+
+	var r reply
+	select {
+	case r = <-replies:
+	case <-time.After(timeout):
+		return fail(ErrNotAPlug, nil, fmt.Errorf("no hello received within %s", timeout))
+	case <-ctx.Done():
+		return nil, 0, nil, fmt.Errorf("%s: handshake aborted: %w", cmd.Path, ctx.Err())
+	}
+	if r.err != nil {
+		return fail(ErrNotAPlug, nil, r.err)
+	}
+	if r.msg.Type != string(codes.HelloMessage) {
+		return fail(ErrNotAPlug, nil, fmt.Errorf("unexpected %q message instead of hello", r.msg.Type))
+	}
+
+	var remote messages.Hello
+	if e := c.Unmarshal(r.msg.Raw, &remote); e != nil {
+		return fail(ErrNotAPlug, nil, e)
+	}
+	version, err := messages.NegotiateVersion(&remote)
+	if err != nil {
+		return fail(ErrIncompatiblePlug, &remote, err)
+	}
+	if remote.Codec != "" {
+		picked, ok := codec.ByName(remote.Codec)
+		if !ok || !slices.Contains(local.Codecs, remote.Codec) {
+			return fail(ErrIncompatiblePlug, &remote, fmt.Errorf("plug picked codec %q, which was not offered", remote.Codec))
+		}
+		c = picked
+	}
+
+	return &remote, version, c, nil
+}
+
+// versionRejected converts a VersionUnsupported message received from the plug into an error.
+func (c *conn) versionRejected(msg *messages.Envelope) error {
+	var rejected messages.VersionUnsupported
+	if err := c.codec.Unmarshal(msg.Raw, &rejected); err != nil {
+		return fmt.Errorf("%w: %w", messages.ErrUnsupportedVersion, err)
+	}
+	return fmt.Errorf("%w: plug rejected version %d, it speaks %d-%d", messages.ErrUnsupportedVersion,
+		rejected.Version, rejected.MinVersion, rejected.MaxVersion)
+}
+
+// checkVersion reports an error if the envelope uses a protocol version the host does not speak.
+func checkVersion(msg *messages.Envelope) error {
+	if messages.SupportsVersion(msg.Version) {
+		return nil
+	}
+	return fmt.Errorf("%w: plug sent %q with version %d", messages.ErrUnsupportedVersion, msg.Type, msg.Version)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func init() {
+	// silent reads the hello, but never answers it.
+	plugs["silent"] = func() { _, _ = io.Copy(io.Discard, os.Stdin) }
+	// exits quits right away.
+	plugs["exits"] = func() {}
+	// garbage prints to stdout instead of answering the hello.
+	plugs["garbage"] = func() {
+		fmt.Println("Usage: garbage [flags]")
+		_, _ = io.Copy(io.Discard, os.Stdin)
+	}
+	// refuses answers the hello with a PluginFinish.
+	plugs["refuses"] = func() {
+		p := newFake()
+		if msg, ok := p.receive(); ok {
+			p.send(msg.ID, string(codes.FinishMessage), &messages.PluginFinish{Reason: codes.OperationError})
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	info := c.PlugInfo()
+	if info == nil {
+		t.Fatal("PlugInfo() = nil after StartLocal")
+	}
+	if info.Name != "echo" {
+		t.Errorf("plug name = %q, want %q", info.Name, "echo")
+	}
+	if info.ProtocolVersion != messages.ProtocolVersion || info.LibraryVersion != messages.LibraryVersion {
+		t.Errorf("plug speaks version %d of library %s, want %d of %s",
+			info.ProtocolVersion, info.LibraryVersion, messages.ProtocolVersion, messages.LibraryVersion)
+	}
+	for _, f := range []string{messages.FeatureSessions, messages.FeatureHeartbeat, messages.FeatureDescribe} {
+		if !info.HasFeature(f) {
+			t.Errorf("plug does not advertise %q, features: %v", f, info.Features)
+		}
+	}
+	if !slices.Contains(info.MessageTypes, "echo") {
+		t.Errorf("plug message types %v lack %q", info.MessageTypes, "echo")
+	}
+}
+
+func TestHandshakeNotAPlug(t *testing.T) {
+	for _, name := range []string{"silent", "exits", "garbage"} {
+		t.Run(name, func(t *testing.T) {
+			c := client.NewSmartClient(plugCommand(t, name))
+			c.SetHandshakeTimeout(200 * time.Millisecond)
+
+			started := time.Now()
+			err := c.StartLocal()
+			var handshakeErr *client.HandshakeError
+			if !errors.As(err, &handshakeErr) {
+				t.Fatalf("StartLocal() = %v, want a *client.HandshakeError", err)
+			}
+			if !errors.Is(err, client.ErrNotAPlug) {
+				t.Errorf("StartLocal() = %v, want client.ErrNotAPlug", err)
+			}
+			if reason := handshakeErr.Reason(); reason != codes.PlugNotStarted {
+				t.Errorf("Reason() = %v, want %v", reason, codes.PlugNotStarted)
+			}
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("StartLocal took %s despite the handshake timeout", elapsed)
+			}
+			if reason, _, err := c.RunCommand("echo", text{}); err == nil || reason != codes.PlugNotStarted {
+				t.Errorf("RunCommand() = %v, %v, want %v and an error", reason, err, codes.PlugNotStarted)
+			}
+		})
+	}
+}
+
+func TestHandshakeUnexpectedReply(t *testing.T) {
+	c := client.NewSmartClient(plugCommand(t, "refuses"))
+	if err := c.StartLocal(); !errors.Is(err, client.ErrNotAPlug) {
+		t.Errorf("StartLocal() = %v, want client.ErrNotAPlug", err)
+	}
+}
+
+func TestHandshakeContext(t *testing.T) {
+	c := client.NewSmartClient(plugCommand(t, "silent"))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := c.StartLocalContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("StartLocalContext() = %v, want context.DeadlineExceeded", err)
+	}
+}
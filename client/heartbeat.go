@@ -0,0 +1,119 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// DefaultHeartbeatMisses is how many heartbeats in a row a plug may miss by default
+// before it is considered unresponsive, see SmartPlugClient.SetHeartbeat.
+const DefaultHeartbeatMisses = 3
+
+// ErrPlugUnresponsive is reported to callers waiting on a plug that stopped answering
+// heartbeats. The plug process is killed in that case.
+var ErrPlugUnresponsive = errors.New("plug is unresponsive")
+
+// ErrHeartbeatUnsupported is returned by Ping for plugs that do not answer heartbeats,
+// see messages.FeatureHeartbeat.
+var ErrHeartbeatUnsupported = errors.New("plug does not support heartbeats")
+
+// Health is a snapshot of the state of a plug process.
+type Health struct {
+	Alive    bool          // the plug is running and has not been found unresponsive
+	LastSeen time.Time     // when the last message from the plug arrived
+	RTT      time.Duration // round-trip time of the last answered heartbeat
+	Misses   int           // heartbeats missed in a row
+}
+
+// heartbeatOptions configure the heartbeats sent to a plug.
+type heartbeatOptions struct {
+	interval time.Duration // zero disables heartbeats
+	misses   int
+}
+
+// threshold returns how many heartbeats in a row the plug may miss.
+func (o heartbeatOptions) threshold() int {
+	if o.misses <= 0 {
+		return DefaultHeartbeatMisses
+	}
+	return o.misses
+}
+
+// ping sends a heartbeat to the plug and returns the round-trip time.
+func (c *conn) ping(ctx context.Context) (time.Duration, error) {
+	if !c.heartbeats {
+		return 0, ErrHeartbeatUnsupported
+	}
+	started := time.Now()
+	msg, err := c.request(ctx, string(codes.PingMessage), c.raw(&messages.Ping{}))
+	if err != nil {
+		return 0, err
+	}
+	if msg.Type != string(codes.PongMessage) {
+		return 0, fmt.Errorf("unexpected %q message in answer to a heartbeat", msg.Type)
+	}
+	rtt := time.Since(started)
+	c.rtt.Store(int64(rtt))
+	return rtt, nil
+}
+
+// beat sends heartbeats until the connection breaks. Each heartbeat has to be answered
+// within the interval. Once the plug misses too many in a row, the connection is shut down
+// with ErrPlugUnresponsive and the plug process is killed.
+func (c *conn) beat(opts heartbeatOptions) {
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), opts.interval)
+		_, err := c.ping(ctx)
+		cancel()
+		if err == nil {
+			c.misses.Store(0)
+			continue
+		}
+		if c.isDone() {
+			return
+		}
+
+		misses := int(c.misses.Add(1))
+		c.log.LogAttrs(context.Background(), slog.LevelWarn, "plug missed a heartbeat",
+			slog.Int("misses", misses), slog.Any("error", err))
+		if misses >= opts.threshold() {
+			c.log.LogAttrs(context.Background(), slog.LevelError, "plug is unresponsive, killing it",
+				slog.Time("lastSeen", c.lastSeenTime()))
+			c.shutdown(ErrPlugUnresponsive)
+			_ = c.cmd.Process.Kill()
+			return
+		}
+	}
+}
+
+// lastSeenTime returns when the last message from the plug arrived.
+func (c *conn) lastSeenTime() time.Time {
+	return time.Unix(0, c.lastSeen.Load())
+}
+
+// health returns a snapshot of the state of the plug.
+func (c *conn) health() Health {
+	return Health{
+		Alive:    !c.isDone() && c.exitStatus() == nil,
+		LastSeen: c.lastSeenTime(),
+		RTT:      time.Duration(c.rtt.Load()),
+		Misses:   int(c.misses.Load()),
+	}
+}
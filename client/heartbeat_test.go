@@ -0,0 +1,72 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func init() {
+	// deaf claims to answer heartbeats, but never answers anything.
+	plugs["deaf"] = func() {
+		fakePlug(func(host *messages.Hello) *messages.Hello {
+			hello := plugHello(host)
+			hello.Features = append(hello.Features, messages.FeatureHeartbeat)
+			return hello
+		}, nil)
+	}
+}
+
+func TestPing(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	rtt, err := c.Ping(context.Background())
+	if err != nil || rtt <= 0 {
+		t.Fatalf("Ping() = %s, %v", rtt, err)
+	}
+	if h := c.Health(); !h.Alive || h.RTT != rtt || h.Misses != 0 || h.LastSeen.IsZero() {
+		t.Errorf("Health() = %+v after a ping of %s", h, rtt)
+	}
+}
+
+func TestPingUnsupported(t *testing.T) {
+	c := startEcho(t, "reorder", nil)
+	if _, err := c.Ping(context.Background()); !errors.Is(err, client.ErrHeartbeatUnsupported) {
+		t.Errorf("Ping() = %v, want client.ErrHeartbeatUnsupported", err)
+	}
+}
+
+func TestHeartbeatDuringSlowCommand(t *testing.T) {
+	c := startEcho(t, "echo", func(c *client.SmartPlugClient) { c.SetHeartbeat(20*time.Millisecond, 2) })
+
+	// The plug answers heartbeats while its handler runs.
+	if _, got, err := echo(context.Background(), c, "sleep", "300"); err != nil || got != "300" {
+		t.Errorf("sleep = %q, %v", got, err)
+	}
+	if h := c.Health(); !h.Alive || h.RTT <= 0 {
+		t.Errorf("Health() = %+v, want an alive plug answering heartbeats", h)
+	}
+}
+
+func TestHeartbeatUnresponsive(t *testing.T) {
+	c := startEcho(t, "deaf", func(c *client.SmartPlugClient) { c.SetHeartbeat(20*time.Millisecond, 2) })
+
+	if _, _, err := echo(context.Background(), c, "echo", "anyone?"); !errors.Is(err, client.ErrPlugUnresponsive) {
+		t.Errorf("command = %v, want client.ErrPlugUnresponsive", err)
+	}
+	select {
+	case <-c.Exited():
+	case <-time.After(5 * time.Second):
+		t.Fatal("unresponsive plug was not killed")
+	}
+	if h := c.Health(); h.Alive || h.Misses < 2 {
+		t.Errorf("Health() = %+v, want a dead plug with 2 misses", h)
+	}
+}
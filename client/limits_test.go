@@ -0,0 +1,53 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestDecoderLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits messages.DecoderLimits
+		limit  string
+	}{
+		{"message size", messages.DecoderLimits{MaxMessageSize: 1024}, "message size"},
+		{"string length", messages.DecoderLimits{MaxStringLength: 512}, "string length"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startEcho(t, "echo", func(c *client.SmartPlugClient) { c.SetDecoderLimits(tt.limits) })
+
+			// Small results pass.
+			if _, got, err := echo(context.Background(), c, "echo", "small"); err != nil || got != "small" {
+				t.Fatalf("small result = %q, %v", got, err)
+			}
+			// The plug answers with its input, exceeding the limits of the host.
+			reason, _, err := echo(context.Background(), c, "echo", strings.Repeat("x", 4096))
+			var limitErr *messages.LimitError
+			if reason != codes.DataFormatError || !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Fatalf("oversized result = %v, %v, want %v and a %s *messages.LimitError", reason, err, codes.DataFormatError, tt.limit)
+			}
+
+			// The stream cannot be read any further, so the plug is killed.
+			select {
+			case <-c.Exited():
+			case <-time.After(5 * time.Second):
+				t.Fatal("plug not killed after its message was rejected")
+			}
+			if _, _, err := echo(context.Background(), c, "echo", "small"); !errors.Is(err, messages.ErrLimitExceeded) {
+				t.Errorf("command after the rejection = %v, want messages.ErrLimitExceeded", err)
+			}
+		})
+	}
+}
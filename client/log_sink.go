@@ -0,0 +1,144 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Names of the plug output streams reported in LogLine.Stream.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// LogLine is a single line of output written by a plug process.
+//
+// Stdout lines are only captured when the protocol runs over dedicated pipes
+// (see messages.FeatureFDTransport); otherwise stdout carries the protocol itself.
+type LogLine struct {
+	Plug   string         // plug name from its Hello, or the command name before the handshake
+	PID    int            // plug process ID
+	Stream string         // StreamStdout or StreamStderr
+	Text   string         // the line, without the trailing newline
+	Fields map[string]any // the decoded line, if the plug wrote a JSON object
+}
+
+// LogSink receives the output of a plug process, line by line.
+//
+// It is called from a separate goroutine per stream, so it must be safe for concurrent use.
+type LogSink func(LogLine)
+
+// SlogSink returns a LogSink that forwards plug output to logger.
+//
+// Every record carries the plug name, its PID and the stream. Plain lines are logged at
+// Info level for stdout and Warn level for stderr. JSON lines, e.g. from a plug using
+// slog.NewJSONHandler, keep their message, level and attributes.
+func SlogSink(logger *slog.Logger) LogSink {
+	return func(line LogLine) {
+		level := slog.LevelInfo
+		if line.Stream == StreamStderr {
+			level = slog.LevelWarn
+		}
+		msg := line.Text
+		attrs := []slog.Attr{
+			slog.String("plug", line.Plug),
+			slog.Int("pid", line.PID),
+			slog.String("stream", line.Stream),
+		}
+
+		if line.Fields != nil {
+			for k, v := range line.Fields {
+				switch k {
+				case slog.MessageKey:
+					if s, ok := v.(string); ok {
+						msg = s
+						continue
+					}
+				case slog.LevelKey:
+					if s, ok := v.(string); ok && level.UnmarshalText([]byte(s)) == nil {
+						continue
+					}
+				case slog.TimeKey:
+					continue
+				}
+				attrs = append(attrs, slog.Any(k, v))
+			}
+		}
+
+		logger.LogAttrs(context.Background(), level, msg, attrs...)
+	}
+}
+
+// plugOutput captures the output streams of a plug process.
+type plugOutput struct {
+	sink LogSink
+	pid  int
+	wg   sync.WaitGroup
+
+	mu   sync.Mutex
+	name string
+}
+
+// setName sets the plug name reported with every line, e.g. once the handshake is done.
+func (o *plugOutput) setName(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.name = name
+}
+
+// capture reads a plug output stream until it ends, and closes it.
+// Without a sink, the output is copied to the host's stderr.
+func (o *plugOutput) capture(stream string, r io.Reader, c io.Closer) {
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		defer func() { _ = c.Close() }()
+
+		if o.sink == nil {
+			_, _ = io.Copy(os.Stderr, r)
+			return
+		}
+
+		br := bufio.NewReader(r)
+		for {
+			text, err := br.ReadString('\n')
+			if text != "" {
+				o.emit(stream, strings.TrimRight(text, "\r\n"))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// emit passes a single line to the sink.
+func (o *plugOutput) emit(stream, text string) {
+	o.mu.Lock()
+	name := o.name
+	o.mu.Unlock()
+
+	line := LogLine{Plug: name, PID: o.pid, Stream: stream, Text: text}
+	if trimmed := bytes.TrimSpace([]byte(text)); len(trimmed) > 0 && trimmed[0] == '{' {
+		var fields map[string]any
+		if json.Unmarshal(trimmed, &fields) == nil {
+			line.Fields = fields
+		}
+	}
+	o.sink(line)
+}
+
+// wait waits until every captured stream has ended.
+func (o *plugOutput) wait() {
+	o.wg.Wait()
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/client"
+)
+
+func TestLogSink(t *testing.T) {
+	var out lines
+	c := startEcho(t, "echo", func(c *client.SmartPlugClient) { c.SetLogSink(out.sink) })
+	record := `{"msg":"disk full","level":"ERROR","device":"sda"}`
+	if _, _, err := echo(context.Background(), c, "print", record); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	line, ok := out.find(client.StreamStderr, record)
+	if !ok {
+		t.Fatalf("stderr line not captured, got %+v", out.all)
+	}
+	if line.Plug != "echo" || line.PID <= 0 {
+		t.Errorf("line from plug %q, PID %d, want plug echo and its PID", line.Plug, line.PID)
+	}
+	if line.Fields["device"] != "sda" {
+		t.Errorf("JSON line decoded into %v", line.Fields)
+	}
+}
+
+func TestSlogSink(t *testing.T) {
+	var b bytes.Buffer
+	sink := client.SlogSink(slog.New(slog.NewJSONHandler(&b, nil)))
+	sink(client.LogLine{Plug: "p", PID: 7, Stream: client.StreamStdout, Text: "plain"})
+	sink(client.LogLine{
+		Plug:   "p",
+		PID:    7,
+		Stream: client.StreamStderr,
+		Text:   `{"msg":"disk full","level":"ERROR","device":"sda"}`,
+		Fields: map[string]any{"msg": "disk full", "level": "ERROR", "device": "sda"},
+	})
+
+	dec := json.NewDecoder(&b)
+	want := []map[string]any{
+		{"level": "INFO", "msg": "plain", "plug": "p", "pid": 7.0, "stream": "stdout"},
+		{"level": "ERROR", "msg": "disk full", "plug": "p", "pid": 7.0, "stream": "stderr", "device": "sda"},
+	}
+	for _, w := range want {
+		var got map[string]any
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range w {
+			if got[k] != v {
+				t.Errorf("record %v: %s = %v, want %v", got, k, got[k], v)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+)
+
+// records is a slog.Handler collecting the records logged by the library.
+type records struct {
+	mu    *sync.Mutex
+	all   *[]slog.Record
+	attrs []slog.Attr
+}
+
+func newRecords() records {
+	return records{mu: &sync.Mutex{}, all: &[]slog.Record{}}
+}
+
+func (records) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h records) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.all = append(*h.all, r)
+	return nil
+}
+
+func (h records) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return h
+}
+
+func (h records) WithGroup(string) slog.Handler { return h }
+
+// find returns the attributes of the first record with the given message and level.
+func (h records) find(level slog.Level, msg string) (map[string]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range *h.all {
+		if r.Message != msg || r.Level != level {
+			continue
+		}
+		attrs := make(map[string]string)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value.String()
+			return true
+		})
+		return attrs, true
+	}
+	return nil, false
+}
+
+func TestLogger(t *testing.T) {
+	log := newRecords()
+	c := startEcho(t, "echo", func(c *client.SmartPlugClient) { c.SetLogger(slog.New(log)) })
+	if _, _, err := echo(context.Background(), c, "echo", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if attrs, ok := log.find(slog.LevelDebug, "plug started"); !ok || attrs["plug"] != "echo" {
+		t.Errorf("plug start logged with %v, %v", attrs, ok)
+	}
+	if attrs, ok := log.find(slog.LevelDebug, "command answered"); !ok || attrs["type"] != "echo" || attrs["reply"] == "" {
+		t.Errorf("command logged with %v, %v", attrs, ok)
+	}
+}
+
+func TestLoggerHandshakeFailure(t *testing.T) {
+	log := newRecords()
+	c := client.NewSmartClient(plugCommand(t, "exits"))
+	c.SetLogger(slog.New(log))
+	c.SetHandshakeTimeout(time.Second)
+	if err := c.StartLocal(); err == nil {
+		t.Fatal("StartLocal succeeded with a process that is not a plug")
+	}
+	if _, ok := log.find(slog.LevelWarn, "plug handshake failed"); !ok {
+		t.Error("handshake failure not logged")
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/plug"
+)
+
+// plugEnv names the plug the test binary runs instead of the tests, see TestMain.
+const plugEnv = "PLUGKIT_TEST_PLUG"
+
+// plugs are the plugs used by the tests, by name. The test binary itself is the plug executable:
+// started with plugEnv set, it runs the plug of that name instead of the tests.
+var plugs = map[string]func(){
+	"echo":         func() { echoPlug(nil) },
+	"echo-oneshot": func() { echoPlug(func(p *plug.SmartPlug) { p.SetOneShot(true) }) },
+}
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(plugEnv); name != "" {
+		run, ok := plugs[name]
+		if !ok {
+			os.Exit(2)
+		}
+		run()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// plugCommand returns the command starting the named plug from plugs.
+func plugCommand(t *testing.T, name string) string {
+	t.Helper()
+	if _, ok := plugs[name]; !ok {
+		t.Fatalf("unknown test plug %q", name)
+	}
+	t.Setenv(plugEnv, name)
+	return os.Args[0]
+}
+
+// fakePlug speaks the PlugKit wire protocol by hand over stdin and stdout, so tests can
+// play a plug misbehaving in ways the plug package never does.
+//
+// It answers the host Hello with the one built by hello, then passes every message of the
+// host to serve until stdin is closed or the host ends the session. Messages are encoded
+// with the codec of the host Hello.
+func fakePlug(hello func(host *messages.Hello) *messages.Hello, serve func(p *fake, msg messages.Envelope)) {
+	p := newFake()
+	msg, ok := p.receive()
+	if !ok {
+		return
+	}
+	var host messages.Hello
+	if err := p.codec.Unmarshal(msg.Raw, &host); err != nil {
+		return
+	}
+	p.send(msg.ID, string(codes.HelloMessage), hello(&host))
+	for {
+		msg, ok := p.receive()
+		if !ok {
+			return
+		}
+		if msg.Type == string(codes.ExitMessage) {
+			p.send(msg.ID, string(codes.FinishMessage), &messages.PluginFinish{Reason: codes.OperationSuccess})
+			return
+		}
+		if serve != nil {
+			serve(p, msg)
+		}
+	}
+}
+
+// fake is the plug side of fakePlug.
+type fake struct {
+	codec codec.Codec
+	enc   codec.Encoder
+	dec   codec.Decoder
+	ids   uint64
+}
+
+// newFake returns a fake plug talking to the host over stdin and stdout.
+func newFake() *fake {
+	c, ok := codec.ByName(os.Getenv(messages.CodecEnv))
+	if !ok {
+		c = codec.CBOR
+	}
+	dec, err := c.NewDecoder(os.Stdin, messages.DecoderLimits{})
+	if err != nil {
+		os.Exit(2)
+	}
+	return &fake{codec: c, enc: c.NewEncoder(os.Stdout), dec: dec}
+}
+
+// receive reads the next message of the host. It returns false once the host is gone.
+func (p *fake) receive() (messages.Envelope, bool) {
+	var msg messages.Envelope
+	err := p.dec.Decode(&msg)
+	return msg, err == nil
+}
+
+// send writes a message of the current protocol version to the host.
+func (p *fake) send(replyTo uint64, messageType string, v any) {
+	p.ids++
+	_ = p.enc.Encode(&messages.Envelope{
+		Version: messages.ProtocolVersion,
+		ID:      p.ids,
+		ReplyTo: replyTo,
+		Type:    messageType,
+		Raw:     codec.MustMarshal(p.codec, v),
+	})
+}
+
+// plugHello returns the Hello of a well-behaved session plug of the current protocol version.
+func plugHello(*messages.Hello) *messages.Hello {
+	return &messages.Hello{
+		ProtocolVersion:    messages.ProtocolVersion,
+		MinProtocolVersion: messages.MinProtocolVersion,
+		Name:               "fake",
+		Features:           []string{messages.FeatureSessions},
+	}
+}
+
+// text is the payload of the commands of the echo plug and of their results.
+type text struct {
+	Text string `cbor:"text"`
+}
+
+// echoPlug runs a SmartPlug answering "echo" with its input, after setup has configured it.
+// Its other commands trigger the various ways a handler may end, see the handlers below.
+func echoPlug(setup func(p *plug.SmartPlug)) {
+	p := plug.New()
+	p.SetName("echo")
+	p.SetMetadata(messages.Metadata{Version: "1.2.3", Author: "PlugKit"})
+	var cancellations atomic.Int64
+	plug.HandleSmartPlugMessage(p, "echo", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		return &messages.Result{Type: "echo", Value: in}, codes.OperationSuccess, nil
+	})
+	// wait blocks until the host abandons the command; cancellations counts how often it did.
+	plug.HandleSmartPlugMessageContext(p, "wait", func(ctx context.Context, in text) (*messages.Result, codes.PluginExitReason, error) {
+		<-ctx.Done()
+		cancellations.Add(1)
+		return &messages.Result{Type: "echo", Value: in}, codes.OperationCancelledByClient, nil
+	})
+	plug.HandleSmartPlugMessage(p, "cancellations", func(text) (*messages.Result, codes.PluginExitReason, error) {
+		return &messages.Result{Type: "echo", Value: text{strconv.FormatInt(cancellations.Load(), 10)}}, codes.OperationSuccess, nil
+	})
+	plug.HandleSmartPlugMessage(p, "fail", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		return nil, codes.DataFormatError, &plugkit.RemoteError{
+			Code:    codes.DataFormatError,
+			Message: in.Text,
+			Details: map[string]any{"field": "text"},
+		}
+	})
+	// exit answers with the exit reason of the number in its input.
+	plug.HandleSmartPlugMessage(p, "exit", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		return &messages.Result{Type: "echo", Value: in}, exitReason(in.Text), nil
+	})
+	// finish ends the session with the exit reason of the number in its input.
+	plug.HandleSmartPlugMessage(p, "finish", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		return nil, exitReason(in.Text), nil
+	})
+	// sleep takes the number of milliseconds in its input to answer, whatever happens.
+	plug.HandleSmartPlugMessage(p, "sleep", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		time.Sleep(time.Duration(exitReason(in.Text)) * time.Millisecond)
+		return &messages.Result{Type: "echo", Value: in}, codes.OperationSuccess, nil
+	})
+	// die exits the plug process with the exit code of the number in its input.
+	plug.HandleSmartPlugMessage(p, "die", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		os.Exit(int(exitReason(in.Text)))
+		return nil, codes.OperationSuccess, nil
+	})
+	plug.HandleSmartPlugMessage(p, "panic", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		panic(in.Text)
+	})
+	plug.HandleSmartPlugMessage(p, "print", func(in text) (*messages.Result, codes.PluginExitReason, error) {
+		fmt.Println(in.Text)
+		fmt.Fprintln(os.Stderr, in.Text)
+		return &messages.Result{Type: "echo", Value: in}, codes.OperationSuccess, nil
+	})
+	// length answers with the length of its input, through a typed handler.
+	plug.Handle(p, "length", func(_ context.Context, in text) (int, error) {
+		return len(in.Text), nil
+	})
+	// call calls the host service method named by its input, and answers with the result.
+	plug.HandleSmartPlugMessageContext(p, "call", func(ctx context.Context, in text) (*messages.Result, codes.PluginExitReason, error) {
+		var out text
+		if err := p.Host().Call(ctx, in.Text, text{"plug"}, &out); err != nil {
+			return nil, codes.OperationError, err
+		}
+		return &messages.Result{Type: "echo", Value: out}, codes.OperationSuccess, nil
+	})
+	if setup != nil {
+		setup(p)
+	}
+	if err := p.Main(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// exitReason parses the exit reason passed to the echo plug; empty means success.
+func exitReason(s string) codes.PluginExitReason {
+	n, _ := strconv.Atoi(s)
+	return codes.PluginExitReason(n)
+}
+
+// eventually waits up to five seconds for cond to hold.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startEcho starts the named variant of the echo plug, see echoPlug. The plug is stopped
+// when the test ends.
+func startEcho(t *testing.T, name string, setup func(c *client.SmartPlugClient)) *client.SmartPlugClient {
+	t.Helper()
+	c := client.NewSmartClient(plugCommand(t, name))
+	client.HandleMessage(c, "echo", func(in text) (text, error) { return in, nil })
+	if setup != nil {
+		setup(c)
+	}
+	if err := c.StartLocal(); err != nil {
+		t.Fatalf("StartLocal: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Stop() })
+	return c
+}
+
+// echo runs the named command of the echo plug with the given text.
+func echo(ctx context.Context, c *client.SmartPlugClient, command, s string) (codes.PluginExitReason, string, error) {
+	reason, res, err := c.RunCommandContext(ctx, codes.MessageCode(command), text{s})
+	out, _ := res.(text)
+	return reason, out.Text, err
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/client"
+)
+
+// lines collects the output of a plug, see client.LogSink.
+type lines struct {
+	mu  sync.Mutex
+	all []client.LogLine
+}
+
+func (l *lines) sink(line client.LogLine) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.all = append(l.all, line)
+}
+
+// find returns the first line of the given stream and text.
+func (l *lines) find(stream, text string) (client.LogLine, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.all {
+		if line.Stream == stream && line.Text == text {
+			return line, true
+		}
+	}
+	return client.LogLine{}, false
+}
+
+func TestPlugPrints(t *testing.T) {
+	var out lines
+	c := startEcho(t, "echo", func(c *client.SmartPlugClient) { c.SetLogSink(out.sink) })
+	if !c.PlugInfo().HasFeature("fdTransport") {
+		t.Fatal("plug did not move to the protocol pipes")
+	}
+
+	// Printing to stdout does not break the protocol.
+	for _, s := range []string{"first", "second"} {
+		if _, got, err := echo(context.Background(), c, "print", s); err != nil || got != s {
+			t.Fatalf("print %q = %q, %v", s, got, err)
+		}
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	for _, stream := range []string{client.StreamStdout, client.StreamStderr} {
+		for _, s := range []string{"first", "second"} {
+			if _, ok := out.find(stream, s); !ok {
+				t.Errorf("line %q of %s not captured, got %+v", s, stream, out.all)
+			}
+		}
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+// PoolClient is a client whose plug can be run as a member of a Pool,
+// i.e. a *SmartPlugClient or a *RawClient.
+type PoolClient interface {
+	StartLocalContext(ctx context.Context) error
+	RunCommandContext(ctx context.Context, name codes.MessageCode, v any) (codes.PluginExitReason, any, error)
+	Close(ctx context.Context) error
+	Exited() <-chan struct{}
+	Health() Health
+}
+
+// Balancing selects how a Pool spreads commands over its members.
+type Balancing int
+
+const (
+	// RoundRobin hands commands to the available members in turn.
+	RoundRobin Balancing = iota
+	// LeastBusy hands each command to the available member with the fewest commands in flight.
+	LeastBusy
+)
+
+// DefaultPoolIdleTimeout is how long a Pool member may stay idle by default, see Pool.SetIdleTimeout.
+const DefaultPoolIdleTimeout = time.Minute
+
+// ErrPoolClosed is returned for commands sent to a Pool that has been closed.
+var ErrPoolClosed = errors.New("plug pool is closed")
+
+// Pool runs several instances of the same plug and spreads commands over them.
+//
+// Members are created with the function passed to NewPool, so every member gets the same
+// handlers and settings. The pool keeps at least its minimum number of members running,
+// starts new ones while every member is busy, up to its maximum, and stops members that
+// stayed idle for the idle timeout. Members whose plug exits, e.g. after a crash or because
+// it is a one-shot plug, are replaced.
+//
+// A Pool is safe for concurrent use.
+type Pool struct {
+	newClient   func() PoolClient
+	min, max    int
+	concurrency int // commands in flight per member
+	balancing   Balancing
+	idleTimeout time.Duration
+	log         *slog.Logger
+
+	mu       sync.Mutex
+	members  []*poolMember
+	starting int           // members being started
+	next     int           // round-robin position
+	changed  chan struct{} // closed and replaced whenever a member becomes available
+	closed   bool
+	stop     chan struct{}
+}
+
+// poolMember is a single plug instance in a Pool.
+type poolMember struct {
+	client   PoolClient
+	busy     int
+	lastUsed time.Time
+	retired  bool
+}
+
+// available reports whether m can take another command, given the commands a member may run at once.
+func (m *poolMember) available(concurrency int) bool {
+	return m.busy < concurrency && m.client.Health().Alive
+}
+
+// NewPool returns a Pool of plugs created by newClient, running between minSize and maxSize
+// members. newClient must return a new, not yet started client on every call.
+// The members are started with Start.
+func NewPool(newClient func() PoolClient, minSize, maxSize int) *Pool {
+	maxSize = max(maxSize, minSize, 1)
+	return &Pool{
+		newClient:   newClient,
+		min:         max(minSize, 0),
+		max:         maxSize,
+		concurrency: 1,
+		idleTimeout: DefaultPoolIdleTimeout,
+		log:         discardLogger,
+		changed:     make(chan struct{}),
+		stop:        make(chan struct{}),
+	}
+}
+
+// SetBalancing selects how commands are spread over the members. The default is RoundRobin.
+func (p *Pool) SetBalancing(b Balancing) {
+	p.balancing = b
+}
+
+// SetMemberConcurrency sets how many commands a member may serve at once. The default is one,
+// so a member is only handed a command while it is idle. Must be called before Start.
+// SmartPlug members only serve that many commands in parallel if they allow as many with
+// SmartPlug.SetConcurrency; otherwise they process them sequentially.
+func (p *Pool) SetMemberConcurrency(n int) {
+	p.concurrency = max(n, 1)
+}
+
+// SetIdleTimeout sets how long a member may stay idle before it is stopped, as long as the
+// pool is above its minimum size. Zero means DefaultPoolIdleTimeout. Must be called before Start.
+func (p *Pool) SetIdleTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultPoolIdleTimeout
+	}
+	p.idleTimeout = timeout
+}
+
+// SetLogger sets the logger for members being started, replaced and stopped.
+// By default, nothing is logged.
+func (p *Pool) SetLogger(logger *slog.Logger) {
+	p.log = loggerOrDiscard(logger)
+}
+
+// Start starts the minimum number of members. If any of them cannot be started,
+// the pool is closed and the error is returned.
+func (p *Pool) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, p.min)
+	for i := range p.min {
+		p.mu.Lock()
+		p.starting++
+		p.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = p.grow(ctx, false)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		_ = p.Close(context.Background())
+		return err
+	}
+	go p.shrink()
+	return nil
+}
+
+// Size returns the number of running members.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.members)
+}
+
+// RunCommand sends a command to one of the members and waits for its response,
+// see SmartPlugClient.RunCommand.
+func (p *Pool) RunCommand(name codes.MessageCode, v any) (codes.PluginExitReason, any, error) {
+	return p.RunCommandContext(context.Background(), name, v)
+}
+
+// RunCommandContext is like RunCommand, but stops waiting when ctx ends, either for a member
+// to become available or for the response, see SmartPlugClient.RunCommandContext.
+func (p *Pool) RunCommandContext(ctx context.Context, name codes.MessageCode, v any) (codes.PluginExitReason, any, error) {
+	var res any
+	reason, err := p.use(ctx, func(c PoolClient) (reason codes.PluginExitReason, err error) {
+		reason, res, err = c.RunCommandContext(ctx, name, v)
+		return reason, err
+	})
+	return reason, res, err
+}
+
+// exchange sends a command to one of the members and returns its reply, see Call.
+func (p *Pool) exchange(ctx context.Context, name codes.MessageCode, v any) (commandReply, codes.PluginExitReason, error) {
+	var msg commandReply
+	reason, err := p.use(ctx, func(c PoolClient) (reason codes.PluginExitReason, err error) {
+		caller, ok := c.(Caller)
+		if !ok {
+			return codes.CommandInvokedCannotExecute, errNotACaller
+		}
+		msg, reason, err = caller.exchange(ctx, name, v)
+		return reason, err
+	})
+	return msg, reason, err
+}
+
+// use runs fn with an available member. If the member did not take the command,
+// e.g. a one-shot plug that already served one, fn is run again with another member.
+func (p *Pool) use(ctx context.Context, fn func(PoolClient) (codes.PluginExitReason, error)) (codes.PluginExitReason, error) {
+	for {
+		m, err := p.acquire(ctx)
+		if err != nil {
+			if reason, ok := contextReason(err); ok {
+				return reason, err
+			}
+			return codes.PlugNotStarted, err
+		}
+		reason, err := fn(m.client)
+		retire := errors.Is(err, ErrSessionClosed)
+		p.release(m, retire)
+		if !retire {
+			return reason, err
+		}
+	}
+}
+
+// Close stops every member with its Close method, letting them serve the commands in flight.
+func (p *Pool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stop)
+	members := p.members
+	p.members = nil
+	p.broadcast()
+	p.mu.Unlock()
+
+	errs := make([]error, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.client.Close(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// acquire picks a member for a command, starting a new one if every member is busy and
+// the pool may grow. Otherwise, it waits until a member becomes available or ctx ends.
+func (p *Pool) acquire(ctx context.Context) (*poolMember, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if m := p.pick(); m != nil {
+			m.busy++
+			p.mu.Unlock()
+			return m, nil
+		}
+		if len(p.members)+p.starting < p.max {
+			p.starting++
+			p.mu.Unlock()
+			return p.grow(ctx, true)
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pick returns an available member according to the balancing, or nil. p.mu must be held.
+// Members whose plug is gone are skipped, even before watch removed them.
+func (p *Pool) pick() *poolMember {
+	n := len(p.members)
+	if p.balancing == LeastBusy {
+		var best *poolMember
+		for _, m := range p.members {
+			if m.available(p.concurrency) && (best == nil || m.busy < best.busy) {
+				best = m
+			}
+		}
+		return best
+	}
+	for i := range n {
+		m := p.members[(p.next+i)%n]
+		if m.available(p.concurrency) {
+			p.next = (p.next + i + 1) % n
+			return m
+		}
+	}
+	return nil
+}
+
+// grow starts a new member, already counted in p.starting. If busy is set, the member is
+// returned with a command assigned to it.
+func (p *Pool) grow(ctx context.Context, busy bool) (*poolMember, error) {
+	c := p.newClient()
+	err := c.StartLocalContext(ctx)
+
+	p.mu.Lock()
+	p.starting--
+	if err != nil {
+		p.broadcast()
+		p.mu.Unlock()
+		p.log.LogAttrs(ctx, slog.LevelWarn, "starting pool member failed", slog.Any("error", err))
+		return nil, err
+	}
+	if p.closed {
+		p.mu.Unlock()
+		_ = c.Close(context.Background())
+		return nil, ErrPoolClosed
+	}
+	m := &poolMember{client: c, lastUsed: time.Now()}
+	if busy {
+		m.busy = 1
+	}
+	p.members = append(p.members, m)
+	size := len(p.members)
+	p.broadcast()
+	p.mu.Unlock()
+
+	p.log.LogAttrs(ctx, slog.LevelDebug, "pool member started", slog.Int("size", size))
+	go p.watch(m)
+	return m, nil
+}
+
+// release marks a command of m as done. A member that cannot take further commands
+// is removed from the pool.
+func (p *Pool) release(m *poolMember, retire bool) {
+	p.mu.Lock()
+	m.busy--
+	m.lastUsed = time.Now()
+	if retire {
+		p.remove(m)
+	}
+	p.broadcast()
+	p.mu.Unlock()
+	if retire {
+		p.replace(m, "pool member retired")
+	}
+}
+
+// watch waits for the plug of m to exit and replaces it.
+func (p *Pool) watch(m *poolMember) {
+	select {
+	case <-m.client.Exited():
+	case <-p.stop:
+		return
+	}
+	p.mu.Lock()
+	removed := p.remove(m)
+	p.broadcast()
+	p.mu.Unlock()
+	if removed {
+		p.replace(m, "pool member exited")
+	}
+}
+
+// replace stops a member removed from the pool, and starts new members if the pool
+// fell below its minimum size.
+func (p *Pool) replace(m *poolMember, msg string) {
+	go func() { _ = m.client.Close(context.Background()) }()
+
+	p.mu.Lock()
+	missing := 0
+	if !p.closed {
+		missing = p.min - len(p.members) - p.starting
+	}
+	p.starting += max(missing, 0)
+	size := len(p.members)
+	p.mu.Unlock()
+
+	p.log.LogAttrs(context.Background(), slog.LevelInfo, msg, slog.Int("size", size))
+	for range missing {
+		go func() { _, _ = p.grow(context.Background(), false) }()
+	}
+}
+
+// remove removes m from the members and reports whether it was one. p.mu must be held.
+func (p *Pool) remove(m *poolMember) bool {
+	if m.retired {
+		return false
+	}
+	m.retired = true
+	for i, o := range p.members {
+		if o == m {
+			p.members = append(p.members[:i], p.members[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// broadcast wakes up the commands waiting for a member. p.mu must be held.
+func (p *Pool) broadcast() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// shrink stops members that stayed idle for the idle timeout, as long as the pool
+// is above its minimum size.
+func (p *Pool) shrink() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var idle []*poolMember
+		p.mu.Lock()
+		for _, m := range append([]*poolMember(nil), p.members...) {
+			if len(p.members) <= p.min {
+				break
+			}
+			if m.busy == 0 && time.Since(m.lastUsed) >= p.idleTimeout {
+				p.remove(m)
+				idle = append(idle, m)
+			}
+		}
+		p.mu.Unlock()
+
+		for _, m := range idle {
+			p.log.LogAttrs(context.Background(), slog.LevelDebug, "idle pool member stopped")
+			go func() { _ = m.client.Close(context.Background()) }()
+		}
+	}
+}
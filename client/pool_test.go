@@ -0,0 +1,150 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+// startPool starts a pool of the named variant of the echo plug, after setup has configured it.
+// The pool is closed when the test ends.
+func startPool(t *testing.T, name string, minSize, maxSize int, setup func(p *client.Pool)) *client.Pool {
+	t.Helper()
+	command := plugCommand(t, name)
+	p := client.NewPool(func() client.PoolClient {
+		c := client.NewSmartClient(command)
+		client.HandleMessage(c, "echo", func(in text) (text, error) { return in, nil })
+		return c
+	}, minSize, maxSize)
+	if setup != nil {
+		setup(p)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Close(context.Background()) })
+	return p
+}
+
+// poolEcho runs the named command of the echo plug on one of the members of p.
+func poolEcho(p *client.Pool, command, s string) (string, error) {
+	_, res, err := p.RunCommand(codes.MessageCode(command), text{s})
+	out, _ := res.(text)
+	return out.Text, err
+}
+
+func TestPoolGrows(t *testing.T) {
+	p := startPool(t, "echo", 1, 3, nil)
+	if p.Size() != 1 {
+		t.Fatalf("Size() = %d after Start, want 1", p.Size())
+	}
+
+	// The members serve one command at a time, so three slow commands need three members.
+	started := time.Now()
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := poolEcho(p, "sleep", "300"); err != nil || got != "300" {
+				t.Errorf("sleep = %q, %v", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if p.Size() != 3 {
+		t.Errorf("Size() = %d, want 3", p.Size())
+	}
+	if elapsed := time.Since(started); elapsed >= 900*time.Millisecond {
+		t.Errorf("commands took %s, so they did not run in parallel", elapsed)
+	}
+}
+
+func TestPoolWaitsAtMaximum(t *testing.T) {
+	p := startPool(t, "echo", 1, 1, nil)
+
+	go func() { _, _ = poolEcho(p, "sleep", "300") }()
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.RunCommandContext(ctx, "echo", text{"x"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("command while the only member is busy = %v, want context.DeadlineExceeded", err)
+	}
+	if got, err := poolEcho(p, "echo", "x"); err != nil || got != "x" {
+		t.Errorf("command once the member is free = %q, %v", got, err)
+	}
+}
+
+func TestPoolShrinks(t *testing.T) {
+	p := startPool(t, "echo", 1, 3, func(p *client.Pool) { p.SetIdleTimeout(50 * time.Millisecond) })
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = poolEcho(p, "sleep", "100")
+		}()
+	}
+	wg.Wait()
+	eventually(t, "idle members to stop", func() bool { return p.Size() == 1 })
+}
+
+func TestPoolReplacesExitedMembers(t *testing.T) {
+	p := startPool(t, "echo", 2, 2, nil)
+
+	_, _ = poolEcho(p, "die", "1")
+	eventually(t, "the member to be replaced", func() bool { return p.Size() == 2 })
+	for i := range 4 {
+		want := fmt.Sprint(i)
+		if got, err := poolEcho(p, "echo", want); err != nil || got != want {
+			t.Errorf("command %d = %q, %v", i, got, err)
+		}
+	}
+}
+
+func TestPoolOneShotMembers(t *testing.T) {
+	p := startPool(t, "echo-oneshot", 1, 2, nil)
+
+	// Every one-shot member serves a single command, and is replaced after it.
+	for i := range 5 {
+		want := fmt.Sprint(i)
+		if got, err := poolEcho(p, "echo", want); err != nil || got != want {
+			t.Errorf("command %d = %q, %v", i, got, err)
+		}
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	p := startPool(t, "echo", 1, 1, nil)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poolEcho(p, "echo", "x"); !errors.Is(err, client.ErrPoolClosed) {
+		t.Errorf("command after Close = %v, want client.ErrPoolClosed", err)
+	}
+	if p.Size() != 0 {
+		t.Errorf("Size() = %d after Close", p.Size())
+	}
+}
+
+func TestPoolStartFails(t *testing.T) {
+	command := plugCommand(t, "exits")
+	p := client.NewPool(func() client.PoolClient {
+		c := client.NewSmartClient(command)
+		c.SetHandshakeTimeout(time.Second)
+		return c
+	}, 2, 2)
+	if err := p.Start(context.Background()); !errors.Is(err, client.ErrNotAPlug) {
+		t.Errorf("Start() = %v, want client.ErrNotAPlug", err)
+	}
+}
@@ -7,19 +7,21 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"os/exec"
 
-	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit"
 	"github.com/mjwhodur/plugkit/codes"
-	"github.com/mjwhodur/plugkit/helpers"
 	"github.com/mjwhodur/plugkit/messages"
 )
 
 // RawClientImpl defines the interface that must be implemented by users of RawClient.
 // It is responsible for handling incoming messages manually.
+//
+// Handle is called from the goroutine that called RunCommand, so it must be safe for
+// concurrent use if RunCommand is. The payload is passed on as the plug encoded it, with the
+// codec of the session (see RawClient.Codec).
 type RawClientImpl interface {
 	Handle(responseType string, payload []byte)
 }
@@ -31,47 +33,35 @@ type RawClientImpl interface {
 // This enables advanced use cases or full control over the plugin protocol.
 //
 // Communication occurs over CBOR-encoded envelopes using stdin and stdout pipes.
+// Once started, RunCommand is safe for concurrent use; responses are routed to
+// their callers by request ID.
 type RawClient struct {
-	encoder *cbor.Encoder
-	decoder *cbor.Decoder
-	command string
+	common
 	Impl    RawClientImpl
 	isReady bool
+	calls   callHandlers
 }
 
 // StartLocal starts the plugin process using the configured command.
 //
-// It establishes CBOR-based communication over stdin/stdout pipes.
+// It establishes CBOR-based communication over stdin/stdout pipes and performs the
+// hello exchange with the plug. A *HandshakeError is returned when the process is not
+// a PlugKit plug or speaks an incompatible protocol.
 // The method must be called before sending any commands to the plugin.
 func (c *RawClient) StartLocal() error {
-	if c.command == "" {
-		return errors.New("command executable is required")
-	}
-
-	cmd := exec.Command(c.command) // #nosec G204
-	stdin, err := cmd.StdinPipe()
+	return c.StartLocalContext(context.Background())
+}
 
+// StartLocalContext is like StartLocal, but gives up waiting for the plug's hello when ctx ends.
+// The plug process is killed in that case. Once started, the plug outlives ctx.
+func (c *RawClient) StartLocalContext(ctx context.Context) error {
+	conn, info, err := c.dial(ctx, nil)
 	if err != nil {
 		return err
 	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-
-	if e := cmd.Start(); e != nil {
-		return e
-	}
-
-	c.encoder = cbor.NewEncoder(stdin)
-	c.decoder = cbor.NewDecoder(stdout)
-
-	if c.decoder == nil {
-		return errors.New("failed to create decoder")
-	}
-	if c.encoder == nil {
-		return errors.New("failed to create encoder")
-	}
+	conn.start(nil, c.calls.serve)
+	c.conn.Store(conn)
+	c.plugInfo = info
 
 	return nil
 }
@@ -87,52 +77,44 @@ func (c *RawClient) StartLocal() error {
 // and the corresponding handler executes successfully, its return value is passed back to the caller.
 //
 // If no matching handler is found or the handler fails, the returned result will be nil.
+// The returned PluginExitReason is the one reported by the plug handler. If the plug handler
+// failed, a *plugkit.RemoteError carrying its exit reason and message is returned as the error.
+// A response that cannot be decoded is reported as codes.PluginToHostCommunicationError.
 // In general, it's recommended that plugins return a single, well-defined response type,
 // or exit with an appropriate error code when things go wrong. Supporting multiple possible
 // response types is possible, but may require custom decoding logic on the client side.
 func (c *RawClient) RunCommand(name codes.MessageCode, v any) (codes.PluginExitReason, any, error) {
-	if !c.isReady {
+	return c.RunCommandContext(context.Background(), name, v)
+}
+
+// RunCommandContext is like RunCommand, but stops waiting for the response when ctx ends.
+//
+// In that case codes.OperationTimeout (deadline exceeded) or codes.OperationCancelledByClient
+// (cancelled) is returned together with ctx.Err(), and the plug is told with codes.CancelMessage
+// that the request was abandoned.
+func (c *RawClient) RunCommandContext(ctx context.Context, name codes.MessageCode, v any) (codes.PluginExitReason, any, error) {
+	conn := c.conn.Load()
+	if !c.isReady || conn == nil {
 		return codes.PlugNotStarted, nil, errors.New("client is not ready")
 	}
-	err := c.encoder.Encode(&messages.Envelope{
-		Version: 0,
-		Type:    string(name),
-		Raw:     helpers.MustRaw(v),
-	})
+	envelope, reason, err := conn.command(ctx, name, v)
 	if err != nil {
-		return codes.PlugCrashed, nil, err
-	}
-	var envelope messages.Envelope
-	if err := c.decoder.Decode(&envelope); err != nil {
-		if err == io.EOF {
-			return codes.PlugCrashed, nil, err
-		}
-		return codes.PluginToHostCommunicationError, nil, err
-	}
-	fmt.Println(envelope.Type)
-	if envelope.Type == string(codes.FinishMessage) {
-		var fin *messages.PluginFinish
-		err := cbor.Unmarshal(envelope.Raw, &fin)
-		if err != nil {
-			return codes.PluginToHostCommunicationError, nil, err
-		}
-		return fin.Reason, nil, errors.New(fin.Message)
-	}
-	if envelope.Type == string(codes.Unsupported) {
-		return codes.CommandInvokedCannotExecute, nil, errors.New("unsupported message type")
+		return reason, nil, err
 	}
 	if envelope.Type == string(codes.PluginResponse) {
-		var result messages.Result
+		var result messages.RawResult
 
-		if e := cbor.Unmarshal(envelope.Raw, &result); e != nil {
-			panic(e)
+		if e := conn.codec.Unmarshal(envelope.Raw, &result); e != nil {
+			return codes.PluginToHostCommunicationError, nil, fmt.Errorf("%s: %w: malformed response: %w", name, codes.PluginToHostCommunicationError, e)
+		}
+		if result.Error != nil {
+			return result.ExitCode, nil, plugkit.NewRemoteError(result.Error)
 		}
-		val, _ := cbor.Marshal(result.Value)
-		c.Impl.Handle(result.Type, val)
-		return codes.OperationSuccess, nil, nil
+		c.Impl.Handle(result.Type, result.Value)
+		return result.ExitCode, nil, nil
 	}
 
-	e := c.respond(codes.Unsupported, &messages.MessageUnsupported{})
+	e := c.respond(envelope.ID, codes.Unsupported, &messages.MessageUnsupported{})
 	if e != nil {
 		// FIXME: Maybe too vague?
 		return codes.PlugCrashed, nil, e
@@ -144,21 +126,57 @@ func (c *RawClient) RunCommand(name codes.MessageCode, v any) (codes.PluginExitR
 // respond sends a response message to the plugin using a predefined MessageCode.
 //
 // This helper wraps the provided payload into a PlugKit Envelope and sends it over stdout.
-func (c *RawClient) respond(messageCode codes.MessageCode, v any) error {
+// replyTo is the ID of the plug message being answered.
+func (c *RawClient) respond(replyTo uint64, messageCode codes.MessageCode, v any) error {
+	conn := c.conn.Load()
 	// FIXME: Lacking test?
-	err := c.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    string(messageCode),
-		Raw:     helpers.MustRaw(v),
-	})
-
+	_, err := conn.send(context.Background(), replyTo, string(messageCode), conn.raw(v))
 	return err
 }
 
-// SetCommand sets the executable path or name of the plugin binary.
-// This must be set before calling StartLocal().
-func (c *RawClient) SetCommand(command string) {
-	c.command = command
+// Stop ends the plug session and waits for the plug process to exit.
+// It is a shortcut for Close(context.Background()).
+//
+// After Stop, the plug has to be started again with StartLocal before sending further commands.
+func (c *RawClient) Stop() error {
+	return c.Close(context.Background())
+}
+
+// Close ends the plug session with codes.ExitMessage and shuts the plug process down.
+//
+// The plug serves the commands in flight and answers with a PluginFinish; Close waits for
+// it until ctx ends. Then the plug gets the grace periods set with SetShutdownGrace to exit,
+// before it is sent SIGTERM and finally SIGKILL. The plug process is always reaped.
+// Commands sent once Close has begun fail with ErrSessionClosed.
+func (c *RawClient) Close(ctx context.Context) error {
+	conn := c.conn.Load()
+	if conn == nil {
+		return nil
+	}
+	return conn.terminate(ctx, c.grace)
+}
+
+// exchange sends a command to the plug and returns its reply, see Call.
+func (c *RawClient) exchange(ctx context.Context, name codes.MessageCode, v any) (commandReply, codes.PluginExitReason, error) {
+	conn := c.conn.Load()
+	if !c.isReady || conn == nil {
+		return commandReply{}, codes.PlugNotStarted, errors.New("client is not ready")
+	}
+	msg, reason, err := conn.command(ctx, name, v)
+	return commandReply{Envelope: msg, codec: conn.codec}, reason, err
+}
+
+// HandleCall registers a handler for calls the plug makes to the host service method,
+// see plug.Host.Call. Calls are served while the host waits for the plug, e.g. in RunCommand.
+//
+// Like with HandleMessageType, the handler receives the decoded argument, and can be
+// built from a typed function with helpers.WrapHandler. Its result is sent back to the plug;
+// an error is reported to the plug as a *messages.Error. Must be called before StartLocal.
+func (c *RawClient) HandleCall(method string, handler func(any) (any, error)) {
+	if c.calls == nil {
+		c.calls = make(callHandlers)
+	}
+	c.calls[method] = handler
 }
 
 // NewRawClient returns plugin with impl implementation
@@ -166,8 +184,16 @@ func NewRawClient(name string, impl RawClientImpl) *RawClient {
 	isReady := name != ""
 
 	return &RawClient{
+		common:  common{command: name},
 		isReady: isReady,
-		command: name,
 		Impl:    impl,
 	}
 }
+
+func (c *RawClient) spawn(ctx context.Context) error {
+	return c.StartLocalContext(ctx)
+}
+
+func (c *RawClient) halt() error {
+	return c.Stop()
+}
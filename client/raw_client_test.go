@@ -0,0 +1,65 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/plug"
+)
+
+func init() {
+	plugs["raw-echo"] = func() {
+		if err := plug.NewRawPlug(rawEcho{}).Main(); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// rawEcho is a raw plug answering its command with the command type and payload.
+type rawEcho struct{}
+
+func (rawEcho) Mount(*plug.RawPlug) {}
+
+func (rawEcho) Handle(kind string, payload messages.RawMessage) (string, messages.RawMessage, error) {
+	return kind, payload, nil
+}
+
+// rawResponse records the response a RawClient received.
+type rawResponse struct {
+	kind    string
+	payload []byte
+}
+
+func (r *rawResponse) Handle(kind string, payload []byte) {
+	r.kind, r.payload = kind, payload
+}
+
+func TestRawClientCodecs(t *testing.T) {
+	for _, cd := range []codec.Codec{codec.CBOR, codec.JSON, codec.MsgPack} {
+		t.Run(cd.Name(), func(t *testing.T) {
+			res := &rawResponse{}
+			c := client.NewRawClient(plugCommand(t, "raw-echo"), res)
+			c.SetCodec(cd)
+			if err := c.StartLocal(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = c.Stop() })
+
+			if _, _, err := c.RunCommandContext(context.Background(), "echo", text{"hi"}); err != nil {
+				t.Fatal(err)
+			}
+			// The payload is handed over in the codec of the session.
+			var got text
+			if err := cd.Unmarshal(res.payload, &got); err != nil || res.kind != "echo" || got.Text != "hi" {
+				t.Errorf("response %q = %q (%v), want echo of %q", res.kind, res.payload, err, "hi")
+			}
+		})
+	}
+}
@@ -7,25 +7,27 @@ package client
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"os"
-	"os/exec"
+	"log/slog"
 	"sync"
-	"syscall"
+	"sync/atomic"
 
-	"github.com/fxamacker/cbor/v2"
 	"github.com/mjwhodur/plugkit/messages"
 )
 
 // RawStreamClientImpl must be implemented by consumers of RawStreamClient.
 // It defines the logic for handling incoming messages and sending responses.
 //
-// - Handle is invoked for each incoming message and must return the message type and CBOR payload of the response.
+// - Handle is invoked for each incoming message. id is the ID the plug assigned to the message,
+// and replyTo is the ID of the host message it answers (zero if it answers nothing).
+// Responses are sent with RawStreamClient.SendContext or RawStreamClient.ReplyContext. Calls the plug makes
+// to host services (codes.CallMessage) arrive here too, and are answered with a
+// messages.CallResult sent as codes.CallResultMessage.
 // - Mount is called before the communication loop starts.
 // - CloseSignal is triggered when the stream is closing.
+//
+// Payloads are encoded with the codec of the session, see RawStreamClient.Codec.
 type RawStreamClientImpl interface {
-	Handle(kind string, payload *cbor.RawMessage)
+	Handle(kind string, payload *messages.RawMessage, id, replyTo uint64)
 	Mount(c *RawStreamClient)
 	CloseSignal()
 }
@@ -33,20 +35,22 @@ type RawStreamClientImpl interface {
 // RawStreamClient provides a streaming PlugKit host implementation.
 //
 // It launches the plugin process and maintains an open communication loop,
-// continuously decoding incoming CBOR messages and dispatching them to the provided handler.
+// continuously decoding incoming messages and dispatching them to the provided handler.
 //
 // This structure is well-suited for long-running plugins with complex protocols or event-based logic.
+// Answers from the plug, e.g. to Describe and Ping, are read by Run, so they must be called
+// while Run is running.
 type RawStreamClient struct {
-	Impl    RawStreamClientImpl
-	encoder *cbor.Encoder
-	decoder *cbor.Decoder
-	command string
-	wg      *sync.WaitGroup
-	ctx     context.Context
-	cancel  context.CancelFunc
-	msgs    chan messages.Envelope
-	plug    *exec.Cmd
-	sig     chan struct{}
+	common
+	Impl   RawStreamClientImpl
+	wg     *sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	running    atomic.Bool // the communication loop is running
+	stopped    atomic.Bool // Stop was called
+	supervised atomic.Bool // the plug is restarted by a Supervisor
+	closing    atomic.Bool // Close shuts the plug down
 }
 
 // NewRawStreamClient constructs a new RawStreamClient with the given handler implementation.
@@ -54,61 +58,57 @@ type RawStreamClient struct {
 // The plugin process is not started automatically — use Start() and then Run() to begin communication.
 func NewRawStreamClient(impl RawStreamClientImpl, command string) *RawStreamClient {
 	return &RawStreamClient{
-		Impl:    impl,
-		command: command,
+		common: common{command: command},
+		Impl:   impl,
 	}
 }
 
 // Start initializes and starts the plugin process using the configured command.
 //
-// It sets up CBOR encoders and decoders for stdin/stdout communication.
+// It sets up CBOR encoders and decoders for stdin/stdout communication and performs
+// the hello exchange with the plug. A *HandshakeError is returned when the process is
+// not a PlugKit plug or speaks an incompatible protocol.
 // Must be called before Run().
 func (c *RawStreamClient) Start() error {
-	if c.command == "" {
-		return errors.New("command executable is required")
-	}
-	c.msgs = make(chan messages.Envelope, 1)
-	c.sig = make(chan struct{}, 1)
-	cmd := exec.Command(c.command) // #nosec G204
-	c.plug = cmd
-	stdin, err := cmd.StdinPipe()
+	return c.StartContext(context.Background())
+}
 
+// StartContext is like Start, but gives up waiting for the plug's hello when ctx ends.
+// The plug process is killed in that case. Once started, the plug outlives ctx.
+func (c *RawStreamClient) StartContext(ctx context.Context) error {
+	conn, info, err := c.dial(ctx, nil)
 	if err != nil {
 		return err
 	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
+	c.conn.Store(conn)
+	c.plugInfo = info
 
-	if e := cmd.Start(); e != nil {
-		return e
-	}
-
-	c.encoder = cbor.NewEncoder(stdin)
-	c.decoder = cbor.NewDecoder(stdout)
-
-	if c.decoder == nil {
-		return errors.New("failed to create decoder")
-	}
-	if c.encoder == nil {
-		return errors.New("failed to create encoder")
-	}
 	c.wg = &sync.WaitGroup{}
 	return nil
 }
 
 // Run begins the main communication loop with the plugin.
 //
-// This method blocks until Stop() is called or the stream ends. It spawns a background loop
-// to decode messages and invokes the handler logic for each received message.
+// This method blocks until Stop() is called or the stream ends. It starts decoding messages
+// from the plug in the background and invokes the handler logic for each received message.
+// If Stop was called before, Run shuts the plug down and returns right away.
 func (c *RawStreamClient) Run() {
+	c.RunContext(context.Background())
+}
+
+// RunContext is like Run, but also stops the communication loop when ctx ends.
+func (c *RawStreamClient) RunContext(ctx context.Context) {
 	c.Impl.Mount(c)
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	c.ctx = ctx
 	c.cancel = cancel
 
 	c.wg.Add(1)
+	c.running.Store(true)
+	if c.stopped.Load() {
+		cancel()
+	}
+	c.conn.Load().start(c.dispatch, nil)
 	go c.loop()
 	c.wg.Wait()
 }
@@ -116,59 +116,62 @@ func (c *RawStreamClient) Run() {
 // Stop signals the RawStreamClient to stop receiving messages.
 //
 // It cancels the internal context and allows the loop to exit gracefully.
+// The plug is then shut down in the background, as with Close. Stop may be called before Run,
+// which then returns right away.
 func (c *RawStreamClient) Stop() {
-	// FIXME: Drut! But why?
-	if c.cancel != nil {
+	c.stopped.Store(true)
+	// Run checks stopped after setting running, so either of them cancels the loop.
+	if c.running.Load() {
 		c.cancel()
-	} else {
-		c.sig <- struct{}{}
 	}
 }
 
-// loop is the internal message receive loop.
-//
-// It continuously decodes CBOR messages from the plugin and dispatches them
-// via the Wrapper for asynchronous handling.
+// loop waits until the stream is stopped by the host or closed by the plug,
+// and then shuts the plug down, see Close. A supervised plug may be restarted after
+// closing the stream, so only the host stops the loop.
 func (c *RawStreamClient) loop() {
-loop:
-	for {
-		msgCh := make(chan messages.Envelope)
-		errCh := make(chan error)
-
-		go func() {
-			var msg messages.Envelope
-			err := c.decoder.Decode(&msg)
-			if err != nil {
-				errCh <- err
-				return
-			}
-			msgCh <- msg
-		}()
-
-		select {
-		case <-c.ctx.Done():
-			c.Impl.CloseSignal()
-			c.wg.Done()
-			break loop
-		case <-c.sig:
-			// FIXME: HACK!
-			c.Impl.CloseSignal()
-			c.wg.Done()
-			break loop
-		case <-errCh:
-			c.wg.Done()
-			break loop
-
-		case msg := <-msgCh:
-
-			c.wg.Add(1)
-			go c.Wrapper(msg)
-		}
+	var ended <-chan struct{}
+	if !c.supervised.Load() {
+		ended = c.conn.Load().done
 	}
-	err := c.plug.Process.Signal(os.Signal(syscall.SIGINT))
-	if err != nil {
-		fmt.Println(err)
+	select {
+	case <-c.ctx.Done():
+		c.Impl.CloseSignal()
+	case <-ended:
+	}
+	c.wg.Done()
+
+	if c.closing.Load() {
+		return
+	}
+	conn := c.conn.Load()
+	if err := conn.terminate(context.Background(), c.grace); err != nil {
+		conn.log.LogAttrs(context.Background(), slog.LevelWarn, "closing plug failed", slog.Any("error", err))
+	}
+}
+
+// Close stops the communication loop, if it is running, ends the plug session with
+// codes.ExitMessage and shuts the plug process down.
+//
+// The plug serves the messages in flight and answers with a PluginFinish; Close waits for
+// it until ctx ends. Then the plug gets the grace periods set with SetShutdownGrace to exit,
+// before it is sent SIGTERM and finally SIGKILL. The plug process is always reaped.
+func (c *RawStreamClient) Close(ctx context.Context) error {
+	c.closing.Store(true)
+	if c.running.Load() {
+		c.Stop()
 	}
+	conn := c.conn.Load()
+	if conn == nil {
+		return nil
+	}
+	return conn.terminate(ctx, c.grace)
+}
+
+// dispatch hands a message received from the plug over to the Wrapper for asynchronous handling.
+func (c *RawStreamClient) dispatch(msg messages.Envelope) {
+	c.wg.Add(1)
+	go c.Wrapper(msg)
 }
 
 // Wrapper wraps a single message and processes it via the implementation's Handle method.
@@ -176,31 +179,76 @@ loop:
 // It constructs a response and sends it back to the plugin.
 // This function is run as a goroutine for each message.
 func (c *RawStreamClient) Wrapper(msg messages.Envelope) {
-	c.Impl.Handle(msg.Type, &msg.Raw)
+	c.Impl.Handle(msg.Type, &msg.Raw, msg.ID, msg.ReplyTo)
 	c.wg.Done()
 }
 
-// Send sends a response message back to the plugin.
+// Send is like SendContext with context.Background(). A message that cannot be written,
+// e.g. because the plug exited, is only logged, see SetLogger.
+//
+// Deprecated: Use SendContext, which returns the error.
+func (c *RawStreamClient) Send(messageCode string, payload messages.RawMessage) uint64 {
+	return c.Reply(0, messageCode, payload)
+}
+
+// Reply is like ReplyContext with context.Background(). A message that cannot be written,
+// e.g. because the plug exited, is only logged, see SetLogger.
+//
+// Deprecated: Use ReplyContext, which returns the error.
+func (c *RawStreamClient) Reply(replyTo uint64, messageCode string, payload messages.RawMessage) uint64 {
+	id, err := c.ReplyContext(context.Background(), replyTo, messageCode, payload)
+	if err != nil {
+		loggerOrDiscard(c.logger).LogAttrs(context.Background(), slog.LevelWarn, "sending message failed",
+			slog.String("type", messageCode), slog.Uint64("id", id), slog.Any("error", err))
+	}
+	return id
+}
+
+// SendContext sends a message to the plugin and returns the ID assigned to it.
 //
-// The message type and CBOR payload must be specified explicitly.
-func (c *RawStreamClient) Send(messageCode string, payload cbor.RawMessage) {
-	err := c.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    messageCode,
-		Raw:     payload,
-	})
+// The message type and payload, encoded with the codec of the session (see Codec),
+// must be specified explicitly.
+// The plug receives the returned ID and can refer to it when answering. SendContext gives up
+// with ctx.Err() if ctx ends while the message waits for other writers.
+func (c *RawStreamClient) SendContext(ctx context.Context, messageCode string, payload messages.RawMessage) (uint64, error) {
+	return c.ReplyContext(ctx, 0, messageCode, payload)
+}
+
+// ReplyContext sends a response to the plug message with the given ID and returns the ID
+// assigned to the response. It gives up with ctx.Err() if ctx ends while the message waits
+// for other writers.
+//
+// SendContext and ReplyContext are safe for concurrent use.
+func (c *RawStreamClient) ReplyContext(ctx context.Context, replyTo uint64, messageCode string, payload messages.RawMessage) (uint64, error) {
+	conn := c.conn.Load()
+	if conn == nil {
+		return 0, ErrSessionClosed
+	}
+	return conn.send(ctx, replyTo, messageCode, payload)
+}
+
+// spawn starts the plug process. If the communication loop is already running,
+// messages from the new process are dispatched to it right away.
+func (c *RawStreamClient) spawn(ctx context.Context) error {
+	if !c.running.Load() {
+		return c.StartContext(ctx)
+	}
+	conn, info, err := c.dial(ctx, nil)
 	if err != nil {
-		// If we can't write the response, panic — plugin cannot recover.
-		panic(err)
+		return err
 	}
+	c.conn.Store(conn)
+	c.plugInfo = info
+	conn.start(c.dispatch, nil)
+	return nil
 }
 
-// func (c *RawStreamClient) decode() {
-//	var msg messages.Envelope
-//	err := c.decoder.Decode(&msg)
-//	if err != nil {
-//		// errCh <- err
-//		return
-//	}
-//	c.msgs <- msg
-//}
+// halt shuts the plug down, see Close.
+func (c *RawStreamClient) halt() error {
+	return c.Close(context.Background())
+}
+
+// supervise tells the client that its plug is restarted by a Supervisor, see supervisedClient.
+func (c *RawStreamClient) supervise() {
+	c.supervised.Store(true)
+}
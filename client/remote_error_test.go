@@ -0,0 +1,33 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestRemoteError(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	reason, _, err := echo(context.Background(), c, "fail", "no text")
+	if reason != codes.DataFormatError {
+		t.Errorf("reason = %v, want %v", reason, codes.DataFormatError)
+	}
+	var remote *plugkit.RemoteError
+	if !errors.As(err, &remote) {
+		t.Fatalf("RunCommand() = %v, want a *plugkit.RemoteError", err)
+	}
+	if remote.Message != "no text" || remote.Details["field"] != "text" || !errors.Is(err, codes.DataFormatError) {
+		t.Errorf("remote error = %+v", remote)
+	}
+	// The session survives a failed command.
+	if _, got, err := echo(context.Background(), c, "echo", "ok"); err != nil || got != "ok" {
+		t.Errorf("command after the failure = %q, %v", got, err)
+	}
+}
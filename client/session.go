@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// ErrSessionClosed is returned when a command is sent to a plug whose session is over,
+// either because the plug finished, or because it is a one-shot plug that already
+// served its command.
+var ErrSessionClosed = errors.New("plug session is closed")
+
+// claim reports whether another command may be sent to the plug.
+// One-shot plugs accept exactly one command.
+func (c *conn) claim() bool {
+	if c.sessions {
+		return !c.finished.Load()
+	}
+	return c.finished.CompareAndSwap(false, true)
+}
+
+// finishError converts a PluginFinish received in answer to a command into the error
+// returned to the caller: the command produced no result, as the plug ended the session.
+func finishError(fin *messages.PluginFinish) error {
+	return &plugkit.RemoteError{Code: fin.Reason, Message: fin.Message}
+}
+
+// crashError converts a PluginCrash received in answer to a command into the error
+// returned to the caller. The stack trace of the plug is kept in the "stack" detail.
+func (c *conn) crashError(msg *messages.Envelope) error {
+	var crash messages.PluginCrash
+	if err := c.codec.Unmarshal(msg.Raw, &crash); err != nil {
+		return &plugkit.RemoteError{Code: codes.PlugCrashed, Message: "plug crashed"}
+	}
+	if crash.Finishing {
+		c.finished.Store(true)
+	}
+	return &plugkit.RemoteError{
+		Code:    codes.PlugCrashed,
+		Message: "panic: " + crash.Panic,
+		Details: map[string]any{"type": crash.Type, "stack": crash.Stack},
+	}
+}
+
+// command sends a command to the plug and waits for the plug's reply to it.
+//
+// Replies ending the command without a result, such as a crash or a PluginFinish, are turned
+// into the exit reason and error returned to the caller. If err is nil, msg is the reply to be
+// handled by the caller, usually a codes.PluginResponse.
+func (c *conn) command(ctx context.Context, name codes.MessageCode, v any) (msg messages.Envelope, reason codes.PluginExitReason, err error) {
+	if !c.claim() {
+		return msg, codes.PlugNotStarted, ErrSessionClosed
+	}
+	started := time.Now()
+	msg, err = c.request(ctx, string(name), c.raw(v))
+	if err != nil {
+		if reason, ok := contextReason(err); ok {
+			c.logCommand(ctx, slog.LevelWarn, "command abandoned", string(name), nil, started, slog.Any("error", err))
+			return msg, reason, err
+		}
+		if errors.Is(err, messages.ErrLimitExceeded) {
+			c.logCommand(ctx, slog.LevelError, "plug message rejected", string(name), nil, started, slog.Any("error", err))
+			return msg, codes.DataFormatError, err
+		}
+		if errors.Is(err, io.EOF) {
+			c.logCommand(ctx, slog.LevelError, "plug finished prematurely", string(name), nil, started)
+			return msg, codes.PlugCrashed, err
+		}
+		c.logCommand(ctx, slog.LevelError, "plug communication failed", string(name), nil, started, slog.Any("error", err))
+		return msg, codes.PluginToHostCommunicationError, err
+	}
+	c.logCommand(ctx, slog.LevelDebug, "command answered", string(name), &msg, started)
+
+	switch msg.Type {
+	case string(codes.PluginCrashed):
+		return msg, codes.PlugCrashed, c.crashError(&msg)
+	case string(codes.VersionUnsupported):
+		return msg, codes.RemoteErrorInProtocol, c.versionRejected(&msg)
+	case string(codes.FinishMessage):
+		c.finished.Store(true)
+		var fin *messages.PluginFinish
+		if err := c.codec.Unmarshal(msg.Raw, &fin); err != nil {
+			return msg, codes.PluginToHostCommunicationError, err
+		}
+		c.log.LogAttrs(ctx, slog.LevelInfo, "plug finished",
+			slog.String("reason", fin.Reason.String()), slog.String("message", fin.Message))
+		return msg, fin.Reason, finishError(fin)
+	case string(codes.Unsupported):
+		return msg, codes.CommandInvokedCannotExecute, errors.New("unsupported message type")
+	case string(codes.PayloadMalformed):
+		// The plug rejected the payload before handling it; Details["fields"] tells which fields are wrong.
+		var e *messages.Error
+		if err := c.codec.Unmarshal(msg.Raw, &e); err != nil || e == nil {
+			return msg, codes.DataFormatError, errors.New("payload rejected by plug")
+		}
+		return msg, e.Code, plugkit.NewRemoteError(e)
+	}
+	return msg, codes.OperationSuccess, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestSession(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	for i := range 5 {
+		want := fmt.Sprint("message ", i)
+		reason, got, err := echo(context.Background(), c, "echo", want)
+		if err != nil || reason != codes.OperationSuccess || got != want {
+			t.Fatalf("command %d = %v, %q, %v, want %q", i, reason, got, err, want)
+		}
+	}
+}
+
+func TestSessionOneShot(t *testing.T) {
+	c := startEcho(t, "echo-oneshot", nil)
+	if c.PlugInfo().HasFeature("sessions") {
+		t.Error("one-shot plug advertises sessions")
+	}
+
+	if _, got, err := echo(context.Background(), c, "echo", "once"); err != nil || got != "once" {
+		t.Fatalf("first command = %q, %v", got, err)
+	}
+	reason, _, err := echo(context.Background(), c, "echo", "twice")
+	if !errors.Is(err, client.ErrSessionClosed) || reason != codes.PlugNotStarted {
+		t.Errorf("second command = %v, %v, want %v and client.ErrSessionClosed", reason, err, codes.PlugNotStarted)
+	}
+}
+
+func TestSessionFinishedByPlug(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	// A handler returning no result ends the session.
+	if reason, _, err := echo(context.Background(), c, "finish", ""); err == nil || reason != codes.OperationSuccess {
+		t.Fatalf("finish = %v, %v, want %v and the PluginFinish as error", reason, err, codes.OperationSuccess)
+	}
+	if _, _, err := echo(context.Background(), c, "echo", "after"); !errors.Is(err, client.ErrSessionClosed) {
+		t.Errorf("command after the finish = %v, want client.ErrSessionClosed", err)
+	}
+	<-c.Exited()
+	if status := c.ExitStatus(); status == nil || !status.Success() {
+		t.Errorf("exit status = %v, want success", status)
+	}
+}
+
+func TestSessionRestart(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if _, _, err := echo(context.Background(), c, "echo", "stopped"); !errors.Is(err, client.ErrSessionClosed) {
+		t.Errorf("command after Stop = %v, want client.ErrSessionClosed", err)
+	}
+	if err := c.StartLocal(); err != nil {
+		t.Fatalf("StartLocal after Stop: %v", err)
+	}
+	if _, got, err := echo(context.Background(), c, "echo", "again"); err != nil || got != "again" {
+		t.Errorf("command after restart = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"log/slog"
+	"syscall"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// Default grace periods of a client's Close, see shutdownGrace.
+const (
+	DefaultTerminateGrace = 5 * time.Second
+	DefaultKillGrace      = 5 * time.Second
+)
+
+// shutdownGrace holds the grace periods given to a plug that is being closed.
+type shutdownGrace struct {
+	terminate time.Duration // from the end of the session until SIGTERM
+	kill      time.Duration // from SIGTERM until SIGKILL
+}
+
+func (g shutdownGrace) terminateAfter() time.Duration {
+	if g.terminate <= 0 {
+		return DefaultTerminateGrace
+	}
+	return g.terminate
+}
+
+func (g shutdownGrace) killAfter() time.Duration {
+	if g.kill <= 0 {
+		return DefaultKillGrace
+	}
+	return g.kill
+}
+
+// terminate shuts the plug down gracefully, escalating if it does not cooperate.
+//
+// Unless the session is already over, the plug is sent codes.ExitMessage with a
+// messages.StopCommand, and terminate waits for its PluginFinish, which the plug sends once
+// every request in flight is served. ctx bounds this wait. The plug's input is closed then,
+// and the plug gets the terminate grace period to exit. After that it is sent SIGTERM,
+// and after the kill grace period SIGKILL. The plug process is always reaped.
+func (c *conn) terminate(ctx context.Context, grace shutdownGrace) error {
+	c.closing.Store(true)
+	if !c.finished.Swap(true) && !c.isDone() {
+		// The plug answers with a PluginFinish, or just goes away — both are fine.
+		_, err := c.request(ctx, string(codes.ExitMessage), c.raw(&messages.StopCommand{Reason: codes.OperationCancelledByClient}))
+		if err != nil && !c.isDone() {
+			c.log.LogAttrs(ctx, slog.LevelWarn, "plug did not finish its session", slog.Any("error", err))
+		}
+	}
+	_ = c.stdin.Close()
+
+	if !c.awaitExit(ctx, grace.terminateAfter()) {
+		c.log.LogAttrs(ctx, slog.LevelWarn, "plug did not exit, sending SIGTERM")
+		if err := c.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			// E.g. on Windows, where SIGTERM cannot be sent.
+			_ = c.cmd.Process.Kill()
+		}
+		if !c.awaitExit(context.Background(), grace.killAfter()) {
+			c.log.LogAttrs(ctx, slog.LevelWarn, "plug did not exit, sending SIGKILL")
+			_ = c.cmd.Process.Kill()
+		}
+	}
+	return c.close()
+}
+
+// awaitExit waits up to timeout for the plug process to exit, and reports whether it did.
+// It gives up early when ctx ends.
+func (c *conn) awaitExit(ctx context.Context, timeout time.Duration) bool {
+	select {
+	case <-c.exited:
+		return true
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-c.exited:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return false
+	}
+}
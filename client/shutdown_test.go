@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func init() {
+	// lingering keeps running once the host closed its input, until it is terminated.
+	plugs["lingering"] = func() {
+		linger(false)
+	}
+	// stubborn ignores the end of its session and SIGTERM.
+	plugs["stubborn"] = func() {
+		linger(true)
+	}
+}
+
+// linger answers the hello, ignores the messages of the host and keeps running once the host
+// closed its input. With ignoreTerm, the plug survives SIGTERM too.
+func linger(ignoreTerm bool) {
+	if ignoreTerm {
+		signal.Ignore(syscall.SIGTERM)
+	}
+	p := newFake()
+	msg, ok := p.receive()
+	if !ok {
+		return
+	}
+	p.send(msg.ID, string(codes.HelloMessage), plugHello(nil))
+	for ok {
+		_, ok = p.receive()
+	}
+	time.Sleep(time.Hour)
+}
+
+func TestCloseDrains(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	answered := make(chan error, 1)
+	go func() {
+		_, got, err := echo(context.Background(), c, "sleep", "200")
+		if err == nil && got != "200" {
+			err = errors.New("wrong result " + got)
+		}
+		answered <- err
+	}()
+	// Let the command reach the plug before the session ends.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case err := <-answered:
+		if err != nil {
+			t.Errorf("command in flight = %v, want its result", err)
+		}
+	default:
+		t.Error("Close returned before the command in flight was answered")
+	}
+	if status := c.ExitStatus(); status == nil || !status.Success() {
+		t.Errorf("exit status = %v, want success", status)
+	}
+	if _, _, err := echo(context.Background(), c, "echo", "late"); !errors.Is(err, client.ErrSessionClosed) {
+		t.Errorf("command after Close = %v, want client.ErrSessionClosed", err)
+	}
+}
+
+func TestCloseEscalates(t *testing.T) {
+	tests := []struct {
+		plug   string
+		signal syscall.Signal
+	}{
+		{"lingering", syscall.SIGTERM},
+		{"stubborn", syscall.SIGKILL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plug, func(t *testing.T) {
+			c := client.NewSmartClient(plugCommand(t, tt.plug))
+			c.SetShutdownGrace(50*time.Millisecond, 50*time.Millisecond)
+			if err := c.StartLocal(); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			started := time.Now()
+			_ = c.Close(ctx)
+			if elapsed := time.Since(started); elapsed > 5*time.Second {
+				t.Errorf("Close took %s", elapsed)
+			}
+			status := c.ExitStatus()
+			if status == nil || status.Signal != tt.signal {
+				t.Errorf("exit status = %v, want %v", status, tt.signal)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/plug"
+)
+
+func init() {
+	plugs["stream-wait"] = func() {
+		if err := plug.NewRawStreamPlug(&waiter{}).Main(); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// waiter is a stream plug answering "wait" once its context ends, and echoing every other message.
+type waiter struct {
+	p *plug.RawStreamPlug
+}
+
+func (s *waiter) Mount(p *plug.RawStreamPlug) { s.p = p }
+
+func (s *waiter) CloseSignal() {}
+
+func (s *waiter) Handle(kind string, payload messages.RawMessage, id, replyTo uint64) {
+	s.HandleContext(context.Background(), kind, payload, id, replyTo)
+}
+
+func (s *waiter) HandleContext(ctx context.Context, kind string, payload messages.RawMessage, id, _ uint64) {
+	if kind == "wait" {
+		<-ctx.Done()
+		kind = "cancelled"
+	}
+	s.p.Reply(id, kind, payload)
+}
+
+// runStream starts the named stream plug, and runs a RawStreamClient passing the types of the
+// messages it receives to r. The returned channel is closed once Run returns.
+func runStream(t *testing.T, name string, r *received, setup func(c *client.RawStreamClient)) (*client.RawStreamClient, <-chan struct{}) {
+	t.Helper()
+	c := client.NewRawStreamClient(r, plugCommand(t, name))
+	if setup != nil {
+		setup(c)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close(context.Background()) })
+	stopped := make(chan struct{})
+	go func() {
+		c.Run()
+		close(stopped)
+	}()
+	return c, stopped
+}
+
+func TestStreamDrain(t *testing.T) {
+	r := &received{types: make(chan string, 10)}
+	c, stopped := runStream(t, "stream-wait", r, nil)
+	ctx := context.Background()
+
+	id, err := c.SendContext(ctx, "wait", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendContext(ctx, string(codes.ExitMessage), nil); err != nil {
+		t.Fatal(err)
+	}
+	// The plug drains the waiting handler: it still answers heartbeats, and the
+	// cancellation reaches the handler.
+	if _, err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping() while draining = %v", err)
+	}
+	if _, err := c.SendContext(ctx, "echo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendContext(ctx, string(codes.CancelMessage), codec.MustMarshal(c.Codec(), messages.Cancel{ID: id})); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for range 2 {
+		select {
+		case kind := <-r.types:
+			got = append(got, kind)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %q, want the cancelled command and a finish", got)
+		}
+	}
+	// The command sent after the end of the session is not served.
+	slices.Sort(got)
+	if want := []string{string(codes.FinishMessage), "cancelled"}; !slices.Equal(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the plug finished")
+	}
+}
+
+func TestStreamTerminated(t *testing.T) {
+	r := &received{types: make(chan string, 10)}
+	c, _ := runStream(t, "stream-wait", r, func(c *client.RawStreamClient) {
+		c.SetShutdownGrace(50*time.Millisecond, time.Minute)
+	})
+	if _, err := c.SendContext(context.Background(), "wait", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The waiting handler keeps the plug draining until SIGTERM cancels it;
+	// the plug exits then, long before it would be killed.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_ = c.Close(ctx)
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("Close took %s", elapsed)
+	}
+	if status := c.ExitStatus(); status == nil || !status.Success() {
+		t.Errorf("exit status = %v, want success", status)
+	}
+}
+
+func TestStreamStopBeforeRun(t *testing.T) {
+	r := &received{types: make(chan string, 10)}
+	c := client.NewRawStreamClient(r, plugCommand(t, "stream-wait"))
+	// Stop neither blocks before the plug is started, nor when called again.
+	c.Stop()
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close(context.Background()) })
+	c.Stop()
+
+	stopped := make(chan struct{})
+	go func() {
+		c.Run()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+	// The plug is shut down in the background.
+	eventually(t, "the plug to exit", func() bool { return c.ExitStatus() != nil })
+}
+
+func TestStreamSendAfterExit(t *testing.T) {
+	r := &received{types: make(chan string, 10)}
+	c, _ := runStream(t, "stream-wait", r, nil)
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendContext(context.Background(), "echo", nil); err == nil {
+		t.Error("SendContext() after the plug exited = nil, want an error")
+	}
+	// The deprecated Send only logs the failure.
+	c.Send("echo", nil)
+}
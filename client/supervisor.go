@@ -0,0 +1,292 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// RestartPolicy tells a Supervisor when to restart a plug process that exited.
+type RestartPolicy int
+
+const (
+	// RestartNever leaves the plug down once it exits.
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure restarts the plug if it exits with a non-zero code or is killed by a signal.
+	RestartOnFailure
+	// RestartAlways restarts the plug whenever it exits, unless the host shut it down.
+	RestartAlways
+)
+
+// String returns the name of the policy.
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartNever:
+		return "never"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	}
+	return "unknown"
+}
+
+// Defaults used by a Supervisor unless set otherwise.
+const (
+	DefaultMinBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff    = 30 * time.Second
+	DefaultMaxRestarts   = 5
+	DefaultRestartWindow = time.Minute
+)
+
+// ErrRestartLimitReached is reported by Supervisor.Err when the plug kept exiting
+// and was restarted too many times within the restart window.
+var ErrRestartLimitReached = errors.New("plug restart limit reached")
+
+// Supervisable is a client whose plug process can be supervised, i.e. a *SmartPlugClient,
+// a *RawClient or a *RawStreamClient.
+type Supervisable interface {
+	// Exited returns a channel closed once the current plug process exits.
+	Exited() <-chan struct{}
+	// ExitStatus returns how the current plug process ended, or nil while it is running.
+	ExitStatus() *ExitStatus
+
+	current() *conn
+	spawn(ctx context.Context) error
+	halt() error
+}
+
+// supervisedClient is implemented by clients that behave differently once supervised,
+// e.g. RawStreamClient, which keeps its loop running while the plug is restarted.
+type supervisedClient interface {
+	supervise()
+}
+
+// Supervisor watches the plug process of a client, reports how it exits and restarts it
+// according to a RestartPolicy.
+//
+// Restarts are delayed with exponential backoff: the first one by the minimum backoff,
+// each further one within the restart window twice as long, up to the maximum backoff.
+// Once the plug has been restarted the maximum number of times within the window,
+// the Supervisor gives up and reports ErrRestartLimitReached.
+//
+// Commands sent while the plug is down fail as usual; once it is back, the client
+// talks to the new process. With heartbeats enabled on the client (see SetHeartbeat),
+// a plug that stops responding is killed, and restarted like one that crashed.
+type Supervisor struct {
+	client Supervisable
+	policy RestartPolicy
+
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxRestarts int
+	window      time.Duration
+	onExit      func(*ExitStatus)
+	log         *slog.Logger
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+	stopErr  error
+
+	mu       sync.Mutex
+	restarts []time.Time // restarts within the window, oldest first
+	total    int
+	err      error
+}
+
+// Supervise returns a Supervisor for the plug process of client. Supervision begins with Start.
+func Supervise(client Supervisable, policy RestartPolicy) *Supervisor {
+	if c, ok := client.(supervisedClient); ok {
+		c.supervise()
+	}
+	return &Supervisor{
+		client:      client,
+		policy:      policy,
+		minBackoff:  DefaultMinBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		maxRestarts: DefaultMaxRestarts,
+		window:      DefaultRestartWindow,
+		log:         discardLogger,
+		done:        make(chan struct{}),
+	}
+}
+
+// SetBackoff sets the delay before the first restart, and the upper bound of the delay.
+// Must be called before Start.
+func (s *Supervisor) SetBackoff(minDelay, maxDelay time.Duration) {
+	s.minBackoff = minDelay
+	s.maxBackoff = max(minDelay, maxDelay)
+}
+
+// SetRestartLimit sets how many times the plug may be restarted within window.
+// A non-positive maxRestarts removes the limit. Must be called before Start.
+func (s *Supervisor) SetRestartLimit(maxRestarts int, window time.Duration) {
+	s.maxRestarts = maxRestarts
+	s.window = window
+}
+
+// OnExit sets a function called every time the plug process exits on its own,
+// before it is restarted. Must be called before Start.
+func (s *Supervisor) OnExit(fn func(*ExitStatus)) {
+	s.onExit = fn
+}
+
+// SetLogger sets the logger for plug exits and restarts. By default, nothing is logged.
+func (s *Supervisor) SetLogger(logger *slog.Logger) {
+	s.log = loggerOrDiscard(logger)
+}
+
+// Start starts the plug process, unless the client already runs one, and begins watching it.
+// Supervision ends when ctx ends, when Stop is called, or when the plug is not restarted.
+func (s *Supervisor) Start(ctx context.Context) error {
+	if c := s.client.current(); c == nil || c.exitStatus() != nil {
+		if err := s.client.spawn(ctx); err != nil {
+			return err
+		}
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.watch(ctx)
+	return nil
+}
+
+// Stop ends supervision and shuts the plug down. It returns the error of shutting the
+// client down, as its Stop method does.
+func (s *Supervisor) Stop() error {
+	s.stopOnce.Do(func() {
+		if s.cancel != nil {
+			s.cancel()
+			<-s.done
+		}
+		s.stopErr = s.client.halt()
+	})
+	return s.stopErr
+}
+
+// Done returns a channel closed once supervision ends.
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns ErrRestartLimitReached once the Supervisor gave up on the plug, and nil
+// otherwise. The exit status of the plug is reported by the client's ExitStatus method.
+func (s *Supervisor) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Restarts returns how many times the plug has been restarted.
+func (s *Supervisor) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// watch waits for the plug process to exit and restarts it as long as the policy says so.
+func (s *Supervisor) watch(ctx context.Context) {
+	defer close(s.done)
+	for {
+		c := s.client.current()
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.exited:
+		}
+		if c.closing.Load() {
+			// Shut down by the host, e.g. with the client's Stop method.
+			return
+		}
+
+		status := c.status
+		s.log.LogAttrs(ctx, slog.LevelWarn, "plug exited",
+			slog.Int("pid", status.PID), slog.String("status", status.String()))
+		if s.onExit != nil {
+			s.onExit(status)
+		}
+		if !s.restartable(status) {
+			return
+		}
+		_ = c.close()
+
+		if !s.restart(ctx) {
+			return
+		}
+	}
+}
+
+// restartable reports whether the policy calls for restarting a plug that exited with status.
+func (s *Supervisor) restartable(status *ExitStatus) bool {
+	switch s.policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return !status.Success()
+	}
+	return false
+}
+
+// restart starts the plug again, retrying with backoff until it starts, ctx ends
+// or the restart limit is reached. It reports whether the plug is running.
+func (s *Supervisor) restart(ctx context.Context) bool {
+	for {
+		delay, ok := s.next()
+		if !ok {
+			s.log.LogAttrs(ctx, slog.LevelError, "plug restart limit reached",
+				slog.Int("restarts", s.maxRestarts), slog.Duration("window", s.window))
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		err := s.client.spawn(ctx)
+		if err == nil {
+			s.log.LogAttrs(ctx, slog.LevelInfo, "plug restarted", slog.Int("pid", s.client.current().cmd.Process.Pid))
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		s.log.LogAttrs(ctx, slog.LevelWarn, "plug restart failed", slog.Any("error", err))
+	}
+}
+
+// next records a restart and returns the backoff delay before it. ok is false, and the
+// Supervisor gives up, if the restart limit is reached.
+func (s *Supervisor) next() (delay time.Duration, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.window {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = recent
+	if s.maxRestarts > 0 && len(s.restarts) >= s.maxRestarts {
+		s.err = ErrRestartLimitReached
+		return 0, false
+	}
+
+	delay = s.minBackoff
+	for range s.restarts {
+		if delay >= s.maxBackoff/2 {
+			delay = s.maxBackoff
+			break
+		}
+		delay *= 2
+	}
+	s.restarts = append(s.restarts, now)
+	s.total++
+	return delay, true
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+)
+
+// supervised starts the echo plug under a Supervisor with the given policy, restarting
+// right away, after setup has configured it. Exit statuses reported to OnExit are sent
+// to the returned channel.
+func supervised(t *testing.T, policy client.RestartPolicy, setup func(s *client.Supervisor)) (*client.SmartPlugClient, *client.Supervisor, <-chan *client.ExitStatus) {
+	t.Helper()
+	c := client.NewSmartClient(plugCommand(t, "echo"))
+	client.HandleMessage(c, "echo", func(in text) (text, error) { return in, nil })
+	s := client.Supervise(c, policy)
+	s.SetBackoff(time.Millisecond, time.Millisecond)
+	exits := make(chan *client.ExitStatus, 10)
+	s.OnExit(func(status *client.ExitStatus) { exits <- status })
+	if setup != nil {
+		setup(s)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Stop() })
+	return c, s, exits
+}
+
+// exited waits for the next exit reported by a Supervisor.
+func exited(t *testing.T, exits <-chan *client.ExitStatus) *client.ExitStatus {
+	t.Helper()
+	select {
+	case status := <-exits:
+		return status
+	case <-time.After(5 * time.Second):
+		t.Fatal("plug exit not reported")
+		return nil
+	}
+}
+
+// serving waits until the plug answers commands.
+func serving(t *testing.T, c *client.SmartPlugClient) {
+	t.Helper()
+	eventually(t, "the plug to serve commands", func() bool {
+		_, got, err := echo(context.Background(), c, "echo", "up")
+		return err == nil && got == "up"
+	})
+}
+
+func TestSupervisorRestartOnFailure(t *testing.T) {
+	c, s, exits := supervised(t, client.RestartOnFailure, nil)
+
+	_, _, _ = echo(context.Background(), c, "die", "3")
+	if status := exited(t, exits); status.Code != 3 || status.Success() {
+		t.Errorf("exit status = %v, want exit code 3", status)
+	}
+	serving(t, c)
+	if s.Restarts() != 1 {
+		t.Errorf("Restarts() = %d, want 1", s.Restarts())
+	}
+
+	// A plug finishing its session exits successfully, and is not restarted.
+	_, _, _ = echo(context.Background(), c, "finish", "")
+	if status := exited(t, exits); !status.Success() {
+		t.Errorf("exit status = %v, want success", status)
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervision did not end")
+	}
+	if s.Err() != nil || s.Restarts() != 1 {
+		t.Errorf("Err() = %v, Restarts() = %d, want no error and 1 restart", s.Err(), s.Restarts())
+	}
+}
+
+func TestSupervisorRestartAlways(t *testing.T) {
+	c, s, exits := supervised(t, client.RestartAlways, nil)
+
+	_, _, _ = echo(context.Background(), c, "finish", "")
+	exited(t, exits)
+	serving(t, c)
+	if s.Restarts() != 1 {
+		t.Errorf("Restarts() = %d, want 1", s.Restarts())
+	}
+}
+
+func TestSupervisorRestartNever(t *testing.T) {
+	c, s, exits := supervised(t, client.RestartNever, nil)
+
+	_, _, _ = echo(context.Background(), c, "die", "1")
+	exited(t, exits)
+	<-s.Done()
+	if s.Restarts() != 0 || c.ExitStatus() == nil {
+		t.Errorf("Restarts() = %d, ExitStatus() = %v, want the plug left down", s.Restarts(), c.ExitStatus())
+	}
+}
+
+func TestSupervisorRestartLimit(t *testing.T) {
+	c, s, exits := supervised(t, client.RestartAlways, func(s *client.Supervisor) {
+		s.SetRestartLimit(2, time.Minute)
+	})
+
+	for range 3 {
+		serving(t, c)
+		_, _, _ = echo(context.Background(), c, "die", "1")
+		exited(t, exits)
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervision did not end at the restart limit")
+	}
+	if !errors.Is(s.Err(), client.ErrRestartLimitReached) || s.Restarts() != 2 {
+		t.Errorf("Err() = %v, Restarts() = %d, want client.ErrRestartLimitReached after 2 restarts", s.Err(), s.Restarts())
+	}
+}
+
+func TestSupervisorStop(t *testing.T) {
+	c, s, exits := supervised(t, client.RestartAlways, nil)
+	serving(t, c)
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	<-s.Done()
+	<-c.Exited()
+	select {
+	case status := <-exits:
+		t.Errorf("a plug shut down by the host was reported as exited: %v", status)
+	default:
+	}
+	if s.Restarts() != 0 {
+		t.Errorf("Restarts() = %d after Stop, want 0", s.Restarts())
+	}
+}
+
+func TestSupervisorConcurrentCommands(t *testing.T) {
+	c, _, exits := supervised(t, client.RestartOnFailure, nil)
+
+	// Commands sent while the plug restarts fail, later ones reach the new process.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _ = echo(context.Background(), c, "echo", "x")
+		}()
+	}
+	_, _, _ = echo(context.Background(), c, "die", "2")
+	wg.Wait()
+	exited(t, exits)
+	serving(t, c)
+}
+
+func TestRestartPolicyString(t *testing.T) {
+	for policy, want := range map[client.RestartPolicy]string{
+		client.RestartNever:     "never",
+		client.RestartOnFailure: "on-failure",
+		client.RestartAlways:    "always",
+		client.RestartPolicy(9): "unknown",
+	} {
+		if got := policy.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", int(policy), got, want)
+		}
+	}
+}
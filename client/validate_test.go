@@ -0,0 +1,36 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mjwhodur/plugkit"
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestPayloadRejected(t *testing.T) {
+	c := startEcho(t, "echo", nil)
+
+	// The typed handler of length decodes strictly: the misspelled field is rejected before it runs.
+	reason, _, err := c.RunCommandContext(context.Background(), "length", map[string]string{"txt": "hi"})
+	if reason != codes.DataFormatError {
+		t.Errorf("reason = %v, want %v", reason, codes.DataFormatError)
+	}
+	var remote *plugkit.RemoteError
+	if !errors.As(err, &remote) {
+		t.Fatalf("RunCommand() = %v, want a *plugkit.RemoteError", err)
+	}
+	fields, _ := remote.Details["fields"].(map[any]any)
+	if fields["txt"] != "unknown field" {
+		t.Errorf("rejected fields = %v, want txt as an unknown field", remote.Details["fields"])
+	}
+
+	// The session goes on.
+	if _, got, err := echo(context.Background(), c, "echo", "still here"); err != nil || got != "still here" {
+		t.Errorf("command after the rejection = %q, %v", got, err)
+	}
+}
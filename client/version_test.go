@@ -0,0 +1,77 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package client_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/client"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func init() {
+	// future speaks only a protocol version from the future.
+	plugs["future"] = func() {
+		fakePlug(func(*messages.Hello) *messages.Hello {
+			return &messages.Hello{ProtocolVersion: messages.ProtocolVersion + 2, MinProtocolVersion: messages.ProtocolVersion + 1}
+		}, nil)
+	}
+	// rejects-version answers every command with VersionUnsupported.
+	plugs["rejects-version"] = func() {
+		fakePlug(plugHello, func(p *fake, msg messages.Envelope) {
+			p.send(msg.ID, string(codes.VersionUnsupported), messages.NewVersionUnsupported(msg.Version))
+		})
+	}
+	// stray-version answers every command with a message of an unknown version first,
+	// then with the type of the message the host sent back.
+	plugs["stray-version"] = func() {
+		fakePlug(plugHello, func(p *fake, msg messages.Envelope) {
+			_ = p.enc.Encode(&messages.Envelope{Version: messages.ProtocolVersion + 1, ID: 100, ReplyTo: msg.ID, Type: "echo"})
+			answer, ok := p.receive()
+			if !ok {
+				return
+			}
+			p.send(msg.ID, string(codes.PluginResponse), &messages.Result{Type: "echo", Value: text{answer.Type}})
+		})
+	}
+}
+
+func TestIncompatiblePlug(t *testing.T) {
+	c := client.NewSmartClient(plugCommand(t, "future"))
+	err := c.StartLocal()
+	var handshakeErr *client.HandshakeError
+	if !errors.As(err, &handshakeErr) {
+		t.Fatalf("StartLocal() = %v, want a *client.HandshakeError", err)
+	}
+	if !errors.Is(err, client.ErrIncompatiblePlug) || !errors.Is(err, messages.ErrUnsupportedVersion) {
+		t.Errorf("StartLocal() = %v, want client.ErrIncompatiblePlug and messages.ErrUnsupportedVersion", err)
+	}
+	if handshakeErr.Plug == nil || handshakeErr.Plug.ProtocolVersion != messages.ProtocolVersion+2 {
+		t.Errorf("HandshakeError.Plug = %+v, want the hello of the plug", handshakeErr.Plug)
+	}
+	if reason := handshakeErr.Reason(); reason != codes.RemoteErrorInProtocol {
+		t.Errorf("Reason() = %v, want %v", reason, codes.RemoteErrorInProtocol)
+	}
+}
+
+func TestVersionRejectedByPlug(t *testing.T) {
+	c := startEcho(t, "rejects-version", nil)
+	reason, _, err := c.RunCommand("echo", text{"hi"})
+	if reason != codes.RemoteErrorInProtocol || !errors.Is(err, messages.ErrUnsupportedVersion) {
+		t.Errorf("RunCommand() = %v, %v, want %v and messages.ErrUnsupportedVersion", reason, err, codes.RemoteErrorInProtocol)
+	}
+}
+
+func TestVersionRejectedByHost(t *testing.T) {
+	c := startEcho(t, "stray-version", nil)
+	reason, res, err := c.RunCommand("echo", text{"hi"})
+	if err != nil {
+		t.Fatalf("RunCommand() = %v, %v", reason, err)
+	}
+	if got := res.(text).Text; got != string(codes.VersionUnsupported) {
+		t.Errorf("host answered the stray message with %q, want %q", got, codes.VersionUnsupported)
+	}
+}
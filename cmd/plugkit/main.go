@@ -0,0 +1,88 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+// Command plugkit provides tools for working with PlugKit plugs.
+//
+// Usage:
+//
+//	plugkit schema [-format cddl|jsonschema] [-timeout 10s] <plug>
+//
+// The schema command starts the plug binary, asks it to describe itself (see
+// codes.DescribeMessage), and prints the contract of its messages to stdout, in CDDL
+// (the default) or as a JSON Schema. Request and response schemas are included for
+// message types registered with typed handlers, such as plug.Handle.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mjwhodur/plugkit/client"
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "schema":
+		err = schemaCommand(flag.Args()[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "plugkit: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "plugkit:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: plugkit schema [-format cddl|jsonschema] [-timeout duration] <plug>")
+}
+
+// schemaCommand prints the contract of the messages of a plug binary.
+func schemaCommand(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Usage = usage
+	format := fs.String("format", "cddl", "output format: cddl or jsonschema")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for the plug")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	if *format != "cddl" && *format != "jsonschema" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	c := client.NewSmartClient(fs.Arg(0))
+	if err := c.StartLocalContext(ctx); err != nil {
+		return err
+	}
+	description, err := c.Describe(ctx)
+	if closeErr := c.Close(ctx); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	doc := description.Document()
+	if *format == "jsonschema" {
+		return doc.WriteJSONSchema(os.Stdout)
+	}
+	return doc.WriteCDDL(os.Stdout)
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package codec
+
+import (
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// cborCodec is the default codec, see CBOR.
+type cborCodec struct{}
+
+func (cborCodec) Name() string { return "cbor" }
+
+func (cborCodec) Marshal(v any) ([]byte, error) { return cbor.Marshal(v) }
+
+func (cborCodec) Unmarshal(data []byte, v any) error { return cbor.Unmarshal(data, v) }
+
+func (cborCodec) NewEncoder(w io.Writer) Encoder { return cbor.NewEncoder(w) }
+
+func (cborCodec) NewDecoder(r io.Reader, limits messages.DecoderLimits) (Decoder, error) {
+	return messages.NewDecoder(r, limits)
+}
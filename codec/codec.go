@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+// Package codec implements the encodings PlugKit messages travel in.
+//
+// CBOR is the default. JSON (one message per line) and MsgPack let plugs written in languages
+// without a good CBOR library speak the protocol. The host names the codec of its Hello in the
+// messages.CodecEnv environment variable, and the plug may pick another one from Hello.Codecs
+// for the rest of the session.
+//
+// JSON and MsgPack encode Go values the way CBOR does: struct fields are named by their cbor
+// tags (falling back to json tags and field names), honour omitempty, time.Time is encoded as
+// Unix seconds and messages.RawMessage is embedded as is, once checked to hold a single valid
+// value of the codec. JSON has no byte strings, so []byte is encoded as a base64 string.
+// Values decoded into interfaces take the same shapes as with CBOR: integers become uint64
+// (int64 if negative), maps become map[any]any.
+//
+// Types implementing encoding.TextMarshaler and encoding.TextUnmarshaler are encoded as
+// strings by both codecs, and JSON uses json.Marshaler and json.Unmarshaler first. Other
+// marshaling methods, e.g. those of cbor.Marshaler, are only used by CBOR.
+package codec
+
+import (
+	"io"
+	"slices"
+
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// Codec encodes and decodes PlugKit messages.
+type Codec interface {
+	// Name identifies the codec during the handshake, e.g. "cbor".
+	Name() string
+	// Marshal returns the encoding of v.
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes data into the value pointed to by v.
+	Unmarshal(data []byte, v any) error
+	// NewEncoder returns an Encoder writing a stream of messages to w.
+	NewEncoder(w io.Writer) Encoder
+	// NewDecoder returns a Decoder reading a stream of messages from r within the given limits.
+	NewDecoder(r io.Reader, limits messages.DecoderLimits) (Decoder, error)
+}
+
+// Encoder writes a stream of messages.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// Decoder reads a stream of messages, see messages.Decoder.
+type Decoder interface {
+	Decode(v any) error
+	// Buffered returns a reader for the data read from the stream but not decoded yet.
+	Buffered() io.Reader
+}
+
+// Built-in codecs.
+var (
+	CBOR    Codec = cborCodec{}
+	JSON    Codec = jsonCodec{}
+	MsgPack Codec = msgpackCodec{}
+)
+
+// builtin are the codecs every PlugKit peer of this library speaks, the default first.
+var builtin = []Codec{CBOR, JSON, MsgPack}
+
+// ByName returns the built-in codec of the given name.
+func ByName(name string) (Codec, bool) {
+	i := slices.IndexFunc(builtin, func(c Codec) bool { return c.Name() == name })
+	if i < 0 {
+		return nil, false
+	}
+	return builtin[i], true
+}
+
+// Names returns the names of the built-in codecs, starting with preferred.
+func Names(preferred Codec) []string {
+	names := []string{preferred.Name()}
+	for _, c := range builtin {
+		if c.Name() != preferred.Name() {
+			names = append(names, c.Name())
+		}
+	}
+	return names
+}
+
+// MustMarshal returns the encoding of v as a messages.RawMessage. It panics if v cannot be encoded.
+func MustMarshal(c Codec, v any) messages.RawMessage {
+	b, err := c.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// strictCodec is implemented by the codecs UnmarshalStrict applies to.
+type strictCodec interface {
+	unmarshalStrict(data []byte, v any) error
+}
+
+// UnmarshalStrict decodes data like c.Unmarshal, except that maps holding the same key twice
+// are rejected with a *DuplicateKeyError, whereas Unmarshal keeps the last value. It applies
+// to JSON and MsgPack; other codecs, CBOR included, are decoded with their Unmarshal, and
+// CBOR can be made strict with the DupMapKey option of its own decoding mode instead.
+func UnmarshalStrict(c Codec, data []byte, v any) error {
+	if s, ok := c.(strictCodec); ok {
+		return s.unmarshalStrict(data, v)
+	}
+	return c.Unmarshal(data, v)
+}
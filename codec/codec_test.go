@@ -0,0 +1,452 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+var codecs = []codec.Codec{codec.CBOR, codec.JSON, codec.MsgPack}
+
+type inner struct {
+	Name string `cbor:"name"`
+}
+
+type Embedded struct {
+	Flat string `cbor:"flat"`
+}
+
+type sample struct {
+	Embedded
+	Uint     uint64              `cbor:"uint"`
+	Int      int64               `cbor:"int"`
+	Small    int8                `cbor:"small"`
+	Float    float64             `cbor:"float"`
+	Bool     bool                `cbor:"bool"`
+	Text     string              `cbor:"text"`
+	Bin      []byte              `cbor:"bin"`
+	List     []string            `cbor:"list"`
+	Map      map[string]int      `cbor:"map"`
+	IntKeys  map[int]string      `cbor:"int_keys"`
+	Ptr      *inner              `cbor:"ptr"`
+	Nested   []inner             `cbor:"nested"`
+	Skipped  string              `cbor:"-"`
+	Omitted  string              `cbor:"omitted,omitempty"`
+	Optional *inner              `cbor:"optional,omitempty"`
+	Payload  messages.RawMessage `cbor:"payload"`
+}
+
+func newSample(c codec.Codec) sample {
+	return sample{
+		Embedded: Embedded{Flat: "flat"},
+		Uint:     1 << 63,
+		Int:      -1 << 40,
+		Small:    -7,
+		Float:    3.25,
+		Bool:     true,
+		Text:     "zażółć \"gęślą\"\njaźń\t\x01\\",
+		Bin:      []byte{0, 1, 0xfe, 0xff},
+		List:     []string{"a", "", "c"},
+		Map:      map[string]int{"one": 1, "minus": -1},
+		IntKeys:  map[int]string{1: "one", -2: "minus two"},
+		Ptr:      &inner{Name: "ptr"},
+		Nested:   []inner{{Name: "x"}, {Name: "y"}},
+		Payload:  codec.MustMarshal(c, []any{"raw", 1}),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			in := newSample(c)
+			in.Skipped = "skipped"
+			data, err := c.Marshal(&in)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var out sample
+			if err := c.Unmarshal(data, &out); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			want := newSample(c)
+			if !reflect.DeepEqual(out, want) {
+				t.Errorf("got  %+v\nwant %+v", out, want)
+			}
+		})
+	}
+}
+
+func TestRoundTripTime(t *testing.T) {
+	type stamped struct {
+		At   time.Time  `cbor:"at"`
+		Zero time.Time  `cbor:"zero"`
+		Ptr  *time.Time `cbor:"ptr"`
+	}
+	at := time.Unix(1700000000, 0)
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(stamped{At: at, Ptr: &at})
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var out stamped
+			if err := c.Unmarshal(data, &out); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !out.At.Equal(at) || out.Ptr == nil || !out.Ptr.Equal(at) || !out.Zero.IsZero() {
+				t.Errorf("got %+v, want %v", out, at)
+			}
+		})
+	}
+}
+
+func TestRoundTripInterface(t *testing.T) {
+	in := map[string]any{
+		"uint":  uint64(7),
+		"int":   int64(-7),
+		"text":  "text",
+		"list":  []any{true, nil, 1.5},
+		"map":   map[any]any{"k": "v"},
+		"empty": []any{},
+	}
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(in)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			var out any
+			if err := c.Unmarshal(data, &out); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			want := map[any]any{}
+			for k, v := range in {
+				want[k] = v
+			}
+			if !reflect.DeepEqual(out, want) {
+				t.Errorf("got %#v, want %#v", out, want)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := c.NewEncoder(&buf)
+			for i := range uint64(3) {
+				msg := messages.Envelope{ID: i + 1, Type: "ping", Raw: codec.MustMarshal(c, i)}
+				if err := enc.Encode(&msg); err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+			}
+			dec, err := c.NewDecoder(&buf, messages.DecoderLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range uint64(3) {
+				var msg messages.Envelope
+				if err := dec.Decode(&msg); err != nil {
+					t.Fatalf("Decode %d: %v", i, err)
+				}
+				var n uint64
+				if err := c.Unmarshal(msg.Raw, &n); err != nil {
+					t.Fatalf("Unmarshal payload: %v", err)
+				}
+				if msg.ID != i+1 || msg.Type != "ping" || n != i {
+					t.Errorf("message %d: got %+v with payload %d", i, msg, n)
+				}
+			}
+			var msg messages.Envelope
+			if err := dec.Decode(&msg); !errors.Is(err, io.EOF) {
+				t.Errorf("Decode at the end: got %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(messages.Envelope{ID: 1, Type: "ping"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = bytes.TrimSuffix(data, []byte("\n"))
+			dec, err := c.NewDecoder(bytes.NewReader(data[:len(data)-1]), messages.DecoderLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg messages.Envelope
+			if err := dec.Decode(&msg); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("got %v, want io.ErrUnexpectedEOF", err)
+			}
+		})
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	deep := any("leaf")
+	for range 6 {
+		deep = []any{deep}
+	}
+	long := map[string]any{}
+	for i := range 17 {
+		long[strings.Repeat("k", i+1)] = i
+	}
+	tests := []struct {
+		name   string
+		limits messages.DecoderLimits
+		value  any
+		limit  string
+	}{
+		{"message size", messages.DecoderLimits{MaxMessageSize: 64}, strings.Repeat("x", 100), "message size"},
+		{"nesting", messages.DecoderLimits{MaxNestedLevels: 4}, deep, "nesting depth"},
+		{"array", messages.DecoderLimits{MaxArrayElements: 16}, make([]int, 17), "array elements"},
+		{"map", messages.DecoderLimits{MaxMapPairs: 16}, long, "map pairs"},
+		{"string", messages.DecoderLimits{MaxStringLength: 8}, []string{"short", "much too long"}, "string length"},
+	}
+	for _, c := range codecs {
+		for _, tt := range tests {
+			t.Run(c.Name()+"/"+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := c.NewEncoder(&buf).Encode(tt.value); err != nil {
+					t.Fatal(err)
+				}
+				dec, err := c.NewDecoder(&buf, tt.limits)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var v any
+				err = dec.Decode(&v)
+				var limitErr *messages.LimitError
+				if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+					t.Fatalf("got %v, want a %s *messages.LimitError", err, tt.limit)
+				}
+				if !errors.Is(err, messages.ErrLimitExceeded) {
+					t.Errorf("%v does not match messages.ErrLimitExceeded", err)
+				}
+			})
+		}
+	}
+}
+
+func TestRawMessageChecked(t *testing.T) {
+	type carrier struct {
+		Payload messages.RawMessage `cbor:"payload"`
+	}
+	foreign := map[string]codec.Codec{"cbor": codec.JSON, "json": codec.MsgPack, "msgpack": codec.JSON}
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			// A payload encoded with another codec is not embedded.
+			payload := codec.MustMarshal(foreign[c.Name()], map[string]any{"key": []any{"value", 1}})
+			if _, err := c.Marshal(carrier{Payload: payload}); err == nil {
+				t.Errorf("Marshal accepted a %s payload", foreign[c.Name()].Name())
+			}
+			if err := c.NewEncoder(io.Discard).Encode(carrier{Payload: payload}); err == nil {
+				t.Errorf("Encode accepted a %s payload", foreign[c.Name()].Name())
+			}
+
+			// So is a payload holding anything but a single value.
+			valid := codec.MustMarshal(c, "value")
+			if _, err := c.Marshal(carrier{Payload: slices.Concat(valid, valid)}); err == nil {
+				t.Error("Marshal accepted a payload of two values")
+			}
+			if _, err := c.Marshal(carrier{Payload: valid[:len(valid)-1]}); err == nil {
+				t.Error("Marshal accepted a truncated payload")
+			}
+		})
+	}
+}
+
+func TestJSONRawMessageStaysOnOneLine(t *testing.T) {
+	msg := messages.Envelope{ID: 1, Type: "ping", Raw: messages.RawMessage("{\n  \"a\": [1,\n 2]\n}\n")}
+	var buf bytes.Buffer
+	if err := codec.JSON.NewEncoder(&buf).Encode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 1 {
+		t.Fatalf("message spans %d lines: %q", n, buf.String())
+	}
+	dec, err := codec.JSON.NewDecoder(&buf, messages.DecoderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out messages.Envelope
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out.Raw), `{"a":[1,2]}`; got != want {
+		t.Errorf("got payload %s, want %s", got, want)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	type target struct {
+		Items []struct {
+			Count uint8 `cbor:"count"`
+		} `cbor:"items"`
+	}
+	for _, c := range []codec.Codec{codec.JSON, codec.MsgPack} {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(map[string]any{"items": []any{map[string]any{"count": 1}, map[string]any{"count": 300}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v target
+			err = c.Unmarshal(data, &v)
+			var decodeErr *codec.DecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.Field != "items[1].count" {
+				t.Errorf("got %v, want a *codec.DecodeError for items[1].count", err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     codec.Codec
+		data  []byte
+		field string
+	}{
+		{"json", codec.JSON, []byte(`{"items": [{"count": 1}, {"count": 2, "count": 3}]}`), "items[1].count"},
+		{"json escaped", codec.JSON, []byte(`{"a": 1, "\u0061": 2}`), "a"},
+		// {1: "a", 1: "b"}
+		{"msgpack integer keys", codec.MsgPack, []byte{0x82, 0x01, 0xa1, 'a', 0x01, 0xa1, 'b'}, `["1"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := tt.c.Unmarshal(tt.data, &v); err != nil {
+				t.Fatalf("Unmarshal() = %v, want duplicate keys accepted", err)
+			}
+			err := codec.UnmarshalStrict(tt.c, tt.data, &v)
+			var keyErr *codec.DuplicateKeyError
+			if !errors.As(err, &keyErr) || keyErr.Field != tt.field {
+				t.Errorf("UnmarshalStrict() = %v, want a *codec.DuplicateKeyError for %s", err, tt.field)
+			}
+		})
+	}
+	// Distinct keys are decoded as usual.
+	var v map[string]int
+	if err := codec.UnmarshalStrict(codec.JSON, []byte(`{"a": 1, "b": 2}`), &v); err != nil || v["b"] != 2 {
+		t.Errorf("UnmarshalStrict() = %v, %v", v, err)
+	}
+}
+
+// level implements encoding.TextMarshaler and encoding.TextUnmarshaler.
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("+", int(l))), nil
+}
+
+func (l *level) UnmarshalText(text []byte) error {
+	if strings.Trim(string(text), "+") != "" {
+		return errors.New("invalid level")
+	}
+	*l = level(len(text))
+	return nil
+}
+
+// point implements json.Marshaler and json.Unmarshaler, next to the text methods.
+type point struct{ X, Y int }
+
+func (p point) MarshalJSON() ([]byte, error) {
+	return []byte("[" + strings.Repeat("1,", p.X) + "0]"), nil
+}
+
+func (p *point) UnmarshalJSON(data []byte) error {
+	p.X = bytes.Count(data, []byte("1,"))
+	return nil
+}
+
+func (p point) MarshalText() ([]byte, error) { return []byte("text"), nil }
+
+func (p *point) UnmarshalText([]byte) error {
+	p.Y = 1
+	return nil
+}
+
+func TestMarshalers(t *testing.T) {
+	type carrier struct {
+		Level  level         `cbor:"level"`
+		Levels map[level]int `cbor:"levels"`
+		Point  point         `cbor:"point"`
+	}
+	in := carrier{Level: 3, Levels: map[level]int{1: 1}, Point: point{X: 2}}
+
+	data, err := codec.JSON.Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"level":"+++","levels":{"+":1},"point":[1,1,0]}`; string(data) != want {
+		t.Errorf("JSON: got %s, want %s", data, want)
+	}
+	var out carrier
+	if err := codec.JSON.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("JSON: got %+v, want %+v", out, in)
+	}
+
+	// MsgPack has no JSON methods, so it takes the text ones.
+	if data, err = codec.MsgPack.Marshal(&in); err != nil {
+		t.Fatal(err)
+	}
+	out = carrier{}
+	if err := codec.MsgPack.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := carrier{Level: 3, Levels: map[level]int{1: 1}, Point: point{Y: 1}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("MsgPack: got %+v, want %+v", out, want)
+	}
+
+	var l level
+	err = codec.MsgPack.Unmarshal(codec.MustMarshal(codec.MsgPack, "-"), &l)
+	var decodeErr *codec.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("got %v, want a *codec.DecodeError from UnmarshalText", err)
+	}
+}
+
+// badJSON returns invalid JSON from MarshalJSON.
+type badJSON struct{}
+
+func (badJSON) MarshalJSON() ([]byte, error) { return []byte("{oops"), nil }
+
+func TestMarshalerInvalidJSON(t *testing.T) {
+	if _, err := codec.JSON.Marshal([]badJSON{{}}); err == nil {
+		t.Error("Marshal accepted invalid JSON from MarshalJSON")
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, c := range codecs {
+		got, ok := codec.ByName(c.Name())
+		if !ok || got != c {
+			t.Errorf("ByName(%q) = %v, %v", c.Name(), got, ok)
+		}
+	}
+	if _, ok := codec.ByName("xml"); ok {
+		t.Error("ByName found an unknown codec")
+	}
+	if got, want := codec.Names(codec.MsgPack), []string{"msgpack", "cbor", "json"}; !slices.Equal(got, want) {
+		t.Errorf("Names(MsgPack) = %v, want %v", got, want)
+	}
+}
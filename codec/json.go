@@ -0,0 +1,459 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// jsonCodec encodes messages as JSON, one per line, see JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	n, err := encoder{json: true}.node(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return appendJSON(nil, n)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	p := jsonParser{data: data, limits: messages.DecoderLimits{}.WithDefaults()}
+	n, err := p.document()
+	if err != nil {
+		return err
+	}
+	return decoder{json: true}.unmarshal(n, v)
+}
+
+func (jsonCodec) unmarshalStrict(data []byte, v any) error {
+	p := jsonParser{data: data, limits: messages.DecoderLimits{}.WithDefaults()}
+	n, err := p.document()
+	if err != nil {
+		return err
+	}
+	if err := duplicateKey(n, ""); err != nil {
+		return err
+	}
+	return decoder{json: true}.unmarshal(n, v)
+}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return &jsonEncoder{w: w} }
+
+func (jsonCodec) NewDecoder(r io.Reader, limits messages.DecoderLimits) (Decoder, error) {
+	return &jsonDecoder{r: bufio.NewReader(r), limits: limits.WithDefaults()}, nil
+}
+
+type jsonEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// Encode writes v as a single line.
+func (e *jsonEncoder) Encode(v any) error {
+	n, err := encoder{json: true}.node(reflect.ValueOf(v))
+	if err != nil {
+		return err
+	}
+	if e.buf, err = appendJSON(e.buf[:0], n); err != nil {
+		return err
+	}
+	e.buf = append(e.buf, '\n')
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+type jsonDecoder struct {
+	r      *bufio.Reader
+	limits messages.DecoderLimits
+	line   []byte
+}
+
+// Decode reads the next non-empty line and decodes it into v.
+func (d *jsonDecoder) Decode(v any) error {
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		p := jsonParser{data: line, limits: d.limits}
+		n, err := p.document()
+		if err != nil {
+			return err
+		}
+		return decoder{json: true}.unmarshal(n, v)
+	}
+}
+
+// readLine returns the next line, without reading more than MaxMessageSize bytes of it.
+func (d *jsonDecoder) readLine() ([]byte, error) {
+	d.line = d.line[:0]
+	for {
+		chunk, err := d.r.ReadSlice('\n')
+		d.line = append(d.line, chunk...)
+		if len(d.line) > d.limits.MaxMessageSize+1 {
+			return nil, &messages.LimitError{Limit: "message size", Max: d.limits.MaxMessageSize}
+		}
+		switch {
+		case err == nil:
+			return d.line, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && len(d.line) > 0:
+			if len(bytes.TrimSpace(d.line)) == 0 {
+				return nil, io.EOF
+			}
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+}
+
+func (d *jsonDecoder) Buffered() io.Reader {
+	b, _ := d.r.Peek(d.r.Buffered())
+	return bytes.NewReader(bytes.Clone(b))
+}
+
+// appendJSON appends the JSON encoding of n to b.
+func appendJSON(b []byte, n node) ([]byte, error) {
+	switch n.kind {
+	case kindNil:
+		return append(b, "null"...), nil
+	case kindBool:
+		return strconv.AppendBool(b, n.b), nil
+	case kindInt:
+		return strconv.AppendInt(b, n.i, 10), nil
+	case kindUint:
+		return strconv.AppendUint(b, n.u, 10), nil
+	case kindFloat:
+		if math.IsNaN(n.f) || math.IsInf(n.f, 0) {
+			return nil, fmt.Errorf("codec: %v cannot be encoded as JSON", n.f)
+		}
+		return strconv.AppendFloat(b, n.f, 'g', -1, 64), nil
+	case kindString:
+		return appendJSONString(b, n.s), nil
+	case kindBytes:
+		return appendJSONString(b, base64.StdEncoding.EncodeToString(n.bin)), nil
+	case kindRaw:
+		return appendRawJSON(b, n.bin)
+	case kindArray:
+		b = append(b, '[')
+		for i, item := range n.items {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = appendJSON(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+	}
+
+	b = append(b, '{')
+	for i := 0; i < len(n.items); i += 2 {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		switch key := n.items[i]; key.kind {
+		case kindString:
+			b = appendJSONString(b, key.s)
+		case kindInt, kindUint:
+			b = append(b, '"')
+			b, _ = appendJSON(b, key)
+			b = append(b, '"')
+		default:
+			return nil, fmt.Errorf("codec: JSON object keys must be strings or integers, not %s", key.describe())
+		}
+		b = append(b, ':')
+		var err error
+		if b, err = appendJSON(b, n.items[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// appendRawJSON appends the embedded JSON value raw to b, without the insignificant spaces,
+// so that it cannot break the message onto several lines.
+func appendRawJSON(b []byte, raw []byte) ([]byte, error) {
+	if !json.Valid(raw) {
+		return nil, errors.New("codec: raw message is not valid JSON")
+	}
+	buf := bytes.NewBuffer(b)
+	_ = json.Compact(buf, raw)
+	return buf.Bytes(), nil
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b = append(b, '\\', byte(r))
+		case r == '\n':
+			b = append(b, '\\', 'n')
+		case r == '\r':
+			b = append(b, '\\', 'r')
+		case r == '\t':
+			b = append(b, '\\', 't')
+		case r < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+		default:
+			b = utf8.AppendRune(b, r) // invalid UTF-8 becomes U+FFFD
+		}
+	}
+	return append(b, '"')
+}
+
+// jsonParser parses a JSON document into nodes within limits.
+type jsonParser struct {
+	data   []byte
+	pos    int
+	depth  int
+	limits messages.DecoderLimits
+}
+
+// document parses data, which must hold exactly one value.
+func (p *jsonParser) document() (node, error) {
+	n, err := p.value()
+	if err != nil {
+		return node{}, err
+	}
+	p.space()
+	if p.pos < len(p.data) {
+		return node{}, p.syntaxError("data after the value")
+	}
+	return n, nil
+}
+
+func (p *jsonParser) value() (node, error) {
+	p.space()
+	if p.pos >= len(p.data) {
+		return node{}, p.syntaxError("unexpected end of data")
+	}
+	start := p.pos
+	var (
+		n   node
+		err error
+	)
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		n, err = p.object()
+	case c == '[':
+		n, err = p.array()
+	case c == '"':
+		var s string
+		if s, err = p.string(); err == nil {
+			n = node{kind: kindString, s: s}
+		}
+	case c == 't':
+		n, err = p.literal("true", node{kind: kindBool, b: true})
+	case c == 'f':
+		n, err = p.literal("false", node{kind: kindBool})
+	case c == 'n':
+		n, err = p.literal("null", node{})
+	case c == '-' || c >= '0' && c <= '9':
+		n, err = p.number()
+	default:
+		err = p.syntaxError(fmt.Sprintf("unexpected character %q", c))
+	}
+	n.raw = p.data[start:p.pos]
+	return n, err
+}
+
+func (p *jsonParser) nest() error {
+	p.depth++
+	if p.depth > p.limits.MaxNestedLevels {
+		return &messages.LimitError{Limit: "nesting depth", Max: p.limits.MaxNestedLevels}
+	}
+	p.pos++
+	return nil
+}
+
+func (p *jsonParser) array() (node, error) {
+	if err := p.nest(); err != nil {
+		return node{}, err
+	}
+	n := node{kind: kindArray}
+	if p.space(); p.peek() == ']' {
+		p.pos++
+		p.depth--
+		return n, nil
+	}
+	for {
+		if len(n.items) == p.limits.MaxArrayElements {
+			return node{}, &messages.LimitError{Limit: "array elements", Max: p.limits.MaxArrayElements}
+		}
+		item, err := p.value()
+		if err != nil {
+			return node{}, err
+		}
+		n.items = append(n.items, item)
+		p.space()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			p.depth--
+			return n, nil
+		default:
+			return node{}, p.syntaxError("expected , or ]")
+		}
+	}
+}
+
+func (p *jsonParser) object() (node, error) {
+	if err := p.nest(); err != nil {
+		return node{}, err
+	}
+	n := node{kind: kindMap}
+	if p.space(); p.peek() == '}' {
+		p.pos++
+		p.depth--
+		return n, nil
+	}
+	for {
+		if len(n.items)/2 == p.limits.MaxMapPairs {
+			return node{}, &messages.LimitError{Limit: "map pairs", Max: p.limits.MaxMapPairs}
+		}
+		if p.space(); p.peek() != '"' {
+			return node{}, p.syntaxError("expected an object key")
+		}
+		key, err := p.string()
+		if err != nil {
+			return node{}, err
+		}
+		if p.space(); p.peek() != ':' {
+			return node{}, p.syntaxError("expected :")
+		}
+		p.pos++
+		val, err := p.value()
+		if err != nil {
+			return node{}, err
+		}
+		n.items = append(n.items, node{kind: kindString, s: key}, val)
+		p.space()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			p.depth--
+			return n, nil
+		default:
+			return node{}, p.syntaxError("expected , or }")
+		}
+	}
+}
+
+func (p *jsonParser) string() (string, error) {
+	start := p.pos
+	escaped := false
+	for p.pos++; p.pos < len(p.data); p.pos++ {
+		switch c := p.data[p.pos]; {
+		case c == '\\':
+			escaped = true
+			p.pos++
+			continue
+		case c < 0x20:
+			return "", p.syntaxError("control character in string")
+		case c != '"':
+			continue
+		}
+		p.pos++
+		quoted := p.data[start:p.pos]
+		if max := p.limits.MaxStringLength; max > 0 && len(quoted)-2 > max {
+			return "", &messages.LimitError{Limit: "string length", Max: max}
+		}
+		if !utf8.Valid(quoted) {
+			return "", p.syntaxError("invalid UTF-8 in string")
+		}
+		if !escaped {
+			return string(quoted[1 : len(quoted)-1]), nil
+		}
+		var s string
+		if err := json.Unmarshal(quoted, &s); err != nil {
+			return "", p.syntaxError("invalid string")
+		}
+		return s, nil
+	}
+	return "", p.syntaxError("unterminated string")
+}
+
+func (p *jsonParser) number() (node, error) {
+	start, float := p.pos, false
+	for ; p.pos < len(p.data); p.pos++ {
+		c := p.data[p.pos]
+		if c == '.' || c == 'e' || c == 'E' {
+			float = true
+		} else if c != '-' && c != '+' && (c < '0' || c > '9') {
+			break
+		}
+	}
+	if !json.Valid(p.data[start:p.pos]) {
+		return node{}, p.syntaxError("invalid number " + string(p.data[start:p.pos]))
+	}
+	text := string(p.data[start:p.pos])
+	if !float {
+		if text[0] == '-' {
+			if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return intNode(i), nil
+			}
+		} else if u, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return node{kind: kindUint, u: u}, nil
+		}
+	}
+	f, _ := strconv.ParseFloat(text, 64) // out of range numbers become ±Inf
+	return node{kind: kindFloat, f: f}, nil
+}
+
+func (p *jsonParser) literal(text string, n node) (node, error) {
+	if !bytes.HasPrefix(p.data[p.pos:], []byte(text)) {
+		return node{}, p.syntaxError("invalid literal")
+	}
+	p.pos += len(text)
+	return n, nil
+}
+
+func (p *jsonParser) space() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) peek() byte {
+	if p.pos >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *jsonParser) syntaxError(msg string) error {
+	return fmt.Errorf("codec: invalid JSON at offset %d: %s", p.pos, msg)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestJSONMalformed(t *testing.T) {
+	tests := []struct {
+		name, data string
+	}{
+		{"empty", ""},
+		{"unterminated object", `{"a":1`},
+		{"trailing comma", `[1,]`},
+		{"missing colon", `{"a" 1}`},
+		{"non-string key", `{1:2}`},
+		{"two values", `1 2`},
+		{"unterminated string", `"abc`},
+		{"control character", "\"a\x01b\""},
+		{"raw newline", "\"a\nb\""},
+		{"invalid UTF-8", "\"\xff\""},
+		{"invalid UTF-8 with escapes", "\"\\n\xff\""},
+		{"invalid escape", `"\x"`},
+		{"leading zero", `01`},
+		{"bare minus", `-`},
+		{"trailing dot", `1.`},
+		{"bad exponent", `1e`},
+		{"bad literal", `tru`},
+		{"single quotes", `'a'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := codec.JSON.Unmarshal([]byte(tt.data), &v); err == nil {
+				t.Errorf("Unmarshal(%q) = %#v, want an error", tt.data, v)
+			}
+		})
+	}
+}
+
+func TestJSONValues(t *testing.T) {
+	tests := []struct {
+		data string
+		want any
+	}{
+		{`"plain"`, "plain"},
+		{`"esc\"aped\u00e9\n"`, "esc\"apedé\n"},
+		{`"zażółć"`, "zażółć"},
+		{`-0`, uint64(0)},
+		{`-12`, int64(-12)},
+		{`18446744073709551615`, uint64(math.MaxUint64)},
+		{`18446744073709551616`, 18446744073709551616.0},
+		{`1.5e3`, 1500.0},
+		{` [ true , false , null ] `, []any{true, false, nil}},
+	}
+	for _, tt := range tests {
+		var v any
+		if err := codec.JSON.Unmarshal([]byte(tt.data), &v); err != nil {
+			t.Errorf("Unmarshal(%q): %v", tt.data, err)
+			continue
+		}
+		if s, ok := v.([]any); ok {
+			want := tt.want.([]any)
+			if len(s) != len(want) || s[0] != want[0] || s[1] != want[1] || s[2] != nil {
+				t.Errorf("Unmarshal(%q) = %#v, want %#v", tt.data, v, tt.want)
+			}
+			continue
+		}
+		if v != tt.want {
+			t.Errorf("Unmarshal(%q) = %#v, want %#v", tt.data, v, tt.want)
+		}
+	}
+}
+
+func TestJSONEncodesStrings(t *testing.T) {
+	data, err := codec.JSON.Marshal("a\"\\\n\r\t\x01\x1fé\xff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"a\"\\\n\r\t\u0001\u001fé` + "\uFFFD" + `"`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	if _, err := codec.JSON.Marshal(math.Inf(1)); err == nil {
+		t.Error("Marshal accepted +Inf")
+	}
+}
+
+func TestJSONBase64(t *testing.T) {
+	data, err := codec.JSON.Marshal([]byte("bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"Ymlu"`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	var b []byte
+	if err := codec.JSON.Unmarshal([]byte(`"!!"`), &b); err == nil {
+		t.Error("Unmarshal accepted invalid base64")
+	}
+}
+
+func TestJSONDecoderLines(t *testing.T) {
+	stream := "\n{\"id\":1,\"type\":\"a\"}\r\n  \n{\"id\":2,\"type\":\"b\"}\n\n"
+	dec, err := codec.JSON.NewDecoder(strings.NewReader(stream), messages.DecoderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a", "b"} {
+		var msg messages.Envelope
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != want {
+			t.Errorf("got type %q, want %q", msg.Type, want)
+		}
+	}
+	var msg messages.Envelope
+	if err := dec.Decode(&msg); !errors.Is(err, io.EOF) {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func TestJSONDecoderMessageSize(t *testing.T) {
+	// A line longer than the limit is rejected without waiting for its end.
+	r := io.MultiReader(strings.NewReader(`"`), endless{})
+	dec, err := codec.JSON.NewDecoder(r, messages.DecoderLimits{MaxMessageSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := dec.Decode(&v); !errors.Is(err, messages.ErrLimitExceeded) {
+		t.Errorf("got %v, want messages.ErrLimitExceeded", err)
+	}
+}
+
+// endless is a line that never ends.
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+// FuzzJSONDecode checks that the JSON decoder rejects malformed input without panicking,
+// and that the values it accepts encode back to JSON that decodes the same way.
+func FuzzJSONDecode(f *testing.F) {
+	env := messages.Envelope{Version: messages.ProtocolVersion, ID: 2, Type: "ping", Raw: codec.MustMarshal(codec.JSON, map[string]any{"n": -1.5, "s": "a\"\n"})}
+	f.Add([]byte(codec.MustMarshal(codec.JSON, env)))
+	for _, seed := range []string{`null`, `[1,-2,3.5e10,"é",true,{}]`, `{"a":{"b":[]}}`, `"😀"`, `{"a":1,"a":2}`, `-1e400`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var env messages.Envelope
+		_ = codec.JSON.Unmarshal(data, &env)
+		if dec, err := codec.JSON.NewDecoder(bytes.NewReader(data), messages.DecoderLimits{}); err == nil {
+			for dec.Decode(&env) == nil {
+			}
+		}
+
+		var v any
+		if codec.JSON.Unmarshal(data, &v) != nil {
+			return
+		}
+		encoded, err := codec.JSON.Marshal(v)
+		if err != nil {
+			// Numbers out of range decode as ±Inf, which JSON cannot encode.
+			return
+		}
+		var again any
+		if err := codec.JSON.Unmarshal(encoded, &again); err != nil {
+			t.Fatalf("Unmarshal(%s) = %v", encoded, err)
+		}
+		if reencoded := codec.MustMarshal(codec.JSON, again); !bytes.Equal(reencoded, encoded) {
+			t.Errorf("%s decoded and encoded again as %s", encoded, reencoded)
+		}
+	})
+}
@@ -0,0 +1,457 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// msgpackCodec encodes messages as MessagePack, see MsgPack.
+//
+// Decoding accepts the whole format, except extension types other than timestamps,
+// which are decoded as Unix seconds.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	n, err := encoder{}.node(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgpack(nil, n)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	n, err := parseMsgpack(data)
+	if err != nil {
+		return err
+	}
+	return decoder{}.unmarshal(n, v)
+}
+
+func (msgpackCodec) unmarshalStrict(data []byte, v any) error {
+	n, err := parseMsgpack(data)
+	if err != nil {
+		return err
+	}
+	if err := duplicateKey(n, ""); err != nil {
+		return err
+	}
+	return decoder{}.unmarshal(n, v)
+}
+
+// parseMsgpack parses data holding a single MessagePack value.
+func parseMsgpack(data []byte) (node, error) {
+	p := msgpackParser{data: data, limits: messages.DecoderLimits{}.WithDefaults()}
+	n, err := p.value()
+	if err != nil {
+		return node{}, err
+	}
+	if p.pos < len(data) {
+		return node{}, fmt.Errorf("codec: invalid MessagePack: data after the value")
+	}
+	return n, nil
+}
+
+func (msgpackCodec) NewEncoder(w io.Writer) Encoder { return &msgpackEncoder{w: w} }
+
+func (msgpackCodec) NewDecoder(r io.Reader, limits messages.DecoderLimits) (Decoder, error) {
+	return &msgpackDecoder{r: bufio.NewReader(r), limits: limits.WithDefaults()}, nil
+}
+
+type msgpackEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (e *msgpackEncoder) Encode(v any) error {
+	n, err := encoder{}.node(reflect.ValueOf(v))
+	if err != nil {
+		return err
+	}
+	if e.buf, err = appendMsgpack(e.buf[:0], n); err != nil {
+		return err
+	}
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+// appendMsgpack appends the MessagePack encoding of n to b, using the shortest forms.
+func appendMsgpack(b []byte, n node) ([]byte, error) {
+	switch n.kind {
+	case kindNil:
+		return append(b, 0xc0), nil
+	case kindBool:
+		if n.b {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case kindUint:
+		switch u := n.u; {
+		case u <= 0x7f:
+			return append(b, byte(u)), nil
+		case u <= math.MaxUint8:
+			return append(b, 0xcc, byte(u)), nil
+		case u <= math.MaxUint16:
+			return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u)), nil
+		case u <= math.MaxUint32:
+			return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u)), nil
+		default:
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), u), nil
+		}
+	case kindInt:
+		switch i := n.i; {
+		case i >= -32:
+			return append(b, byte(i)), nil
+		case i >= math.MinInt8:
+			return append(b, 0xd0, byte(i)), nil
+		case i >= math.MinInt16:
+			return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i)), nil
+		case i >= math.MinInt32:
+			return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i)), nil
+		default:
+			return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i)), nil
+		}
+	case kindFloat:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(n.f)), nil
+	case kindString:
+		b = appendMsgpackHeader(b, len(n.s), 0xa0, 32, 0xd9)
+		return append(b, n.s...), nil
+	case kindBytes:
+		b = appendMsgpackHeader(b, len(n.bin), 0, 0, 0xc4)
+		return append(b, n.bin...), nil
+	case kindRaw:
+		p := msgpackParser{data: n.bin, limits: messages.DecoderLimits{}.WithDefaults()}
+		if _, err := p.value(); err != nil || p.pos < len(n.bin) {
+			return nil, errors.New("codec: raw message is not valid MessagePack")
+		}
+		return append(b, n.bin...), nil
+	case kindArray:
+		b = appendMsgpackHeader(b, len(n.items), 0x90, 16, 0xdc-1)
+		return appendMsgpackItems(b, n.items)
+	}
+	b = appendMsgpackHeader(b, len(n.items)/2, 0x80, 16, 0xde-1)
+	return appendMsgpackItems(b, n.items)
+}
+
+func appendMsgpackItems(b []byte, items []node) ([]byte, error) {
+	for _, item := range items {
+		var err error
+		if b, err = appendMsgpack(b, item); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendMsgpackHeader appends the header of a string, binary, array or map of n elements.
+// Lengths below fixMax use the fix form fix|n; longer ones the 8, 16 or 32-bit form starting
+// at code (arrays and maps have no 8-bit form, and pass the code preceding their 16-bit one).
+func appendMsgpackHeader(b []byte, n int, fix byte, fixMax int, code byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8 && fix != 0x90 && fix != 0x80:
+		return append(b, code, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code+1), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code+2), uint32(n))
+	}
+}
+
+type msgpackDecoder struct {
+	r      *bufio.Reader
+	limits messages.DecoderLimits
+	buf    []byte
+	left   int // bytes the message being read may still take
+}
+
+// Decode reads the next value of the stream within the limits, then decodes it into v.
+func (d *msgpackDecoder) Decode(v any) error {
+	d.buf, d.left = d.buf[:0], d.limits.MaxMessageSize
+	if err := d.item(0); err != nil {
+		if err == io.EOF && len(d.buf) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	p := msgpackParser{data: d.buf, limits: d.limits}
+	n, err := p.value()
+	if err != nil {
+		return err
+	}
+	return decoder{}.unmarshal(n, v)
+}
+
+func (d *msgpackDecoder) Buffered() io.Reader {
+	b, _ := d.r.Peek(d.r.Buffered())
+	return bytes.NewReader(bytes.Clone(b))
+}
+
+// read appends the next n bytes of the stream to the message being read.
+func (d *msgpackDecoder) read(n int) ([]byte, error) {
+	if n > d.left {
+		return nil, &messages.LimitError{Limit: "message size", Max: d.limits.MaxMessageSize}
+	}
+	d.left -= n
+	start := len(d.buf)
+	d.buf = append(d.buf, make([]byte, n)...)
+	if _, err := io.ReadFull(d.r, d.buf[start:]); err != nil {
+		d.buf = d.buf[:start]
+		return nil, err
+	}
+	return d.buf[start:], nil
+}
+
+// item reads one complete value at the given nesting depth, checking the limits before
+// anything is allocated for it.
+func (d *msgpackDecoder) item(depth int) error {
+	head, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	h := msgpackHead(head[0])
+	if h.lenSize > 0 {
+		b, err := d.read(h.lenSize)
+		if err != nil {
+			return err
+		}
+		h.length = readLength(b)
+	}
+	if err := h.check(depth, d.limits); err != nil {
+		return err
+	}
+	if h.ext && h.lenSize > 0 {
+		h.length++ // the extension type
+	}
+	if h.elements == 0 {
+		_, err := d.read(h.length)
+		return err
+	}
+	for range h.length * h.elements {
+		if err := d.item(depth + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackHeader describes a MessagePack value by its first byte.
+type msgpackHeader struct {
+	code     byte
+	lenSize  int // size of the length following the first byte
+	length   int // fixed length, or the length read
+	elements int // nested values per length unit: 1 for arrays, 2 for maps, 0 for bytes
+	kind     kind
+	ext      bool
+}
+
+func msgpackHead(c byte) msgpackHeader {
+	h := msgpackHeader{code: c}
+	switch {
+	case c <= 0x7f:
+		h.kind = kindUint
+	case c >= 0xe0:
+		h.kind = kindInt
+	case c <= 0x8f:
+		h.kind, h.length, h.elements = kindMap, int(c&0x0f), 2
+	case c <= 0x9f:
+		h.kind, h.length, h.elements = kindArray, int(c&0x0f), 1
+	case c <= 0xbf:
+		h.kind, h.length = kindString, int(c&0x1f)
+	}
+	switch c {
+	case 0xc0:
+		h.kind = kindNil
+	case 0xc2, 0xc3:
+		h.kind = kindBool
+	case 0xc4, 0xc5, 0xc6:
+		h.kind, h.lenSize = kindBytes, 1<<(c-0xc4)
+	case 0xc7, 0xc8, 0xc9:
+		h.lenSize, h.ext = 1<<(c-0xc7), true
+	case 0xca:
+		h.kind, h.length = kindFloat, 4
+	case 0xcb:
+		h.kind, h.length = kindFloat, 8
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		h.kind, h.length = kindUint, 1<<(c-0xcc)
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		h.kind, h.length = kindInt, 1<<(c-0xd0)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		h.length, h.ext = 1+1<<(c-0xd4), true
+	case 0xd9, 0xda, 0xdb:
+		h.kind, h.lenSize = kindString, 1<<(c-0xd9)
+	case 0xdc, 0xdd:
+		h.kind, h.lenSize, h.elements = kindArray, 2<<(c-0xdc), 1
+	case 0xde, 0xdf:
+		h.kind, h.lenSize, h.elements = kindMap, 2<<(c-0xde), 2
+	case 0xc1:
+		h.length = -1 // never used
+	}
+	return h
+}
+
+// check validates the header against the limits, once its length is known.
+func (h *msgpackHeader) check(depth int, limits messages.DecoderLimits) error {
+	switch {
+	case h.length < 0:
+		return fmt.Errorf("codec: invalid MessagePack: reserved code 0x%x", h.code)
+	case h.elements > 0 && depth >= limits.MaxNestedLevels:
+		return &messages.LimitError{Limit: "nesting depth", Max: limits.MaxNestedLevels}
+	case h.kind == kindArray && h.length > limits.MaxArrayElements:
+		return &messages.LimitError{Limit: "array elements", Max: limits.MaxArrayElements}
+	case h.kind == kindMap && h.length > limits.MaxMapPairs:
+		return &messages.LimitError{Limit: "map pairs", Max: limits.MaxMapPairs}
+	case (h.kind == kindString || h.kind == kindBytes) && limits.MaxStringLength > 0 && h.length > limits.MaxStringLength:
+		return &messages.LimitError{Limit: "string length", Max: limits.MaxStringLength}
+	}
+	return nil
+}
+
+func readLength(b []byte) int {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return int(n)
+}
+
+// msgpackParser parses a complete MessagePack value into nodes within limits.
+type msgpackParser struct {
+	data   []byte
+	pos    int
+	depth  int
+	limits messages.DecoderLimits
+}
+
+func (p *msgpackParser) next(n int) ([]byte, error) {
+	if n < 0 || n > len(p.data)-p.pos {
+		return nil, fmt.Errorf("codec: invalid MessagePack: unexpected end of data")
+	}
+	b := p.data[p.pos : p.pos+n]
+	p.pos += n
+	return b, nil
+}
+
+func (p *msgpackParser) value() (node, error) {
+	start := p.pos
+	head, err := p.next(1)
+	if err != nil {
+		return node{}, err
+	}
+	h := msgpackHead(head[0])
+	if h.lenSize > 0 {
+		b, err := p.next(h.lenSize)
+		if err != nil {
+			return node{}, err
+		}
+		h.length = readLength(b)
+	}
+	if err := h.check(p.depth, p.limits); err != nil {
+		return node{}, err
+	}
+
+	n := node{kind: h.kind}
+	switch {
+	case h.ext:
+		n, err = p.ext(h)
+	case h.elements > 0:
+		p.depth++
+		n.items = make([]node, 0, min(h.length*h.elements, len(p.data)-p.pos))
+		for range h.length * h.elements {
+			item, err := p.value()
+			if err != nil {
+				return node{}, err
+			}
+			n.items = append(n.items, item)
+		}
+		p.depth--
+	case h.kind == kindNil:
+	case h.kind == kindBool:
+		n.b = h.code == 0xc3
+	case h.code <= 0x7f:
+		n.u = uint64(h.code)
+	case h.code >= 0xe0:
+		n = intNode(int64(int8(h.code)))
+	default:
+		var b []byte
+		if b, err = p.next(h.length); err != nil {
+			return node{}, err
+		}
+		switch h.kind {
+		case kindString:
+			n.s = string(b)
+		case kindBytes:
+			n.bin = b
+		case kindUint:
+			n.u = readUint(b)
+		case kindInt:
+			n = intNode(signExtend(readUint(b), len(b)))
+		case kindFloat:
+			if len(b) == 4 {
+				n.f = float64(math.Float32frombits(uint32(readUint(b))))
+			} else {
+				n.f = math.Float64frombits(readUint(b))
+			}
+		}
+	}
+	if err != nil {
+		return node{}, err
+	}
+	n.raw = p.data[start:p.pos]
+	return n, nil
+}
+
+// ext parses an extension value. Only timestamps (type -1) are supported.
+func (p *msgpackParser) ext(h msgpackHeader) (node, error) {
+	typ, err := p.next(1)
+	if err != nil {
+		return node{}, err
+	}
+	size := h.length - 1
+	if h.lenSize > 0 {
+		size = h.length
+	}
+	data, err := p.next(size)
+	if err != nil {
+		return node{}, err
+	}
+	if int8(typ[0]) != -1 {
+		return node{}, fmt.Errorf("codec: unsupported MessagePack extension type %d", int8(typ[0]))
+	}
+	switch len(data) {
+	case 4:
+		return node{kind: kindUint, u: readUint(data)}, nil
+	case 8:
+		return node{kind: kindUint, u: readUint(data) & (1<<34 - 1)}, nil
+	case 12:
+		return intNode(int64(readUint(data[4:]))), nil
+	}
+	return node{}, fmt.Errorf("codec: invalid MessagePack timestamp")
+}
+
+func readUint(b []byte) uint64 {
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u
+}
+
+// signExtend interprets the low size bytes of u as a two's complement integer.
+func signExtend(u uint64, size int) int64 {
+	shift := 64 - 8*size
+	return int64(u<<shift) >> shift
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestMsgPackMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"reserved code", []byte{0xc1}},
+		{"missing length", []byte{0xd9}},
+		{"short string", []byte{0xa3, 'a'}},
+		{"short uint", []byte{0xcd, 0x01}},
+		{"short array", []byte{0x92, 0x01}},
+		{"short map", []byte{0x81, 0xa1, 'k'}},
+		{"huge string length", []byte{0xdb, 0xff, 0xff, 0xff, 0xff, 'a'}},
+		{"two values", []byte{0x01, 0x02}},
+		{"unknown extension", []byte{0xd4, 0x05, 0x00}},
+		{"bad timestamp", []byte{0xc7, 0x03, 0xff, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := codec.MsgPack.Unmarshal(tt.data, &v); err == nil {
+				t.Errorf("Unmarshal(% x) = %#v, want an error", tt.data, v)
+			}
+		})
+	}
+}
+
+func TestMsgPackValues(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want any
+	}{
+		{"positive fixint", []byte{0x05}, uint64(5)},
+		{"negative fixint", []byte{0xff}, int64(-1)},
+		{"int8", []byte{0xd0, 0x80}, int64(-128)},
+		{"int64 positive", []byte{0xd3, 0, 0, 0, 0, 0, 0, 0, 1}, uint64(1)},
+		{"uint64", []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, uint64(math.MaxUint64)},
+		{"float32", []byte{0xca, 0x3f, 0xc0, 0, 0}, 1.5},
+		{"str8", append([]byte{0xd9, 3}, "abc"...), "abc"},
+		{"bin8", []byte{0xc4, 2, 0xde, 0xad}, []byte{0xde, 0xad}},
+		{"array16", []byte{0xdc, 0, 2, 0xc3, 0xc0}, []any{true, nil}},
+		{"map16", []byte{0xde, 0, 1, 0xa1, 'k', 0x07}, map[any]any{"k": uint64(7)}},
+		{"timestamp32", []byte{0xd6, 0xff, 0, 0, 0, 42}, uint64(42)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v any
+			if err := codec.MsgPack.Unmarshal(tt.data, &v); err != nil {
+				t.Fatalf("Unmarshal(% x): %v", tt.data, err)
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("Unmarshal(% x) = %#v, want %#v", tt.data, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgPackShortestForms(t *testing.T) {
+	tests := []struct {
+		value any
+		head  []byte
+	}{
+		{uint8(127), []byte{0x7f}},
+		{128, []byte{0xcc, 0x80}},
+		{-32, []byte{0xe0}},
+		{-33, []byte{0xd0, 0xdf}},
+		{strings.Repeat("a", 31), []byte{0xbf}},
+		{strings.Repeat("a", 32), []byte{0xd9, 32}},
+		{strings.Repeat("a", 256), []byte{0xda, 1, 0}},
+		{make([]int, 15), []byte{0x9f}},
+		{make([]int, 16), []byte{0xdc, 0, 16}},
+		{[]byte{1}, []byte{0xc4, 1}},
+	}
+	for _, tt := range tests {
+		data, err := codec.MsgPack.Marshal(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, tt.head) {
+			t.Errorf("Marshal(%.8v) starts with % x, want % x", tt.value, data[:min(len(data), 3)], tt.head)
+		}
+	}
+}
+
+func TestMsgPackTimestamp(t *testing.T) {
+	var at time.Time
+	if err := codec.MsgPack.Unmarshal([]byte{0xd6, 0xff, 0x65, 0x53, 0xf1, 0x00}, &at); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(0x6553f100, 0); !at.Equal(want) {
+		t.Errorf("got %v, want %v", at, want)
+	}
+}
+
+func TestMsgPackDecoderStopsEarly(t *testing.T) {
+	// The limits are checked against the header, before the value arrives.
+	r := io.MultiReader(bytes.NewReader([]byte{0xdd, 0x7f, 0xff, 0xff, 0xff}), endless{})
+	dec, err := codec.MsgPack.NewDecoder(r, messages.DecoderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := dec.Decode(&v); !errors.Is(err, messages.ErrLimitExceeded) {
+		t.Errorf("got %v, want messages.ErrLimitExceeded", err)
+	}
+}
+
+// FuzzMsgPackDecode checks that the MessagePack decoder rejects malformed input without
+// panicking, and that the values it accepts encode back to data that decodes the same way.
+func FuzzMsgPackDecode(f *testing.F) {
+	env := messages.Envelope{Version: messages.ProtocolVersion, ID: 2, Type: "ping", Raw: codec.MustMarshal(codec.MsgPack, map[string]any{"n": -1.5, "b": []byte{1}})}
+	f.Add([]byte(codec.MustMarshal(codec.MsgPack, env)))
+	f.Add([]byte{0xc0})
+	f.Add([]byte{0x93, 0xff, 0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xca, 0x3f, 0xc0, 0, 0})
+	f.Add([]byte{0xd6, 0xff, 0, 0, 0, 1})
+	f.Add([]byte{0x82, 0x01, 0xa1, 'a', 0x01, 0xa1, 'b'})
+	f.Add([]byte{0x82, 0xa1, '0', 0x01, 0x00, 0x02})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var env messages.Envelope
+		_ = codec.MsgPack.Unmarshal(data, &env)
+		if dec, err := codec.MsgPack.NewDecoder(bytes.NewReader(data), messages.DecoderLimits{}); err == nil {
+			for dec.Decode(&env) == nil {
+			}
+		}
+
+		var v any
+		if codec.MsgPack.Unmarshal(data, &v) != nil {
+			return
+		}
+		encoded, err := codec.MsgPack.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal(%#v) = %v", v, err)
+		}
+		var again any
+		if err := codec.MsgPack.Unmarshal(encoded, &again); err != nil {
+			t.Fatalf("Unmarshal(% x) = %v", encoded, err)
+		}
+		if reencoded := codec.MustMarshal(codec.MsgPack, again); !bytes.Equal(reencoded, encoded) {
+			t.Errorf("% x decoded and encoded again as % x", encoded, reencoded)
+		}
+	})
+}
@@ -0,0 +1,761 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package codec
+
+import (
+	"cmp"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// kind is the type of a node.
+type kind uint8
+
+const (
+	kindNil kind = iota
+	kindBool
+	kindInt // negative integers
+	kindUint
+	kindFloat
+	kindString
+	kindBytes
+	kindArray
+	kindMap
+	kindRaw // an embedded messages.RawMessage, only produced by encoding
+)
+
+// node is a value of the JSON and MsgPack codecs, between a Go value and its encoding.
+type node struct {
+	kind  kind
+	b     bool
+	i     int64
+	u     uint64
+	f     float64
+	s     string
+	bin   []byte // bytes, or the embedded encoding of kindRaw
+	items []node // array elements, or map keys and values in turns
+	raw   []byte // the encoding the node was parsed from
+}
+
+// DecodeError reports a value that does not fit the Go type it is decoded into.
+type DecodeError struct {
+	Field string // path of the offending field, e.g. "user.emails[1]"; empty for the top-level value
+	Msg   string
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return "cannot decode " + e.Msg
+	}
+	return "cannot decode field " + e.Field + ": " + e.Msg
+}
+
+var (
+	rawType  = reflect.TypeFor[messages.RawMessage]()
+	timeType = reflect.TypeFor[time.Time]()
+)
+
+// encoder converts Go values into nodes.
+type encoder struct {
+	// json tells that the nodes are encoded as JSON, so json.Marshaler is used.
+	json bool
+}
+
+// field is a struct field as encoded by the JSON and MsgPack codecs.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type -> []field
+
+// fieldsOf returns the encoded fields of struct type t, named like CBOR names them:
+// by the cbor tag, else the json tag, else the field name. Embedded structs without a tag are
+// flattened, fields tagged "-" and unexported fields are skipped.
+func fieldsOf(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	var all []field
+	collectFields(t, nil, &all)
+
+	// Shallower fields win over flattened ones of the same name.
+	shallowest := make(map[string]int, len(all))
+	for i, f := range all {
+		if j, ok := shallowest[f.name]; !ok || len(f.index) < len(all[j].index) {
+			shallowest[f.name] = i
+		}
+	}
+	var fields []field
+	for i, f := range all {
+		if shallowest[f.name] == i {
+			fields = append(fields, f)
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, fields *[]field) {
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("cbor")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		idx := append(slices.Clone(index), i)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			collectFields(ft, idx, fields)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		*fields = append(*fields, field{
+			name:      name,
+			index:     idx,
+			omitEmpty: slices.Contains(strings.Split(opts, ","), "omitempty"),
+		})
+	}
+}
+
+// node converts a Go value into a node.
+func (e encoder) node(v reflect.Value) (node, error) {
+	if !v.IsValid() {
+		return node{}, nil
+	}
+	switch v.Type() {
+	case rawType:
+		if v.Len() == 0 {
+			return node{}, nil
+		}
+		return node{kind: kindRaw, bin: v.Bytes()}, nil
+	case timeType:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return node{}, nil
+		}
+		return intNode(t.Unix()), nil
+	}
+
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return node{}, nil
+		}
+		return e.node(v.Elem())
+	}
+	if n, ok, err := e.custom(v); ok {
+		return n, err
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return node{kind: kindBool, b: v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intNode(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return node{kind: kindUint, u: v.Uint()}, nil
+	case reflect.Float32, reflect.Float64:
+		return node{kind: kindFloat, f: v.Float()}, nil
+	case reflect.String:
+		return node{kind: kindString, s: v.String()}, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return node{}, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return node{kind: kindBytes, bin: v.Bytes()}, nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return node{kind: kindBytes, bin: b}, nil
+		}
+		return e.array(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return node{}, nil
+		}
+		return e.mapNode(v)
+	case reflect.Struct:
+		return e.structNode(v)
+	}
+	return node{}, fmt.Errorf("codec: unsupported type %s", v.Type())
+}
+
+// custom encodes v with its own encoding method, if it has one the codec uses: MarshalJSON
+// for JSON, and MarshalText, whose result is encoded as a string, for both codecs.
+func (e encoder) custom(v reflect.Value) (node, bool, error) {
+	if v.CanAddr() {
+		v = v.Addr()
+	}
+	if !v.CanInterface() {
+		return node{}, false, nil
+	}
+	if m, ok := v.Interface().(json.Marshaler); ok && e.json {
+		b, err := m.MarshalJSON()
+		if err != nil {
+			return node{}, true, fmt.Errorf("codec: %s: %w", v.Type(), err)
+		}
+		return node{kind: kindRaw, bin: b}, true, nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err != nil {
+			return node{}, true, fmt.Errorf("codec: %s: %w", v.Type(), err)
+		}
+		return node{kind: kindString, s: string(b)}, true, nil
+	}
+	return node{}, false, nil
+}
+
+func intNode(i int64) node {
+	if i < 0 {
+		return node{kind: kindInt, i: i}
+	}
+	return node{kind: kindUint, u: uint64(i)}
+}
+
+func (e encoder) array(v reflect.Value) (node, error) {
+	n := node{kind: kindArray, items: make([]node, v.Len())}
+	for i := range v.Len() {
+		item, err := e.node(v.Index(i))
+		if err != nil {
+			return node{}, err
+		}
+		n.items[i] = item
+	}
+	return n, nil
+}
+
+func (e encoder) mapNode(v reflect.Value) (node, error) {
+	keys := v.MapKeys()
+	// Sort the keys, so that equal maps are encoded the same way. Keys of interface maps
+	// printing the same, e.g. 0 and "0", are told apart by their types.
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return cmp.Or(
+			cmp.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface())),
+			cmp.Compare(fmt.Sprintf("%T", a.Interface()), fmt.Sprintf("%T", b.Interface())),
+		)
+	})
+	n := node{kind: kindMap, items: make([]node, 0, 2*len(keys))}
+	for _, key := range keys {
+		k, err := encoder{}.node(key) // keys are text, even in JSON
+		if err != nil {
+			return node{}, err
+		}
+		val, err := e.node(v.MapIndex(key))
+		if err != nil {
+			return node{}, err
+		}
+		n.items = append(n.items, k, val)
+	}
+	return n, nil
+}
+
+func (e encoder) structNode(v reflect.Value) (node, error) {
+	fields := fieldsOf(v.Type())
+	n := node{kind: kindMap, items: make([]node, 0, 2*len(fields))}
+	for _, f := range fields {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			continue // behind a nil embedded pointer
+		}
+		if f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+		val, err := e.node(fv)
+		if err != nil {
+			return node{}, err
+		}
+		n.items = append(n.items, node{kind: kindString, s: f.name}, val)
+	}
+	return n, nil
+}
+
+// isEmpty reports whether v is omitted by omitempty.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	case reflect.Struct:
+		return v.Type() == timeType && v.IsZero()
+	}
+	return false
+}
+
+// decoder decodes nodes into Go values.
+type decoder struct {
+	// json tells that the nodes were parsed from JSON: byte strings arrive as base64 text,
+	// as JSON has no byte strings, and json.Unmarshaler is used.
+	json bool
+}
+
+// decode stores n in the settable value v. path names v in errors.
+func (d decoder) decode(n node, v reflect.Value, path string) error {
+	switch v.Type() {
+	case rawType:
+		v.SetBytes(slices.Clone(n.raw))
+		return nil
+	case timeType:
+		return d.decodeTime(n, v, path)
+	}
+
+	if n.kind == kindNil {
+		v.SetZero()
+		return nil
+	}
+	if ok, err := d.custom(n, v, path); ok {
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(n, v.Elem(), path)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return mismatch(n, v, path)
+		}
+		val, err := d.natural(n)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(val))
+		return nil
+	case reflect.Bool:
+		if n.kind != kindBool {
+			return mismatch(n, v, path)
+		}
+		v.SetBool(n.b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := n.int()
+		if !ok || v.OverflowInt(i) {
+			return mismatch(n, v, path)
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, ok := n.uint()
+		if !ok || v.OverflowUint(u) {
+			return mismatch(n, v, path)
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch n.kind {
+		case kindFloat:
+			v.SetFloat(n.f)
+		case kindUint:
+			v.SetFloat(float64(n.u))
+		case kindInt:
+			v.SetFloat(float64(n.i))
+		default:
+			return mismatch(n, v, path)
+		}
+		return nil
+	case reflect.String:
+		switch n.kind {
+		case kindString:
+			v.SetString(n.s)
+		case kindBytes:
+			v.SetString(string(n.bin))
+		default:
+			return mismatch(n, v, path)
+		}
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.bytes(n, v, path)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		if n.kind != kindArray {
+			return mismatch(n, v, path)
+		}
+		s := reflect.MakeSlice(v.Type(), len(n.items), len(n.items))
+		for i, item := range n.items {
+			if err := d.decode(item, s.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.bytes(n, v, path)
+			if err != nil {
+				return err
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		if n.kind != kindArray || len(n.items) > v.Len() {
+			return mismatch(n, v, path)
+		}
+		for i, item := range n.items {
+			if err := d.decode(item, v.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		return d.decodeMap(n, v, path)
+	case reflect.Struct:
+		return d.decodeStruct(n, v, path)
+	}
+	return mismatch(n, v, path)
+}
+
+// custom decodes n with the decoding method of v, if it has one the codec uses:
+// UnmarshalJSON for JSON, and UnmarshalText, which takes a string, for both codecs.
+func (d decoder) custom(n node, v reflect.Value, path string) (bool, error) {
+	if v.Kind() == reflect.Pointer || !v.CanAddr() || !v.Addr().CanInterface() {
+		return false, nil
+	}
+	var err error
+	switch u := v.Addr().Interface().(type) {
+	case json.Unmarshaler:
+		if !d.json {
+			return d.customText(n, v, path)
+		}
+		err = u.UnmarshalJSON(n.raw)
+	case encoding.TextUnmarshaler:
+		return d.customText(n, v, path)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return true, &DecodeError{Field: strings.TrimPrefix(path, "."), Msg: err.Error()}
+	}
+	return true, nil
+}
+
+func (d decoder) customText(n node, v reflect.Value, path string) (bool, error) {
+	u, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	if !ok {
+		return false, nil
+	}
+	if n.kind != kindString {
+		return true, mismatch(n, v, path)
+	}
+	if err := u.UnmarshalText([]byte(n.s)); err != nil {
+		return true, &DecodeError{Field: strings.TrimPrefix(path, "."), Msg: err.Error()}
+	}
+	return true, nil
+}
+
+func (d decoder) decodeTime(n node, v reflect.Value, path string) error {
+	var t time.Time
+	switch n.kind {
+	case kindNil:
+	case kindUint, kindInt:
+		i, ok := n.int()
+		if !ok {
+			return mismatch(n, v, path)
+		}
+		t = time.Unix(i, 0)
+	case kindFloat:
+		sec, frac := math.Modf(n.f)
+		t = time.Unix(int64(sec), int64(frac*1e9))
+	case kindString:
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, n.s); err != nil {
+			return &DecodeError{Field: strings.TrimPrefix(path, "."), Msg: err.Error()}
+		}
+	default:
+		return mismatch(n, v, path)
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+func (d decoder) bytes(n node, v reflect.Value, path string) ([]byte, error) {
+	switch {
+	case n.kind == kindBytes:
+		return slices.Clone(n.bin), nil
+	case n.kind == kindString && d.json:
+		b, err := base64.StdEncoding.DecodeString(n.s)
+		if err != nil {
+			return nil, &DecodeError{Field: strings.TrimPrefix(path, "."), Msg: "invalid base64 data"}
+		}
+		return b, nil
+	case n.kind == kindString:
+		return []byte(n.s), nil
+	}
+	return nil, mismatch(n, v, path)
+}
+
+func (d decoder) decodeMap(n node, v reflect.Value, path string) error {
+	if n.kind != kindMap {
+		return mismatch(n, v, path)
+	}
+	t := v.Type()
+	m := reflect.MakeMapWithSize(t, len(n.items)/2)
+	for i := 0; i < len(n.items); i += 2 {
+		key := reflect.New(t.Key()).Elem()
+		if err := d.decodeKey(n.items[i], key, path); err != nil {
+			return err
+		}
+		val := reflect.New(t.Elem()).Elem()
+		if err := d.decode(n.items[i+1], val, path+"["+strconv.Quote(fmt.Sprint(key.Interface()))+"]"); err != nil {
+			return err
+		}
+		m.SetMapIndex(key, val)
+	}
+	v.Set(m)
+	return nil
+}
+
+// decodeKey decodes a map key, accepting the text form of numeric keys, as JSON only has text keys.
+func (d decoder) decodeKey(n node, v reflect.Value, path string) error {
+	if ok, err := d.customText(n, v, path); ok {
+		return err
+	}
+	if n.kind == kindString {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if i, err := strconv.ParseInt(n.s, 10, 64); err == nil && !v.OverflowInt(i) {
+				v.SetInt(i)
+				return nil
+			}
+			return mismatch(n, v, path)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if u, err := strconv.ParseUint(n.s, 10, 64); err == nil && !v.OverflowUint(u) {
+				v.SetUint(u)
+				return nil
+			}
+			return mismatch(n, v, path)
+		}
+	}
+	return d.decode(n, v, path)
+}
+
+func (d decoder) decodeStruct(n node, v reflect.Value, path string) error {
+	if n.kind != kindMap {
+		return mismatch(n, v, path)
+	}
+	fields := fieldsOf(v.Type())
+	for i := 0; i < len(n.items); i += 2 {
+		key := n.items[i]
+		if key.kind != kindString {
+			continue
+		}
+		// Prefer the exact name, like CBOR does, then any case.
+		j := slices.IndexFunc(fields, func(f field) bool { return f.name == key.s })
+		if j < 0 {
+			j = slices.IndexFunc(fields, func(f field) bool { return strings.EqualFold(f.name, key.s) })
+		}
+		if j < 0 {
+			continue // unknown fields are ignored
+		}
+		if err := d.decode(n.items[i+1], fieldByIndex(v, fields[j].index), path+"."+fields[j].name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex returns the nested field of v, allocating nil embedded pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// natural returns n as the value CBOR decodes into an empty interface.
+func (d decoder) natural(n node) (any, error) {
+	switch n.kind {
+	case kindNil:
+		return nil, nil
+	case kindBool:
+		return n.b, nil
+	case kindInt:
+		return n.i, nil
+	case kindUint:
+		return n.u, nil
+	case kindFloat:
+		return n.f, nil
+	case kindString:
+		return n.s, nil
+	case kindBytes:
+		return slices.Clone(n.bin), nil
+	case kindArray:
+		items := make([]any, len(n.items))
+		for i, item := range n.items {
+			val, err := d.natural(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = val
+		}
+		return items, nil
+	case kindMap:
+		m := make(map[any]any, len(n.items)/2)
+		for i := 0; i < len(n.items); i += 2 {
+			key, err := d.natural(n.items[i])
+			if err != nil {
+				return nil, err
+			}
+			switch k := key.(type) {
+			case []byte:
+				key = string(k)
+			case []any, map[any]any:
+				return nil, &DecodeError{Msg: "map with a composite key"}
+			}
+			val, err := d.natural(n.items[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	}
+	return nil, &DecodeError{Msg: "unknown value"}
+}
+
+// DuplicateKeyError reports a map holding the same key twice, see UnmarshalStrict.
+type DuplicateKeyError struct {
+	Field string // path of the repeated key, e.g. "user.name"
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return "codec: duplicate key " + e.Field
+}
+
+// duplicateKey returns a *DuplicateKeyError for the first map within n holding a key twice.
+// Keys are compared the way they are decoded into an empty interface. path names n.
+func duplicateKey(n node, path string) error {
+	switch n.kind {
+	case kindArray:
+		for i, item := range n.items {
+			if err := duplicateKey(item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case kindMap:
+		seen := make(map[any]bool, len(n.items)/2)
+		for i := 0; i < len(n.items); i += 2 {
+			key, err := decoder{}.natural(n.items[i])
+			if err != nil {
+				continue // composite keys are left to the decoder
+			}
+			if b, ok := key.([]byte); ok {
+				key = string(b)
+			}
+			keyPath := path + "[" + strconv.Quote(fmt.Sprint(key)) + "]"
+			if s, ok := key.(string); ok {
+				keyPath = path + "." + s
+			}
+			if seen[key] {
+				return &DuplicateKeyError{Field: strings.TrimPrefix(keyPath, ".")}
+			}
+			seen[key] = true
+			if err := duplicateKey(n.items[i+1], keyPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (n node) int() (int64, bool) {
+	switch n.kind {
+	case kindInt:
+		return n.i, true
+	case kindUint:
+		return int64(n.u), n.u <= math.MaxInt64
+	case kindFloat:
+		return int64(n.f), n.f == math.Trunc(n.f) && math.Abs(n.f) < 1<<63
+	}
+	return 0, false
+}
+
+func (n node) uint() (uint64, bool) {
+	switch n.kind {
+	case kindUint:
+		return n.u, true
+	case kindFloat:
+		return uint64(n.f), n.f >= 0 && n.f == math.Trunc(n.f) && n.f < 1<<64
+	}
+	return 0, false
+}
+
+// mismatch returns the error for a node that does not fit v.
+func mismatch(n node, v reflect.Value, path string) error {
+	return &DecodeError{Field: strings.TrimPrefix(path, "."), Msg: n.describe() + " into " + v.Type().String()}
+}
+
+func (n node) describe() string {
+	switch n.kind {
+	case kindNil:
+		return "null"
+	case kindBool:
+		return "bool"
+	case kindInt, kindUint:
+		return "integer"
+	case kindFloat:
+		return "number"
+	case kindString:
+		return "string"
+	case kindBytes:
+		return "byte string"
+	case kindArray:
+		return "array"
+	}
+	return "map"
+}
+
+// unmarshal decodes the parsed value n into the value pointed to by v.
+func (d decoder) unmarshal(n node, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("codec: cannot decode into %T", v)
+	}
+	return d.decode(n, rv.Elem(), "")
+}
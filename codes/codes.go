@@ -21,6 +21,39 @@ package codes
 type MessageCode string
 
 const (
+	// HelloMessage carries the handshake (messages.Hello) exchanged by the host and
+	// the plug before any other message.
+	HelloMessage MessageCode = "PLUGKIT_Hello"
+
+	// VersionUnsupported rejects an envelope whose protocol version is not spoken by the
+	// receiver. The payload is messages.VersionUnsupported.
+	VersionUnsupported MessageCode = "PLUGKIT_VersionUnsupported"
+
+	// CancelMessage tells the plug that the host abandoned the request with the ID
+	// carried in messages.Cancel, e.g. because its context expired.
+	CancelMessage MessageCode = "PLUGKIT_Cancel"
+
+	// PingMessage is a heartbeat sent by the host. Plug runtimes answer it with PongMessage
+	// on their own, while handlers keep running. The payload is messages.Ping.
+	PingMessage MessageCode = "PLUGKIT_Ping"
+
+	// PongMessage answers a PingMessage. The payload is messages.Pong.
+	PongMessage MessageCode = "PLUGKIT_Pong"
+
+	// CallMessage is sent by the plug to call a host service, e.g. while it serves a command.
+	// The payload is messages.Call.
+	CallMessage MessageCode = "PLUGKIT_Call"
+
+	// CallResultMessage answers a CallMessage. The payload is messages.CallResult.
+	CallResultMessage MessageCode = "PLUGKIT_CallResult"
+
+	// DescribeMessage asks the plug to describe itself. Plug runtimes answer it with
+	// DescriptionMessage on their own. The payload is messages.Describe.
+	DescribeMessage MessageCode = "PLUGKIT_Describe"
+
+	// DescriptionMessage answers a DescribeMessage. The payload is messages.Description.
+	DescriptionMessage MessageCode = "PLUGKIT_Description"
+
 	// ExitMessage indicates that the host intends plug to exit or shut down.
 	ExitMessage MessageCode = "PLUGKIT_Exit"
 
@@ -33,10 +66,18 @@ const (
 
 	// PluginResponse was intended to indicate a direct response from the plugin
 	// to a request, but is currently unused. FIXME: Consider removing or implementing it.
-	PluginResponse   MessageCode = "PLUGKIT_Response"
+	PluginResponse MessageCode = "PLUGKIT_Response"
+
+	// PayloadMalformed rejects a host message whose payload does not decode into, or fails the
+	// validation of, the request type of its handler. The payload is a messages.Error with
+	// codes.DataFormatError, listing the offending fields in Details["fields"]. Raw plugs also
+	// send it, answering no message, with messages.MessageUnsupported for envelopes they cannot decode.
 	PayloadMalformed MessageCode = "PLUGKIT_PayloadMalformed"
-	PluginCrashed    MessageCode = "PLUGKIT_PluginCrashed"
 	HandlingError    MessageCode = "PLUGKIT_HandlingError"
+
+	// PluginCrashed answers a host message whose handler panicked in the plug.
+	// The payload is messages.PluginCrash.
+	PluginCrashed MessageCode = "PLUGKIT_PluginCrashed"
 )
 
 // PluginExitReason defines standard exit codes used by plugins in the PlugKit system.
@@ -67,27 +108,33 @@ const (
 	PlugNotStarted                                         // Plugin was not started when expected
 	PlugCrashed                                            // Plugin crashed or exited abnormally
 
-	/// POSIX-aligned exit codes (based on sysexits.h)
-
-	DataFormatError           = 65 // EX_DATAERR: The input data was incorrect in some way
-	ErrNoInput                = 66 // EX_NOINPUT: Cannot open input
-	ErrServiceUnavailable     = 69 // EX_UNAVAILABLE: Service unavailable
-	InternalSoftwareError     = 70 // EX_SOFTWARE: Internal software error
-	ErrOsError                = 71 // EX_OSERR: OS-level error
-	ErrCriticalOsFileMissing  = 72 // EX_OSFILE: Critical file missing
-	ErrCannotCreateOutputFile = 73 // EX_CANTCREAT: Cannot create output
-	ErrIoError                = 74 // EX_IOERR: Input/output error
-	TemporaryFailure          = 75 // EX_TEMPFAIL: Temporary failure, retry later
-	RemoteErrorInProtocol     = 76 // EX_PROTOCOL: Remote protocol error
-	PermissionDenied          = 77 // EX_NOPERM: Permission denied
-	ConfigurationError        = 78 // EX_CONFIG: Configuration error
-
-	CommandInvokedCannotExecute = 126 // Command found but is not executable
-	CommandNotFound             = 127 // Command not found
-	InvalidArgumentToExit       = 129 // Exit called with invalid argument
-	ExitStatusOutOfRange        = 255 // Maximum exit code range exceeded
+	/// POSIX-aligned exit codes (based on sysexits.h), typed since 0.3.0: convert them with int(...) where an int is expected
+
+	DataFormatError           PluginExitReason = 65 // EX_DATAERR: The input data was incorrect in some way
+	ErrNoInput                PluginExitReason = 66 // EX_NOINPUT: Cannot open input
+	ErrServiceUnavailable     PluginExitReason = 69 // EX_UNAVAILABLE: Service unavailable
+	InternalSoftwareError     PluginExitReason = 70 // EX_SOFTWARE: Internal software error
+	ErrOsError                PluginExitReason = 71 // EX_OSERR: OS-level error
+	ErrCriticalOsFileMissing  PluginExitReason = 72 // EX_OSFILE: Critical file missing
+	ErrCannotCreateOutputFile PluginExitReason = 73 // EX_CANTCREAT: Cannot create output
+	ErrIoError                PluginExitReason = 74 // EX_IOERR: Input/output error
+	TemporaryFailure          PluginExitReason = 75 // EX_TEMPFAIL: Temporary failure, retry later
+	RemoteErrorInProtocol     PluginExitReason = 76 // EX_PROTOCOL: Remote protocol error
+	PermissionDenied          PluginExitReason = 77 // EX_NOPERM: Permission denied
+	ConfigurationError        PluginExitReason = 78 // EX_CONFIG: Configuration error
+
+	CommandInvokedCannotExecute PluginExitReason = 126 // Command found but is not executable
+	CommandNotFound             PluginExitReason = 127 // Command not found
+	InvalidArgumentToExit       PluginExitReason = 129 // Exit called with invalid argument
+	ExitStatusOutOfRange        PluginExitReason = 255 // Maximum exit code range exceeded
 )
 
+// Error makes PluginExitReason usable as an error, so exit reasons can be wrapped
+// (fmt.Errorf("...: %w", codes.DataFormatError)) and matched with errors.Is.
+func (r PluginExitReason) Error() string {
+	return r.String()
+}
+
 // String returns a human-readable name for the PluginExitReason code.
 // If the code is not recognized, it returns "UnknownExternalStatusCode".
 func (r PluginExitReason) String() string {
@@ -110,6 +157,10 @@ func (r PluginExitReason) String() string {
 		return "PluginToHostCommunicationError"
 	case HostToPluginCommunicationError:
 		return "HostToPluginCommunicationError"
+	case PlugNotStarted:
+		return "PlugNotStarted"
+	case PlugCrashed:
+		return "PlugCrashed"
 	case DataFormatError:
 		return "DataFormatError"
 	case ErrNoInput:
@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plugkit
+
+import (
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// RemoteError is a failure reported by the other side of a PlugKit connection,
+// e.g. by a plug handler that returned an error.
+//
+// Clients return it from RunCommand together with Code as the exit reason. Plug handlers
+// may return it too, to control exactly what the host receives, e.g. to mark a failure
+// as Retryable or to attach Details.
+//
+// A RemoteError matches its Code with errors.Is and errors.As:
+//
+//	if errors.Is(err, codes.DataFormatError) { ... } // bad input
+//	var reason codes.PluginExitReason
+//	if errors.As(err, &reason) { ... }
+type RemoteError struct {
+	Code      codes.PluginExitReason
+	Message   string
+	Details   map[string]any
+	Retryable bool
+	Cause     *RemoteError // the error wrapped by the remote error, if any
+}
+
+// NewRemoteError converts a failure received over the wire into a RemoteError.
+func NewRemoteError(e *messages.Error) *RemoteError {
+	if e == nil {
+		return nil
+	}
+	return &RemoteError{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		Retryable: e.Retryable,
+		Cause:     NewRemoteError(e.Cause),
+	}
+}
+
+func (e *RemoteError) Error() string {
+	if e.Message == "" {
+		return e.Code.String()
+	}
+	return e.Code.String() + ": " + e.Message
+}
+
+// Unwrap returns the cause of the error, if any.
+func (e *RemoteError) Unwrap() error {
+	if e.Cause == nil {
+		return nil
+	}
+	return e.Cause
+}
+
+// Is reports whether target is the exit reason of the error.
+func (e *RemoteError) Is(target error) bool {
+	code, ok := target.(codes.PluginExitReason)
+	return ok && code == e.Code
+}
+
+// As sets a *codes.PluginExitReason target to the exit reason of the error.
+func (e *RemoteError) As(target any) bool {
+	code, ok := target.(*codes.PluginExitReason)
+	if ok {
+		*code = e.Code
+	}
+	return ok
+}
+
+// WireError converts the error into its wire representation, see messages.ErrorEncoder.
+func (e *RemoteError) WireError() *messages.Error {
+	if e == nil {
+		return nil
+	}
+	return &messages.Error{
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		Retryable: e.Retryable,
+		Cause:     e.Cause.WireError(),
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plugkit
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestNewRemoteError(t *testing.T) {
+	wire := &messages.Error{
+		Code:      codes.DataFormatError,
+		Message:   "bad input",
+		Details:   map[string]any{"field": "name"},
+		Retryable: true,
+		Cause:     &messages.Error{Code: codes.ErrNoInput, Message: "file missing"},
+	}
+	err := NewRemoteError(wire)
+
+	if err.Error() != "DataFormatError: bad input" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if !err.Retryable || err.Details["field"] != "name" {
+		t.Errorf("NewRemoteError lost fields: %+v", err)
+	}
+	if err.Cause == nil || err.Cause.Code != codes.ErrNoInput {
+		t.Fatalf("cause = %+v, want %v", err.Cause, codes.ErrNoInput)
+	}
+	if !reflect.DeepEqual(err.WireError(), wire) {
+		t.Errorf("WireError() = %+v, want %+v", err.WireError(), wire)
+	}
+	if NewRemoteError(nil) != nil {
+		t.Error("NewRemoteError(nil) is not nil")
+	}
+}
+
+func TestRemoteErrorMatching(t *testing.T) {
+	var err error = &RemoteError{
+		Code:  codes.DataFormatError,
+		Cause: &RemoteError{Code: codes.ErrNoInput, Message: "file missing"},
+	}
+
+	if !errors.Is(err, codes.DataFormatError) || !errors.Is(err, codes.ErrNoInput) {
+		t.Error("errors.Is does not match the codes of the error and its cause")
+	}
+	if errors.Is(err, codes.OperationError) {
+		t.Error("errors.Is matches an unrelated code")
+	}
+	var reason codes.PluginExitReason
+	if !errors.As(err, &reason) || reason != codes.DataFormatError {
+		t.Errorf("errors.As = %v, want %v", reason, codes.DataFormatError)
+	}
+	var remote *RemoteError
+	if !errors.As(err, &remote) || remote.Code != codes.DataFormatError {
+		t.Errorf("errors.As = %+v", remote)
+	}
+	if cause := errors.Unwrap(err); cause == nil || cause.Error() != "ErrNoInput: file missing" {
+		t.Errorf("Unwrap() = %v", cause)
+	}
+	if (&RemoteError{Code: codes.OperationError}).Unwrap() != nil {
+		t.Error("Unwrap() of an error without a cause is not nil")
+	}
+}
@@ -61,6 +61,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The plug serves commands in a session, so the same process answers again.
+	reason, _, e = c.RunCommand("ping", &shared.Ping{})
+	if reason != codes.OperationSuccess || e != nil {
+		panic("Second command in the session failed")
+	}
+
+	// End the session and wait for the plug to exit.
+	if err := c.Stop(); err != nil {
+		panic(err)
+	}
+
 }
 
 func PongHandler(b *shared.Pong) (bool, error) {
@@ -15,7 +15,9 @@ func main() {
 	fmt.Println("Hello, client")
 
 	// Assume the plug is built and that is the correct name (The makefile takes care of that...)
-	c := client.NewRawClient("./plugin", &clientImpl{})
+	impl := &clientImpl{}
+	c := client.NewRawClient("./plugin", impl)
+	impl.c = c
 
 	// When using more sophisticated plugs, more handlers may be required, i.e.
 	// plug can respond with different structures.
@@ -5,11 +5,12 @@ package main
 import (
 	"fmt"
 
-	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit/client"
 	"github.com/mjwhodur/plugkit/examples/2-rawclient-rawplug-test-basic/shared"
 )
 
 type clientImpl struct {
+	c *client.RawClient
 }
 
 func (c *clientImpl) Handle(msgType string, payload []byte) {
@@ -18,7 +19,8 @@ func (c *clientImpl) Handle(msgType string, payload []byte) {
 		fmt.Println("pong received... allegedly")
 
 		var pong shared.Pong
-		e := cbor.Unmarshal(payload, &pong)
+		// The payload is encoded with the codec of the session.
+		e := c.c.Codec().Unmarshal(payload, &pong)
 		if e != nil {
 			fmt.Println("unmarshall exit code: ", e.Error())
 		}
@@ -5,8 +5,9 @@ package main
 import (
 	"github.com/mjwhodur/plugkit/codes"
 
-	"github.com/fxamacker/cbor/v2"
 	"github.com/mjwhodur/plugkit/examples/2-rawclient-rawplug-test-basic/shared"
+	"github.com/mjwhodur/plugkit/helpers"
+	"github.com/mjwhodur/plugkit/messages"
 	"github.com/mjwhodur/plugkit/plug"
 )
 
@@ -14,11 +15,12 @@ type rawplug struct {
 	c *plug.RawPlug
 }
 
-func (r *rawplug) Handle(kind string, payload cbor.RawMessage) (messageCode string, response cbor.RawMessage, err error) {
-	data, _ := cbor.Marshal(shared.Pong{Message: "PONG FROM RAW PLUG"})
+func (r *rawplug) Handle(kind string, payload messages.RawMessage) (messageCode string, response messages.RawMessage, err error) {
+	// Payloads travel in the codec of the session, which the host may pick.
+	data := helpers.MustRawWith(r.c.Codec(), shared.Pong{Message: "PONG FROM RAW PLUG"})
 	if kind == "ping" {
 		ping := &shared.Ping{}
-		_ = cbor.Unmarshal(payload, &ping)
+		_ = r.c.Codec().Unmarshal(payload, &ping)
 		// if e != nil {
 		//	panic(e)
 		//
@@ -1,24 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 
-	"github.com/fxamacker/cbor/v2"
 	"github.com/mjwhodur/plugkit/client"
 	"github.com/mjwhodur/plugkit/examples/3-rawstream-basic/shared"
 	"github.com/mjwhodur/plugkit/helpers"
+	"github.com/mjwhodur/plugkit/messages"
 )
 
 type SimpleStreamClient struct {
 	c *client.RawStreamClient
 }
 
-func (s *SimpleStreamClient) Handle(kind string, _ *cbor.RawMessage) {
+func (s *SimpleStreamClient) Handle(kind string, _ *messages.RawMessage, _, replyTo uint64) {
 	switch kind {
 	case "pong":
-		fmt.Println("pong received")
+		fmt.Println("pong received for message", replyTo)
 	case "pong-3":
 		fmt.Println("pong 3 received")
 		s.c.Stop()
@@ -50,9 +51,11 @@ func main() {
 		s.Run()
 		wg.Done()
 	}()
-	s.Send("ping", helpers.MustRaw(&shared.Ping{ID: 1}))
-	s.Send("ping", helpers.MustRaw(&shared.Ping{ID: 2}))
-	s.Send("ping", helpers.MustRaw(&shared.Ping{ID: 2}))
+	for _, ping := range []*shared.Ping{{ID: 1}, {ID: 2}, {ID: 2}} {
+		if _, err := s.SendContext(context.Background(), "ping", helpers.MustRawWith(s.Codec(), ping)); err != nil {
+			panic(err)
+		}
+	}
 	time.Sleep(3 * time.Second)
 	s.Stop()
 	wg.Wait()
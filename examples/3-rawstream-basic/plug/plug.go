@@ -1,9 +1,9 @@
 package main
 
 import (
-	"github.com/fxamacker/cbor/v2"
 	"github.com/mjwhodur/plugkit/examples/3-rawstream-basic/shared"
 	"github.com/mjwhodur/plugkit/helpers"
+	"github.com/mjwhodur/plugkit/messages"
 	"github.com/mjwhodur/plugkit/plug"
 )
 
@@ -11,19 +11,19 @@ type StreamPlugExample struct {
 	transport *plug.RawStreamPlug
 }
 
-func (s *StreamPlugExample) Handle(kind string, payload cbor.RawMessage) {
+func (s *StreamPlugExample) Handle(kind string, payload messages.RawMessage, id, _ uint64) {
 	switch kind {
 	case "ping":
 		var pingmsg shared.Ping
-		e := cbor.Unmarshal(payload, &pingmsg)
+		e := s.transport.Codec().Unmarshal(payload, &pingmsg)
 		if e != nil {
 			panic(e)
 		}
 		if pingmsg.ID == 3 {
-			s.transport.Send("pong-3", helpers.MustRaw(&shared.Pong{Message: "Ending Pong"}))
+			s.transport.Reply(id, "pong-3", helpers.MustRawWith(s.transport.Codec(), &shared.Pong{Message: "Ending Pong"}))
 			s.transport.Shutdown()
 		} else {
-			s.transport.Send("pong", helpers.MustRaw(&shared.Pong{Message: "Just a Pong with id < 3"}))
+			s.transport.Reply(id, "pong", helpers.MustRawWith(s.transport.Codec(), &shared.Pong{Message: "Just a Pong with id < 3"}))
 
 		}
 	default:
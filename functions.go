@@ -26,6 +26,10 @@ func NewPlug() *plug.SmartPlug {
 func CreateAndRunPlug(handlers *[]options.CommandHandler) error {
 	p := plug.New()
 	for _, h := range *handlers {
+		if h.HandlerContext != nil {
+			p.HandleMessageTypeContext(h.Command, h.HandlerContext)
+			continue
+		}
 		p.HandleMessageType(h.Command, h.Handler)
 	}
 	return p.Main()
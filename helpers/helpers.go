@@ -7,19 +7,27 @@ import (
 	"fmt"
 
 	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/messages"
 )
 
 // MustRaw serializes the given value into CBOR format and returns it as a RawMessage.
+// It is CBOR-only: sessions speaking another codec need MustRawWith and the codec of
+// the session instead.
 //
 // This function panics if marshaling fails.
 // Suitable for internal use where inputs are trusted.
-func MustRaw(v any) cbor.RawMessage {
-	// FIXME: This probably should have better naming...
-	b, err := cbor.Marshal(v)
-	if err != nil {
-		panic(err) // FIXME: Handle error
-	}
-	return cbor.RawMessage(b)
+func MustRaw(v any) messages.RawMessage {
+	return MustRawWith(codec.CBOR, v)
+}
+
+// MustRawWith serializes the given value with c, e.g. the codec of the session as returned
+// by RawPlug.Codec or RawClient.Codec, and returns it as a RawMessage.
+//
+// This function panics if marshaling fails.
+// Suitable for internal use where inputs are trusted.
+func MustRawWith(c codec.Codec, v any) messages.RawMessage {
+	return codec.MustMarshal(c, v)
 }
 
 // WrapHandler adapts a strongly-typed handler function into a generic handler
@@ -0,0 +1,85 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+import "github.com/mjwhodur/plugkit/schema"
+
+// FeatureDescribe is advertised by plugs that answer codes.DescribeMessage with a Description.
+const FeatureDescribe = "describe"
+
+// Metadata describes a plug to the people and tools using it. All fields are informational.
+type Metadata struct {
+	Version     string `cbor:"version,omitempty"`
+	Author      string `cbor:"author,omitempty"`
+	Description string `cbor:"description,omitempty"`
+}
+
+// Describe is sent from the host to the plugin to ask for its Description, see codes.DescribeMessage.
+type Describe struct{}
+
+// Description is sent from the plugin to the host in answer to a Describe.
+//
+// It lists the message types the plugin handles. Request and Response describe the payload of
+// a message type and the value of its result, where the plugin knows them, e.g. for handlers
+// registered with plug.Handle; they are nil otherwise.
+type Description struct {
+	Name           string               `cbor:"name"`
+	LibraryVersion string               `cbor:"libraryVersion"`
+	Metadata       Metadata             `cbor:"metadata"`
+	MessageTypes   []MessageDescription `cbor:"messageTypes"`
+}
+
+// MessageDescription describes a message type handled by a plugin.
+type MessageDescription struct {
+	Type     string         `cbor:"type"`
+	Request  *schema.Schema `cbor:"request,omitempty"`
+	Response *schema.Schema `cbor:"response,omitempty"`
+}
+
+// MessageType returns the description of the given message type, or nil if it is not listed.
+func (d *Description) MessageType(messageType string) *MessageDescription {
+	for i := range d.MessageTypes {
+		if d.MessageTypes[i].Type == messageType {
+			return &d.MessageTypes[i]
+		}
+	}
+	return nil
+}
+
+// Definitions returns the schemas of the PlugKit messages shared by every plug, such as
+// Envelope, Result, PluginFinish and StopCommand, named after their Go types.
+func Definitions() []schema.Definition {
+	return []schema.Definition{
+		{Name: "Envelope", Schema: schema.For[Envelope]()},
+		{Name: "Hello", Schema: schema.For[Hello]()},
+		{Name: "Result", Schema: schema.For[Result]()},
+		{Name: "Error", Schema: schema.For[Error]()},
+		{Name: "PluginFinish", Schema: schema.For[PluginFinish]()},
+		{Name: "PluginCrash", Schema: schema.For[PluginCrash]()},
+		{Name: "StopCommand", Schema: schema.For[StopCommand]()},
+		{Name: "Cancel", Schema: schema.For[Cancel]()},
+		{Name: "Call", Schema: schema.For[Call]()},
+		{Name: "CallResult", Schema: schema.For[CallResult]()},
+		{Name: "VersionUnsupported", Schema: schema.For[VersionUnsupported]()},
+	}
+}
+
+// Document returns the contract of the described plug: the shared PlugKit messages
+// (see Definitions), followed by the payload of every message type with a known schema,
+// named "<type>-request", and the Result.Value of its answer, named "<type>-response".
+func (d *Description) Document() schema.Document {
+	doc := schema.Document{Title: d.Name, Definitions: Definitions()}
+	if d.Metadata.Version != "" {
+		doc.Title += " " + d.Metadata.Version
+	}
+	for _, t := range d.MessageTypes {
+		if t.Request != nil {
+			doc.Definitions = append(doc.Definitions, schema.Definition{Name: t.Type + "-request", Schema: t.Request})
+		}
+		if t.Response != nil {
+			doc.Definitions = append(doc.Definitions, schema.Definition{Name: t.Type + "-response", Schema: t.Response})
+		}
+	}
+	return doc
+}
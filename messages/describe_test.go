@@ -0,0 +1,43 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+func TestDescriptionDocument(t *testing.T) {
+	d := &Description{
+		Name:     "users",
+		Metadata: Metadata{Version: "1.0"},
+		MessageTypes: []MessageDescription{
+			{Type: "get", Request: schema.For[int](), Response: schema.For[string]()},
+			{Type: "raw"},
+			{Type: "stats", Request: schema.For[bool]()},
+		},
+	}
+	doc := d.Document()
+	if doc.Title != "users 1.0" {
+		t.Errorf("title = %q, want %q", doc.Title, "users 1.0")
+	}
+	shared := len(Definitions())
+	var names []string
+	for _, def := range doc.Definitions[shared:] {
+		names = append(names, def.Name)
+	}
+	// Message types without schemas are left out.
+	if want := []string{"get-request", "get-response", "stats-request"}; !slices.Equal(names, want) {
+		t.Errorf("definitions after the shared messages = %q, want %q", names, want)
+	}
+	if doc.Definitions[0].Name != "Envelope" {
+		t.Errorf("first definition = %q, want the shared Envelope", doc.Definitions[0].Name)
+	}
+
+	if d.MessageType("stats") == nil || d.MessageType("nope") != nil {
+		t.Error("MessageType does not find the listed message types only")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProtocolVersion is the current PlugKit wire protocol version spoken by this library.
+// It is the highest version this library can speak.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest PlugKit wire protocol version this library still speaks.
+const MinProtocolVersion = 1
+
+// FeatureSessions is advertised by plugs that serve many messages over a single process lifetime.
+// Plugs without it handle a single command and exit.
+const FeatureSessions = "sessions"
+
+// FeatureHeartbeat is advertised by plugs that answer codes.PingMessage, so the host
+// may check that they are alive while they serve long-running commands.
+const FeatureHeartbeat = "heartbeat"
+
+// FeatureCalls is advertised by hosts that serve codes.CallMessage, i.e. let plugs call
+// host services while they serve a command.
+const FeatureCalls = "calls"
+
+// FeatureFDTransport is advertised by a host that passed dedicated protocol pipes to the plug,
+// and by a plug that agrees to use them. Once both sides advertised it, every message after
+// the Hello goes over the pipes, and the plug's stdout is free for ordinary output.
+//
+// The host passes the pipes as file descriptors FDTransportIn (host to plug) and FDTransportOut
+// (plug to host), and marks them with the FDTransportEnv environment variable.
+const FeatureFDTransport = "fdTransport"
+
+// File descriptors and environment variable of the dedicated protocol pipes, see FeatureFDTransport.
+const (
+	FDTransportEnv = "PLUGKIT_FD_TRANSPORT"
+	FDTransportIn  = 3
+	FDTransportOut = 4
+)
+
+// CodecEnv is the environment variable naming the codec the host encodes its Hello with,
+// e.g. "json". A plug started without it speaks CBOR. See Hello.Codec.
+const CodecEnv = "PLUGKIT_CODEC"
+
+// ErrUnsupportedVersion is reported when two PlugKit peers share no protocol version.
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// LibraryVersion is the version of the PlugKit library, reported to the other side
+// during the handshake. It is informational only and never used for compatibility checks.
+const LibraryVersion = "0.3.0"
+
+// Hello is the first message exchanged between the host and the plug.
+//
+// The host sends its Hello right after spawning the plug process, and the plug
+// answers with its own Hello before any other message is processed. A process that
+// does not answer with a Hello is not a PlugKit plug.
+//
+// ProtocolVersion and MinProtocolVersion describe the range of protocol versions
+// the sender speaks. Both sides then use the highest version they have in common
+// (see NegotiateVersion), so a newer host can still talk to an older plug.
+//
+// The Hello envelope itself is exempt from version checks; its layout must never change
+// in an incompatible way.
+//
+// MessageTypes lists the message types the sender is able to handle, and Features
+// lists optional protocol features the sender supports. Both are advisory.
+//
+// Both Hellos are encoded with the codec named by CodecEnv. Codecs lists the codecs the host
+// speaks, and Codec is the one the plug picked from them for every message after the Hellos.
+// A plug that leaves Codec empty keeps talking the codec of the Hellos.
+type Hello struct {
+	ProtocolVersion    int      `cbor:"protocolVersion"`
+	MinProtocolVersion int      `cbor:"minProtocolVersion"`
+	LibraryVersion     string   `cbor:"libraryVersion"`
+	Name               string   `cbor:"name"`
+	MessageTypes       []string `cbor:"messageTypes"`
+	Features           []string `cbor:"features"`
+	Codecs             []string `cbor:"codecs,omitempty"`
+	Codec              string   `cbor:"codec,omitempty"`
+}
+
+// HasFeature reports whether the sender of the Hello advertised the given feature.
+func (h *Hello) HasFeature(feature string) bool {
+	if h == nil {
+		return false
+	}
+	for _, f := range h.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsVersion reports whether this library understands envelopes of the given protocol version.
+func SupportsVersion(version int) bool {
+	return version >= MinProtocolVersion && version <= ProtocolVersion
+}
+
+// NegotiateVersion returns the protocol version to be used with the peer that sent the given Hello.
+//
+// The result is the highest version supported by both sides, which is the version of the
+// older peer. ErrUnsupportedVersion is returned if the supported ranges do not overlap.
+// A peer that does not report MinProtocolVersion is assumed to speak only its ProtocolVersion.
+func NegotiateVersion(peer *Hello) (int, error) {
+	peerMin := peer.MinProtocolVersion
+	if peerMin <= 0 || peerMin > peer.ProtocolVersion {
+		peerMin = peer.ProtocolVersion
+	}
+
+	version := min(ProtocolVersion, peer.ProtocolVersion)
+	if version < max(MinProtocolVersion, peerMin) {
+		return 0, fmt.Errorf("%w: peer speaks %d-%d, local side speaks %d-%d", ErrUnsupportedVersion,
+			peerMin, peer.ProtocolVersion, MinProtocolVersion, ProtocolVersion)
+	}
+	return version, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		peer         Hello
+		want         int
+		incompatible bool
+	}{
+		{"same range", Hello{ProtocolVersion: ProtocolVersion, MinProtocolVersion: MinProtocolVersion}, ProtocolVersion, false},
+		{"newer peer", Hello{ProtocolVersion: ProtocolVersion + 5, MinProtocolVersion: MinProtocolVersion}, ProtocolVersion, false},
+		{"no minimum", Hello{ProtocolVersion: ProtocolVersion}, ProtocolVersion, false},
+		{"minimum above version", Hello{ProtocolVersion: ProtocolVersion, MinProtocolVersion: ProtocolVersion + 1}, ProtocolVersion, false},
+		{"peer too new", Hello{ProtocolVersion: ProtocolVersion + 2, MinProtocolVersion: ProtocolVersion + 1}, 0, true},
+		{"peer too old", Hello{ProtocolVersion: MinProtocolVersion - 1}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NegotiateVersion(&tt.peer)
+			if tt.incompatible {
+				if !errors.Is(err, ErrUnsupportedVersion) {
+					t.Errorf("NegotiateVersion() = %d, %v, want ErrUnsupportedVersion", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NegotiateVersion() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupportsVersion(t *testing.T) {
+	for version := MinProtocolVersion - 1; version <= ProtocolVersion+1; version++ {
+		want := version >= MinProtocolVersion && version <= ProtocolVersion
+		if got := SupportsVersion(version); got != want {
+			t.Errorf("SupportsVersion(%d) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestHasFeature(t *testing.T) {
+	h := &Hello{Features: []string{FeatureSessions}}
+	if !h.HasFeature(FeatureSessions) || h.HasFeature(FeatureCalls) {
+		t.Errorf("HasFeature is wrong for %v", h.Features)
+	}
+	var none *Hello
+	if none.HasFeature(FeatureSessions) {
+		t.Error("a nil Hello has features")
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Default decoder limits, see DecoderLimits.
+const (
+	DefaultMaxMessageSize   = 64 << 20 // 64 MiB
+	DefaultMaxNestedLevels  = 32
+	DefaultMaxArrayElements = 131072
+	DefaultMaxMapPairs      = 131072
+)
+
+// ErrLimitExceeded is matched by every *LimitError.
+var ErrLimitExceeded = errors.New("message exceeds decoder limits")
+
+// LimitError reports a message rejected by a Decoder because it exceeds one of its limits.
+// The stream the message came from cannot be read any further.
+type LimitError struct {
+	Limit string // the exceeded limit, e.g. "message size"
+	Max   int    // its value
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("message exceeds the %s limit of %d", e.Limit, e.Max)
+}
+
+// Is reports whether target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// DecoderLimits bound the messages a PlugKit peer accepts, protecting it against a hostile or
+// misbehaving peer sending enormous or deeply nested messages. Zero fields take the defaults,
+// except MaxStringLength, for which zero means that only MaxMessageSize applies.
+//
+// MaxMessageSize is the size of a whole envelope in bytes, and is enforced while the envelope
+// is being read, so an oversized message is never buffered. MaxNestedLevels, MaxArrayElements
+// and MaxMapPairs limit the structure of the message (MaxNestedLevels ranges from 4 to 65535,
+// and the element limits from 16 up), and MaxStringLength the length of a byte or text string.
+type DecoderLimits struct {
+	MaxMessageSize   int
+	MaxNestedLevels  int
+	MaxArrayElements int
+	MaxMapPairs      int
+	MaxStringLength  int
+}
+
+// WithDefaults returns the limits with zero fields replaced by the defaults.
+func (l DecoderLimits) WithDefaults() DecoderLimits {
+	if l.MaxMessageSize <= 0 {
+		l.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if l.MaxNestedLevels <= 0 {
+		l.MaxNestedLevels = DefaultMaxNestedLevels
+	}
+	if l.MaxArrayElements <= 0 {
+		l.MaxArrayElements = DefaultMaxArrayElements
+	}
+	if l.MaxMapPairs <= 0 {
+		l.MaxMapPairs = DefaultMaxMapPairs
+	}
+	return l
+}
+
+// Decoder reads a stream of CBOR messages within DecoderLimits.
+// Once it returned a *LimitError, it must not be used anymore.
+type Decoder struct {
+	dec    *cbor.Decoder
+	dm     cbor.DecMode
+	r      *limitReader
+	limits DecoderLimits
+}
+
+// NewDecoder returns a Decoder reading from r within the given limits.
+// It fails if the limits are out of the ranges the CBOR decoder supports.
+func NewDecoder(r io.Reader, limits DecoderLimits) (*Decoder, error) {
+	limits = limits.WithDefaults()
+	dm, err := cbor.DecOptions{
+		MaxNestedLevels:  limits.MaxNestedLevels,
+		MaxArrayElements: limits.MaxArrayElements,
+		MaxMapPairs:      limits.MaxMapPairs,
+	}.DecMode()
+	if err != nil {
+		return nil, fmt.Errorf("invalid decoder limits: %w", err)
+	}
+	lr := &limitReader{r: r}
+	return &Decoder{dec: dm.NewDecoder(lr), dm: dm, r: lr, limits: limits}, nil
+}
+
+// Decode reads the next message and stores it in the value pointed to by v.
+func (d *Decoder) Decode(v any) error {
+	// Every byte read while the message is incomplete belongs to it.
+	d.r.allow(d.dec.NumBytesRead(), d.limits.MaxMessageSize)
+
+	var err error
+	if d.limits.MaxStringLength > 0 {
+		var raw cbor.RawMessage
+		if err = d.dec.Decode(&raw); err == nil {
+			if err = checkStrings(raw, d.limits.MaxStringLength); err == nil {
+				err = d.dm.Unmarshal(raw, v)
+			}
+		}
+	} else {
+		err = d.dec.Decode(v)
+	}
+	return d.limitError(err)
+}
+
+// Buffered returns a reader for the data read from the stream but not decoded yet.
+func (d *Decoder) Buffered() io.Reader {
+	return d.dec.Buffered()
+}
+
+// limitError turns errors about exceeded limits into a *LimitError.
+func (d *Decoder) limitError(err error) error {
+	var (
+		nested *cbor.MaxNestedLevelError
+		array  *cbor.MaxArrayElementsError
+		pairs  *cbor.MaxMapPairsError
+	)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errMessageTooLarge):
+		return &LimitError{Limit: "message size", Max: d.limits.MaxMessageSize}
+	case errors.As(err, &nested):
+		return &LimitError{Limit: "nesting depth", Max: d.limits.MaxNestedLevels}
+	case errors.As(err, &array):
+		return &LimitError{Limit: "array elements", Max: d.limits.MaxArrayElements}
+	case errors.As(err, &pairs):
+		return &LimitError{Limit: "map pairs", Max: d.limits.MaxMapPairs}
+	}
+	return err
+}
+
+// errMessageTooLarge is returned by limitReader once a message exceeds its size limit.
+var errMessageTooLarge = errors.New("message too large")
+
+// limitReader reads from r, failing once the message being decoded exceeds its size limit.
+type limitReader struct {
+	r     io.Reader
+	read  int // bytes read from r
+	start int // bytes read from r before the message being decoded
+	max   int
+}
+
+// allow starts a new message at the offset consumed, of at most max bytes.
+func (l *limitReader) allow(consumed, max int) {
+	l.start = consumed
+	l.max = max
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	left := l.max - (l.read - l.start)
+	if left <= 0 {
+		return 0, errMessageTooLarge
+	}
+	if len(p) > left {
+		p = p[:left]
+	}
+	n, err := l.r.Read(p)
+	l.read += n
+	return n, err
+}
+
+// checkStrings returns a *LimitError if the well-formed CBOR data item raw holds a byte or
+// text string longer than max bytes. Chunks of indefinite-length strings count together.
+func checkStrings(raw []byte, max int) error {
+	tooLong := &LimitError{Limit: "string length", Max: max}
+	indefinite, total := false, 0
+	for i := 0; i < len(raw); {
+		major, info := raw[i]>>5, raw[i]&0x1f
+		i++
+		if info == 31 {
+			switch {
+			case major == 2 || major == 3:
+				indefinite, total = true, 0
+			case major == 7 && indefinite:
+				indefinite = false
+			}
+			continue
+		}
+
+		var arg uint64
+		switch {
+		case info < 24:
+			arg = uint64(info)
+		case info <= 27:
+			n := 1 << (info - 24)
+			for _, b := range raw[i : i+n] {
+				arg = arg<<8 | uint64(b)
+			}
+			i += n
+		}
+		if major != 2 && major != 3 {
+			continue
+		}
+		if arg > uint64(max) {
+			return tooLong
+		}
+		if indefinite {
+			total += int(arg)
+			if total > max {
+				return tooLong
+			}
+		}
+		i += int(arg)
+	}
+	return nil
+}
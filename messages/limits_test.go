@@ -0,0 +1,157 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestCheckStrings(t *testing.T) {
+	long := strings.Repeat("x", 9)
+	tests := []struct {
+		name string
+		raw  []byte
+		ok   bool
+	}{
+		{"short text", mustCBOR(t, "12345678"), true},
+		{"long text", mustCBOR(t, long), false},
+		{"long bytes", mustCBOR(t, []byte(long)), false},
+		{"nested in array", mustCBOR(t, []any{1, []any{"ok", long}}), false},
+		{"map key", mustCBOR(t, map[string]int{long: 1}), false},
+		{"map value", mustCBOR(t, map[string]string{"k": long}), false},
+		{"tagged", mustCBOR(t, cbor.Tag{Number: 42, Content: long}), false},
+		// Large integers and floats carry arguments, not string lengths.
+		{"large numbers", mustCBOR(t, []any{uint64(1 << 40), -1 << 40, 1.5e300, "short"}), true},
+		// Indefinite-length strings, whose chunks count together.
+		{"indefinite text", []byte{0x7f, 0x64, 'a', 'b', 'c', 'd', 0x64, 'e', 'f', 'g', 'h', 0xff}, true},
+		{"indefinite text too long", []byte{0x7f, 0x65, 'a', 'b', 'c', 'd', 'e', 0x64, 'f', 'g', 'h', 'i', 0xff}, false},
+		{"indefinite bytes too long", []byte{0x5f, 0x45, 1, 2, 3, 4, 5, 0x44, 6, 7, 8, 9, 0xff}, false},
+		{"after indefinite", []byte{0x82, 0x7f, 0x64, 'a', 'b', 'c', 'd', 0xff, 0x65, 'a', 'b', 'c', 'd', 'e'}, true},
+		{"indefinite array", []byte{0x9f, 0x68, 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 0x68, 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 0xff}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkStrings(tt.raw, 8)
+			if tt.ok && err != nil {
+				t.Errorf("checkStrings(% x) = %v, want nil", tt.raw, err)
+			}
+			var limitErr *LimitError
+			if !tt.ok && (!errors.As(err, &limitErr) || limitErr.Limit != "string length" || limitErr.Max != 8) {
+				t.Errorf("checkStrings(% x) = %v, want a string length *LimitError", tt.raw, err)
+			}
+		})
+	}
+}
+
+func mustCBOR(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := cbor.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecoderMessageSize(t *testing.T) {
+	// The limit applies to every message on its own, not to the stream.
+	var stream bytes.Buffer
+	for range 4 {
+		stream.Write(mustCBOR(t, strings.Repeat("x", 40)))
+	}
+	dec, err := NewDecoder(&stream, DecoderLimits{MaxMessageSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 4 {
+		var s string
+		if err := dec.Decode(&s); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	var s string
+	if err := dec.Decode(&s); !errors.Is(err, io.EOF) {
+		t.Errorf("Decode() at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderStopsReading(t *testing.T) {
+	// The header announces a huge string, which is never read in full.
+	r := &countingReader{r: io.MultiReader(bytes.NewReader([]byte{0x7a, 0x7f, 0xff, 0xff, 0xff}), zeros{})}
+	dec, err := NewDecoder(r, DecoderLimits{MaxMessageSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	err = dec.Decode(&v)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "message size" || !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Decode() = %v, want a message size *LimitError", err)
+	}
+	if r.n > 1024 {
+		t.Errorf("decoder read %d bytes of a message limited to 1024", r.n)
+	}
+	if want := "message exceeds the message size limit of 1024"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestDecoderStringLength(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(mustCBOR(t, Envelope{Type: "ok", Raw: mustCBOR(t, "short")}))
+	stream.Write(mustCBOR(t, Envelope{Type: "ok", Raw: mustCBOR(t, strings.Repeat("x", 100))}))
+	dec, err := NewDecoder(&stream, DecoderLimits{MaxStringLength: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg Envelope
+	if err := dec.Decode(&msg); err != nil || msg.Type != "ok" {
+		t.Fatalf("Decode() = %+v, %v", msg, err)
+	}
+	// Strings inside embedded raw messages count too.
+	if err := dec.Decode(&msg); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Decode() = %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestDecoderLimitsDefaults(t *testing.T) {
+	got := DecoderLimits{MaxMapPairs: 20}.WithDefaults()
+	want := DecoderLimits{
+		MaxMessageSize:   DefaultMaxMessageSize,
+		MaxNestedLevels:  DefaultMaxNestedLevels,
+		MaxArrayElements: DefaultMaxArrayElements,
+		MaxMapPairs:      20,
+	}
+	if got != want {
+		t.Errorf("WithDefaults() = %+v, want %+v", got, want)
+	}
+	if _, err := NewDecoder(&bytes.Buffer{}, DecoderLimits{MaxNestedLevels: 2}); err == nil {
+		t.Error("NewDecoder accepted a nesting limit below 4")
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// zeros is an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -4,22 +4,30 @@
 package messages
 
 import (
-	"github.com/fxamacker/cbor/v2"
+	"errors"
+
 	"github.com/mjwhodur/plugkit/codes"
 )
 
 // Envelope represents a generic message wrapper used for communication between
 // the host and the plugin in the PlugKit system.
 //
-// The actual message content is encoded in the Raw field, which contains CBOR-encoded data.
-// This field must be decoded by the recipient according to the message Type.
+// The actual message content is encoded in the Raw field, which contains data encoded with the
+// negotiated codec (CBOR by default). This field must be decoded by the recipient according
+// to the message Type.
 //
 // Envelope is used purely for transporting typed messages — the interpretation
 // of Raw depends on Type and is done in the application logic.
+//
+// ID identifies the message within the messages sent by one side, and ReplyTo carries
+// the ID of the message being answered. Host and plug number their messages independently,
+// starting from 1; zero means the message carries no ID or answers nothing in particular.
 type Envelope struct {
-	Version int             `cbor:"version"` // Protocol version (e.g., 1)
-	Type    string          `cbor:"type"`    // Message type identifier
-	Raw     cbor.RawMessage `cbor:"data"`    // CBOR-encoded payload (must be decoded manually)
+	Version int        `cbor:"version"`           // Protocol version negotiated during the handshake
+	Type    string     `cbor:"type"`              // Message type identifier
+	Raw     RawMessage `cbor:"data"`              // Encoded payload (must be decoded manually)
+	ID      uint64     `cbor:"id,omitempty"`      // Sender-assigned message ID
+	ReplyTo uint64     `cbor:"replyTo,omitempty"` // ID of the message this one answers
 }
 
 // Result represents the outcome of a function or command executed by the plugin.
@@ -29,10 +37,108 @@ type Envelope struct {
 //
 // This structure is used when the plugin returns actual computation results,
 // rather than status or control messages.
+//
+// ExitCode carries the exit reason returned by the handler. If the handler failed,
+// Error describes the failure and Value is usually empty.
 type Result struct {
 	Type     string                 `cbor:"type"` // Type of result, user-defined
 	ExitCode codes.PluginExitReason `cbor:"exitCode"`
 	Value    any                    // Decoded result value
+	Error    *Error                 `cbor:"error,omitempty"` // Failure reported by the handler
+}
+
+// RawResult is the wire form of Result with Value left encoded, for receivers that decode
+// the value directly into a known type.
+type RawResult struct {
+	Type     string                 `cbor:"type"`
+	ExitCode codes.PluginExitReason `cbor:"exitCode"`
+	Value    RawMessage             `cbor:"Value"`
+	Error    *Error                 `cbor:"error,omitempty"`
+}
+
+// Error describes a failure reported over the wire, e.g. by a plug handler that returned an error.
+//
+// Code is the exit reason of the failed operation, Message the text of the original error.
+// Details carries optional machine-readable context (e.g. the name of an invalid field),
+// Retryable tells the receiver that the operation may succeed if tried again, and Cause
+// describes the error wrapped by this one, if any.
+type Error struct {
+	Code      codes.PluginExitReason `cbor:"code"`
+	Message   string                 `cbor:"message"`
+	Details   map[string]any         `cbor:"details,omitempty"`
+	Retryable bool                   `cbor:"retryable,omitempty"`
+	Cause     *Error                 `cbor:"cause,omitempty"`
+}
+
+// Error implements error, so a plug can return a failure received from the host
+// (see Call) as is. Hosts see failures as *plugkit.RemoteError instead.
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code.String()
+	}
+	return e.Code.String() + ": " + e.Message
+}
+
+// Unwrap returns the cause of the error, if any.
+func (e *Error) Unwrap() error {
+	if e.Cause == nil {
+		return nil
+	}
+	return e.Cause
+}
+
+// Is reports whether target is the exit reason of the error.
+func (e *Error) Is(target error) bool {
+	code, ok := target.(codes.PluginExitReason)
+	return ok && code == e.Code
+}
+
+// As sets a *codes.PluginExitReason target to the exit reason of the error.
+func (e *Error) As(target any) bool {
+	code, ok := target.(*codes.PluginExitReason)
+	if ok {
+		*code = e.Code
+	}
+	return ok
+}
+
+// WireError returns e itself, see ErrorEncoder.
+func (e *Error) WireError() *Error {
+	return e
+}
+
+// ErrorEncoder is implemented by errors that know their wire representation,
+// such as *plugkit.RemoteError and *Error.
+type ErrorEncoder interface {
+	WireError() *Error
+}
+
+// NewError converts a Go error into its wire representation.
+//
+// Errors implementing ErrorEncoder describe themselves. For any other error, code is used.
+// As codes.OperationSuccess never describes a failure, it is replaced with the exit reason
+// wrapped by the error, if any, or codes.OperationError. Wrapped errors become the Cause chain.
+func NewError(err error, code codes.PluginExitReason) *Error {
+	var enc ErrorEncoder
+	if errors.As(err, &enc) && enc != nil {
+		if e := enc.WireError(); e != nil {
+			return e
+		}
+	}
+
+	var wrapped codes.PluginExitReason
+	if code == codes.OperationSuccess && errors.As(err, &wrapped) {
+		code = wrapped
+	}
+	if code == codes.OperationSuccess {
+		code = codes.OperationError
+	}
+
+	e := &Error{Code: code, Message: err.Error()}
+	if cause := errors.Unwrap(err); cause != nil {
+		e.Cause = NewError(cause, codes.OperationSuccess)
+	}
+	return e
 }
 
 // StopCommand is sent from the host to the plugin to request a graceful shutdown.
@@ -42,6 +148,36 @@ type StopCommand struct {
 	Reason codes.PluginExitReason `cbor:"reason"`
 }
 
+// Cancel is sent from the host to the plugin when the host stops waiting for the result
+// of a request, e.g. because its deadline passed.
+//
+// The ID field is the Envelope.ID of the abandoned request. The plugin may still answer it,
+// but the answer is dropped by the host.
+type Cancel struct {
+	ID uint64 `cbor:"id"`
+}
+
+// Call is sent from the plugin to the host to invoke a host service, e.g. to read a configuration
+// value, while a command is being served. Method selects the service, and Args is its encoded
+// argument. The host answers with a CallResult.
+type Call struct {
+	Method string     `cbor:"method"`
+	Args   RawMessage `cbor:"args,omitempty"`
+}
+
+// CallResult is sent from the host to the plugin in answer to a Call. Value is the encoded
+// result of a successful call; Error describes a failed one.
+type CallResult struct {
+	Value RawMessage `cbor:"value,omitempty"`
+	Error *Error     `cbor:"error,omitempty"`
+}
+
+// Ping is sent from the host to the plugin as a heartbeat, see codes.PingMessage.
+type Ping struct{}
+
+// Pong is sent from the plugin to the host in answer to a Ping.
+type Pong struct{}
+
 // PluginFinish is sent from the plugin to the host to indicate the plugin has completed
 // its work and is shutting down.
 //
@@ -52,9 +188,37 @@ type PluginFinish struct {
 	Message string                 `cbor:"message"`
 }
 
+// PluginCrash is sent from the plugin to the host when a handler panicked, answering the
+// message that was being handled.
+//
+// Panic is the formatted panic value and Stack the stack trace of the panicking goroutine.
+// Finishing tells the host that the plugin ends its session because of the crash,
+// instead of serving further messages.
+type PluginCrash struct {
+	Type      string `cbor:"type"` // Type of the message being handled
+	Panic     string `cbor:"panic"`
+	Stack     string `cbor:"stack"`
+	Finishing bool   `cbor:"finishing"`
+}
+
 // MessageUnsupported is sent when the plugin receives a message it cannot handle.
 //
 // This type indicates that the message type was unknown, unimplemented, or invalid
 // from the perspective of the receiving party (usually the plugin).
 type MessageUnsupported struct {
 }
+
+// VersionUnsupported is sent in response to an envelope whose Version the receiver does not speak.
+//
+// Version is the rejected version, MinVersion and MaxVersion describe the range
+// supported by the receiver.
+type VersionUnsupported struct {
+	Version    int `cbor:"version"`
+	MinVersion int `cbor:"minVersion"`
+	MaxVersion int `cbor:"maxVersion"`
+}
+
+// NewVersionUnsupported returns a VersionUnsupported rejecting the given version.
+func NewVersionUnsupported(version int) *VersionUnsupported {
+	return &VersionUnsupported{Version: version, MinVersion: MinProtocolVersion, MaxVersion: ProtocolVersion}
+}
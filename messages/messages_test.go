@@ -0,0 +1,49 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestNewError(t *testing.T) {
+	plain := errors.New("disk full")
+	tests := []struct {
+		name  string
+		err   error
+		code  codes.PluginExitReason
+		want  codes.PluginExitReason
+		cause bool
+	}{
+		{"plain", plain, codes.DataFormatError, codes.DataFormatError, false},
+		{"success is no failure", plain, codes.OperationSuccess, codes.OperationError, false},
+		{"wrapped code", fmt.Errorf("reading: %w", codes.ErrNoInput), codes.OperationSuccess, codes.ErrNoInput, true},
+		{"wrapped error", fmt.Errorf("saving: %w", plain), codes.OperationError, codes.OperationError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewError(tt.err, tt.code)
+			if e.Code != tt.want || e.Message != tt.err.Error() {
+				t.Errorf("NewError() = %+v, want code %v and message %q", e, tt.want, tt.err.Error())
+			}
+			if (e.Cause != nil) != tt.cause {
+				t.Errorf("NewError() cause = %+v, want one: %v", e.Cause, tt.cause)
+			}
+			if !errors.Is(e, tt.want) {
+				t.Errorf("errors.Is(%v, %v) = false", e, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewErrorEncoder(t *testing.T) {
+	own := &Error{Code: codes.DataFormatError, Message: "bad", Retryable: true}
+	if e := NewError(fmt.Errorf("wrapped: %w", own), codes.OperationError); e != own {
+		t.Errorf("NewError() = %+v, want the error's own wire form", e)
+	}
+}
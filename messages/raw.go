@@ -0,0 +1,27 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package messages
+
+// RawMessage is an encoded value left for the receiver to decode, e.g. the payload of an Envelope.
+//
+// It is encoded with the codec negotiated during the handshake (CBOR unless both sides agreed on
+// another one, see Hello.Codec), and is embedded as is into the message that carries it.
+// An empty RawMessage stands for null.
+type RawMessage []byte
+
+var cborNull = []byte{0xf6}
+
+// MarshalCBOR returns m, or CBOR null if m is empty.
+func (m RawMessage) MarshalCBOR() ([]byte, error) {
+	if len(m) == 0 {
+		return cborNull, nil
+	}
+	return m, nil
+}
+
+// UnmarshalCBOR sets m to a copy of data.
+func (m *RawMessage) UnmarshalCBOR(data []byte) error {
+	*m = append((*m)[:0], data...)
+	return nil
+}
@@ -4,6 +4,8 @@
 package options
 
 import (
+	"context"
+
 	"github.com/mjwhodur/plugkit/codes"
 	"github.com/mjwhodur/plugkit/messages"
 )
@@ -13,8 +15,12 @@ import (
 // The handler receives raw CBOR-encoded data from the host, decodes it,
 // and returns a result along with an appropriate exit code and optional error.
 //
+// HandlerContext may be set instead of Handler to receive the context of the host request,
+// which is cancelled when the host abandons the request or the plug is shutting down.
+//
 // This structure is used by plugkit.CreateAndRunPlug() to register handlers declaratively.
 type CommandHandler struct {
-	Command string
-	Handler func(p []byte) (*messages.Result, codes.PluginExitReason, error)
+	Command        string
+	Handler        func(p []byte) (*messages.Result, codes.PluginExitReason, error)
+	HandlerContext func(ctx context.Context, p []byte) (*messages.Result, codes.PluginExitReason, error)
 }
@@ -0,0 +1,75 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"log/slog"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// common holds the connection to the host and the settings shared by SmartPlug, RawPlug
+// and RawStreamPlug.
+type common struct {
+	transport *transport
+	name      string
+	metadata  messages.Metadata
+	limits    messages.DecoderLimits
+	codec     codec.Codec // preferred codec, see SetCodec
+	hostInfo  *messages.Hello
+	logger    *slog.Logger
+}
+
+// SetName sets the plug name reported to the host during the handshake.
+// By default, the base name of the plug executable is used.
+func (c *common) SetName(name string) {
+	c.name = name
+}
+
+// SetMetadata sets the version, author and description of the plug, reported to the host
+// in answer to codes.DescribeMessage.
+func (c *common) SetMetadata(metadata messages.Metadata) {
+	c.metadata = metadata
+}
+
+// SetDecoderLimits sets the limits of the messages the plug accepts from the host, see
+// messages.DecoderLimits. A message exceeding them is answered with codes.PayloadMalformed,
+// and the plug ends the session, as the stream cannot be read any further.
+// Zero limits take the defaults. Must be called before Main.
+func (c *common) SetDecoderLimits(limits messages.DecoderLimits) {
+	c.limits = limits
+}
+
+// SetCodec sets the codec the plug prefers, see package codec. If the host speaks it, it is used
+// for every message after the handshake; otherwise the plug keeps to the codec the host chose.
+// Must be called before Main.
+func (c *common) SetCodec(cd codec.Codec) {
+	c.codec = cd
+}
+
+// Codec returns the codec of the session, negotiated during the handshake.
+// It must not be used before Main has completed the handshake.
+func (c *common) Codec() codec.Codec {
+	return c.transport.codec
+}
+
+// SetLogger sets the logger used for diagnostics of the plug runtime itself, e.g. failed
+// writes or served commands. Log records must not go to stdout unless the protocol runs over
+// dedicated pipes; stderr is captured by the host. By default, nothing is logged.
+func (c *common) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+// HostInfo returns the Hello received from the host during the handshake,
+// or nil if the handshake has not happened yet.
+func (c *common) HostInfo() *messages.Hello {
+	return c.hostInfo
+}
+
+// Host returns the host the plug runs in, e.g. to call host services from a handler
+// with Host.Call. It must not be used before Main has completed the handshake.
+func (c *common) Host() *Host {
+	return &Host{transport: c.transport, hello: c.hostInfo}
+}
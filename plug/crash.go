@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// PanicPolicy selects what a plug does after one of its handlers panicked.
+//
+// In either case the panic is recovered, and the host receives a codes.PluginCrashed
+// message with the panic value and stack trace, answering the message being handled.
+type PanicPolicy int
+
+const (
+	// ContinueOnPanic keeps serving other messages after a panic. This is the default.
+	ContinueOnPanic PanicPolicy = iota
+	// FinishOnPanic ends the plug session after a panic, as the plug state may be broken.
+	FinishOnPanic
+)
+
+// panicked describes a recovered panic.
+type panicked struct {
+	value any
+	stack []byte
+}
+
+func (p *panicked) Error() string {
+	return fmt.Sprintf("handler panicked: %v", p.value)
+}
+
+// recovered runs fn and returns the panic raised by it, if any.
+func recovered(fn func()) (crash *panicked) {
+	defer func() {
+		if v := recover(); v != nil {
+			crash = &panicked{value: v, stack: debug.Stack()}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// reportCrash logs a recovered panic and reports it to the host, answering msg.
+// finishing tells the host whether the plug ends its session because of it.
+func reportCrash(t *transport, log *slog.Logger, msg *messages.Envelope, crash *panicked, finishing bool) {
+	log.LogAttrs(context.Background(), slog.LevelError, "handler panicked",
+		slog.String("type", msg.Type), slog.Uint64("id", msg.ID),
+		slog.Any("panic", crash.value), slog.String("stack", string(crash.stack)))
+
+	_, err := t.send(msg.ID, string(codes.PluginCrashed), t.raw(&messages.PluginCrash{
+		Type:      msg.Type,
+		Panic:     fmt.Sprint(crash.value),
+		Stack:     string(crash.stack),
+		Finishing: finishing,
+	}))
+	if err != nil {
+		log.LogAttrs(context.Background(), slog.LevelError, "reporting crash failed", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestRecovered(t *testing.T) {
+	if crash := recovered(func() {}); crash != nil {
+		t.Errorf("recovered() = %v without a panic", crash)
+	}
+	crash := recovered(func() { panic("boom") })
+	if crash == nil || crash.value != "boom" || !strings.Contains(string(crash.stack), "TestRecovered") {
+		t.Fatalf("recovered() = %+v", crash)
+	}
+	if crash.Error() != "handler panicked: boom" {
+		t.Errorf("Error() = %q", crash.Error())
+	}
+}
+
+func TestSmartPlugPanicPolicy(t *testing.T) {
+	for _, policy := range []PanicPolicy{ContinueOnPanic, FinishOnPanic} {
+		p := New()
+		HandleSmartPlugMessage(p, "panic", func(ping) (*messages.Result, codes.PluginExitReason, error) {
+			panic("boom")
+		})
+		p.SetPanicPolicy(policy)
+		msgs := []messages.Envelope{command(2, "panic", ping{})}
+		finishing := policy == FinishOnPanic
+		if !finishing {
+			msgs = append(msgs, command(3, string(codes.ExitMessage), nil))
+		}
+		sent, err := runSession(t, p, msgs...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sent) != 2 || sent[0].Type != string(codes.PluginCrashed) || sent[0].ReplyTo != 2 {
+			t.Fatalf("policy %d: plug sent %+v, want a crash report and a finish", policy, sent)
+		}
+		var crash messages.PluginCrash
+		if err := codec.CBOR.Unmarshal(sent[0].Raw, &crash); err != nil {
+			t.Fatal(err)
+		}
+		if crash.Type != "panic" || crash.Panic != "boom" || crash.Stack == "" || crash.Finishing != finishing {
+			t.Errorf("policy %d: crash = %+v", policy, crash)
+		}
+		want := codes.OperationSuccess
+		if finishing {
+			want = codes.PlugCrashed
+		}
+		if fin := finished(t, sent[1]); fin.Reason != want {
+			t.Errorf("policy %d: finish = %+v, want %v", policy, fin, want)
+		}
+	}
+}
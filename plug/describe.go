@@ -0,0 +1,45 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+// describe builds the description of a plug handling the given message types.
+// Request and response schemas are derived from signatures, where known.
+func describe(name string, metadata messages.Metadata, messageTypes []string, signatures map[string]Signature) *messages.Description {
+	if name == "" {
+		name = defaultName()
+	}
+	d := &messages.Description{
+		Name:           name,
+		LibraryVersion: messages.LibraryVersion,
+		Metadata:       metadata,
+		MessageTypes:   make([]messages.MessageDescription, 0, len(messageTypes)),
+	}
+	for _, t := range messageTypes {
+		md := messages.MessageDescription{Type: t}
+		if sig, ok := signatures[t]; ok {
+			md.Request = schema.Of(sig.Request)
+			if sig.Response != nil {
+				md.Response = schema.Of(sig.Response)
+			}
+		}
+		d.MessageTypes = append(d.MessageTypes, md)
+	}
+	return d
+}
+
+// answerDescribe answers a codes.DescribeMessage from the host with the description of the plug.
+// It returns false if the envelope is not a describe request and may be processed.
+func answerDescribe(t *transport, msg *messages.Envelope, d *messages.Description) bool {
+	if msg.Type != string(codes.DescribeMessage) {
+		return false
+	}
+	_, _ = t.send(msg.ID, string(codes.DescriptionMessage), t.raw(d))
+	return true
+}
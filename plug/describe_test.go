@@ -0,0 +1,57 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestDescribe(t *testing.T) {
+	p := New()
+	p.SetName("pinger")
+	p.SetMetadata(messages.Metadata{Version: "2.0.0", Description: "answers pings"})
+	Handle(p, "ping", func(_ context.Context, in ping) (pong, error) { return pong(in), nil })
+	p.HandleMessageType("raw", func([]byte) (*messages.Result, codes.PluginExitReason, error) {
+		return nil, codes.OperationSuccess, nil
+	})
+
+	sent, err := runSession(t, p, command(2, string(codes.DescribeMessage), messages.Describe{}), command(3, string(codes.ExitMessage), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := answer(t, sent, 2)
+	if msg.Type != string(codes.DescriptionMessage) {
+		t.Fatalf("describe answered with %q, want %q", msg.Type, codes.DescriptionMessage)
+	}
+	var d messages.Description
+	if err := codec.CBOR.Unmarshal(msg.Raw, &d); err != nil {
+		t.Fatal(err)
+	}
+	// The "exit" handler registered by New is listed too.
+	if d.Name != "pinger" || d.Metadata.Version != "2.0.0" || len(d.MessageTypes) != 3 || d.MessageType("exit") == nil {
+		t.Errorf("description = %+v", d)
+	}
+	if md := d.MessageType("ping"); md == nil || md.Request == nil || md.Request.Name != "ping" || md.Response == nil || md.Response.Name != "pong" {
+		t.Errorf("ping described as %+v", md)
+	}
+	// Untyped handlers are listed without schemas.
+	if md := d.MessageType("raw"); md == nil || md.Request != nil || md.Response != nil {
+		t.Errorf("raw described as %+v", md)
+	}
+}
+
+func TestDescribeDefaultName(t *testing.T) {
+	d := describe("", messages.Metadata{}, []string{"ping"}, map[string]Signature{})
+	if d.Name == "" || d.Name != defaultName() {
+		t.Errorf("name = %q, want the default %q", d.Name, defaultName())
+	}
+	if md := d.MessageType("ping"); md == nil || md.Request != nil {
+		t.Errorf("ping described as %+v", md)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+// Signature describes the request and response types of a message type registered with Handle,
+// HandleSmartPlugMessage or HandleSmartPlugMessageContext. Response is nil for the latter two,
+// as their handlers return untyped results.
+type Signature struct {
+	Request  reflect.Type
+	Response reflect.Type
+}
+
+// requestDecoder decodes requests of typed handlers in strict mode, e.g. those registered with
+// Handle. It rejects requests whose shape does not match the request type, e.g. with unknown
+// fields or duplicate keys.
+var requestDecoder = func() cbor.DecMode {
+	dm, err := cbor.DecOptions{
+		DupMapKey:         cbor.DupMapKeyEnforcedAPF,
+		ExtraReturnErrors: cbor.ExtraDecErrorUnknownField,
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return dm
+}()
+
+// Handle registers a typed handler for the given message type.
+//
+// The request is decoded into Req strictly, see DecodePayload: a request that does not fit it,
+// e.g. one with unknown fields, missing required fields or values of the wrong type, or that
+// fails validation, is rejected with codes.PayloadMalformed before fn runs.
+// The value returned by fn is sent to the host as the result, with Result.Type set to the
+// name of Resp (e.g. "Pong" for Pong or *Pong), or messageType for unnamed types.
+//
+// An error returned by fn fails the command, see messages.NewError: errors carrying their own
+// exit reason keep it, expired and cancelled contexts are reported as codes.OperationTimeout
+// and codes.OperationCancelledByClient, and any other error as codes.OperationError.
+//
+// The request and response types are recorded, see SmartPlug.Signatures.
+func Handle[Req, Resp any](p *SmartPlug, messageType string, fn func(context.Context, Req) (Resp, error)) {
+	resultType := typeName(reflect.TypeFor[Resp](), messageType)
+	requestSchema := schema.For[Req]()
+	p.HandleMessageTypeContext(messageType, func(ctx context.Context, raw []byte) (*messages.Result, codes.PluginExitReason, error) {
+		req, err := decodePayload[Req](p.Codec(), requestSchema, raw, true)
+		if err != nil {
+			return nil, codes.DataFormatError, err
+		}
+		resp, err := fn(ctx, req)
+		if err != nil {
+			return nil, exitReasonOf(err), err
+		}
+		return &messages.Result{Type: resultType, ExitCode: codes.OperationSuccess, Value: resp}, codes.OperationSuccess, nil
+	})
+
+	p.sign(messageType, Signature{Request: reflect.TypeFor[Req](), Response: reflect.TypeFor[Resp]()})
+}
+
+// sign records the signature of the handler registered for the given message type.
+func (h *SmartPlug) sign(messageType string, sig Signature) {
+	if h.signatures == nil {
+		h.signatures = make(map[string]Signature)
+	}
+	h.signatures[messageType] = sig
+}
+
+// Signatures returns the request and response types of the message types registered
+// with typed handlers, by message type.
+func (h *SmartPlug) Signatures() map[string]Signature {
+	return maps.Clone(h.signatures)
+}
+
+// typeName returns the name of t, dereferencing pointers, or fallback if t is unnamed.
+func typeName(t reflect.Type, fallback string) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return fallback
+	}
+	return t.Name()
+}
+
+// exitReasonOf returns the exit reason reported for a failed context, or codes.OperationSuccess
+// to let messages.NewError choose one for any other handler error.
+func exitReasonOf(err error) codes.PluginExitReason {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.OperationTimeout
+	case errors.Is(err, context.Canceled):
+		return codes.OperationCancelledByClient
+	}
+	return codes.OperationSuccess
+}
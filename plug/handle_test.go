@@ -0,0 +1,142 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+type pong struct {
+	N int `cbor:"n"`
+}
+
+// rawResult decodes the result carried by a codes.PluginResponse, leaving its value encoded.
+func rawResult(t *testing.T, msg messages.Envelope) *messages.RawResult {
+	t.Helper()
+	if msg.Type != string(codes.PluginResponse) {
+		t.Fatalf("got %q message, want %q", msg.Type, codes.PluginResponse)
+	}
+	var r messages.RawResult
+	if err := codec.CBOR.Unmarshal(msg.Raw, &r); err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+func TestHandle(t *testing.T) {
+	p := New()
+	Handle(p, "ping", func(_ context.Context, in ping) (*pong, error) { return &pong{in.N + 1}, nil })
+	Handle(p, "count", func(_ context.Context, in ping) ([]int, error) { return make([]int, in.N), nil })
+
+	sent, err := runSession(t, p, command(2, "ping", ping{1}), command(3, "count", ping{2}), command(4, string(codes.ExitMessage), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rawResult(t, answer(t, sent, 2))
+	var out pong
+	if err := codec.CBOR.Unmarshal(r.Value, &out); err != nil || out.N != 2 {
+		t.Errorf("ping answered with %+v: %v", out, err)
+	}
+	// The result type is the name of the response type, or the message type for unnamed ones.
+	if r.Type != "pong" || r.ExitCode != codes.OperationSuccess || r.Error != nil {
+		t.Errorf("ping result = %+v, want a successful pong", r)
+	}
+	if r := rawResult(t, answer(t, sent, 3)); r.Type != "count" {
+		t.Errorf("count result type = %q, want %q", r.Type, "count")
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	tests := []struct {
+		err     error
+		want    codes.PluginExitReason
+		message string
+	}{
+		{errors.New("failed"), codes.OperationError, "failed"},
+		{&messages.Error{Code: codes.ErrNoInput, Message: "no input"}, codes.ErrNoInput, "no input"},
+		{fmt.Errorf("waiting: %w", context.DeadlineExceeded), codes.OperationTimeout, "waiting: context deadline exceeded"},
+		{context.Canceled, codes.OperationCancelledByClient, "context canceled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			p := New()
+			Handle(p, "ping", func(context.Context, ping) (pong, error) { return pong{}, tt.err })
+
+			sent, err := runSession(t, p, command(2, "ping", ping{}), command(3, string(codes.ExitMessage), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A failed command does not end the session.
+			r := rawResult(t, answer(t, sent, 2))
+			if r.ExitCode != tt.want || r.Error == nil || r.Error.Code != tt.want || r.Error.Message != tt.message {
+				t.Errorf("result = %+v with error %+v, want %v", r, r.Error, tt.want)
+			}
+			if fin := finished(t, answer(t, sent, 3)); fin.Reason != codes.OperationSuccess {
+				t.Errorf("finish = %+v", fin)
+			}
+		})
+	}
+}
+
+func TestHandleRejectsRequest(t *testing.T) {
+	p := New()
+	called := false
+	Handle(p, "ping", func(context.Context, ping) (pong, error) {
+		called = true
+		return pong{}, nil
+	})
+
+	sent, err := runSession(t, p,
+		command(2, "ping", map[string]any{"n": 1, "extra": true}),
+		command(3, "ping", map[string]any{"n": "one"}),
+		command(4, string(codes.ExitMessage), nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint64(2); id <= 3; id++ {
+		if msg := answer(t, sent, id); msg.Type != string(codes.PayloadMalformed) {
+			t.Errorf("request %d answered with %q, want %q", id, msg.Type, codes.PayloadMalformed)
+		}
+	}
+	if called {
+		t.Error("handler called with a malformed request")
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	p := New()
+	Handle(p, "ping", func(context.Context, ping) (*pong, error) { return nil, nil })
+	HandleSmartPlugMessage(p, "legacy", func(ping) (*messages.Result, codes.PluginExitReason, error) {
+		return nil, codes.OperationSuccess, nil
+	})
+	HandleSmartPlugMessage(p, "replaced", func(ping) (*messages.Result, codes.PluginExitReason, error) {
+		return nil, codes.OperationSuccess, nil
+	})
+	p.HandleMessageType("replaced", func([]byte) (*messages.Result, codes.PluginExitReason, error) {
+		return nil, codes.OperationSuccess, nil
+	})
+
+	want := map[string]Signature{
+		"ping":   {Request: reflect.TypeFor[ping](), Response: reflect.TypeFor[*pong]()},
+		"legacy": {Request: reflect.TypeFor[ping]()},
+	}
+	sigs := p.Signatures()
+	if !reflect.DeepEqual(sigs, want) {
+		t.Errorf("Signatures() = %v, want %v", sigs, want)
+	}
+	// The signatures returned are a copy.
+	delete(sigs, "ping")
+	if _, ok := p.Signatures()["ping"]; !ok {
+		t.Error("Signatures() returned the registry of the plug")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+var (
+	// ErrHandshakeRequired is returned by Main when the host does not open the
+	// conversation with a hello message.
+	ErrHandshakeRequired = errors.New("host did not start with a handshake")
+
+	// ErrIncompatibleHost is returned by Main when the host speaks a protocol
+	// version the plug does not support.
+	ErrIncompatibleHost = errors.New("host is incompatible with this plug")
+)
+
+// MessageTypeLister may be implemented by RawPlugImpl and RawStreamPlugImpl implementations
+// to advertise the message types they handle during the handshake and in their description
+// (see codes.DescribeMessage).
+type MessageTypeLister interface {
+	MessageTypes() []string
+}
+
+// defaultName returns the name a plug reports when none was set explicitly.
+func defaultName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// plugHello builds the Hello message sent by the plug.
+func plugHello(name string, messageTypes []string, features []string) *messages.Hello {
+	if name == "" {
+		name = defaultName()
+	}
+	return &messages.Hello{
+		ProtocolVersion:    messages.ProtocolVersion,
+		MinProtocolVersion: messages.MinProtocolVersion,
+		LibraryVersion:     messages.LibraryVersion,
+		Name:               name,
+		MessageTypes:       messageTypes,
+		Features:           append(features, messages.FeatureHeartbeat, messages.FeatureDescribe),
+	}
+}
+
+// acceptHandshake waits for the host Hello and answers it with the plug's own Hello.
+// It returns the host's Hello, and switches the transport to the negotiated protocol version
+// and codec: preferred, if the host speaks it, else the codec of the host's Hello.
+//
+// If the first message is not a hello, the plug reports a PluginFinish to the host and
+// ErrHandshakeRequired is returned. The plug always answers a valid hello, even from an
+// incompatible host, so the host can report a meaningful error on its side.
+func acceptHandshake(t *transport, local *messages.Hello, preferred codec.Codec) (*messages.Hello, error) {
+	var msg messages.Envelope
+	if err := t.receive(&msg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrHandshakeRequired, err)
+	}
+
+	if msg.Type != string(codes.HelloMessage) {
+		finishHandshake(t, "Handshake required before "+msg.Type)
+		return nil, ErrHandshakeRequired
+	}
+
+	var host messages.Hello
+	if err := t.codec.Unmarshal(msg.Raw, &host); err != nil {
+		finishHandshake(t, "Malformed hello received")
+		return nil, fmt.Errorf("%w: %w", ErrHandshakeRequired, err)
+	}
+
+	reply := *local
+	in, out := protocolPipes(&host)
+	if in != nil {
+		reply.Features = append(append([]string(nil), local.Features...), messages.FeatureFDTransport)
+	}
+	chosen := t.codec
+	if preferred != nil && slices.Contains(host.Codecs, preferred.Name()) {
+		chosen = preferred
+		reply.Codec = chosen.Name()
+	}
+	if _, err := t.send(msg.ID, string(codes.HelloMessage), t.raw(&reply)); err != nil {
+		return nil, err
+	}
+	if chosen != t.codec {
+		t.switchCodec(chosen)
+	}
+	if in != nil {
+		// From now on the plug's stdout is free for ordinary output.
+		t.use(in, out)
+	}
+
+	version, err := messages.NegotiateVersion(&host)
+	if err != nil {
+		return &host, fmt.Errorf("%w: %w", ErrIncompatibleHost, err)
+	}
+	t.version = version
+	return &host, nil
+}
+
+// protocolPipes returns the dedicated protocol pipes passed by the host, if the host offered them
+// (see messages.FeatureFDTransport). It returns nils if the plug has to stay on stdin/stdout.
+func protocolPipes(host *messages.Hello) (*os.File, *os.File) {
+	offered := os.Getenv(messages.FDTransportEnv) != ""
+	// Processes started by the plug must not mistake their file descriptors for protocol pipes.
+	_ = os.Unsetenv(messages.FDTransportEnv)
+	if !offered || !host.HasFeature(messages.FeatureFDTransport) {
+		return nil, nil
+	}
+
+	in := os.NewFile(messages.FDTransportIn, "plugkit-in")
+	out := os.NewFile(messages.FDTransportOut, "plugkit-out")
+	if in == nil || out == nil {
+		return nil, nil
+	}
+	if _, err := in.Stat(); err != nil {
+		return nil, nil
+	}
+	if _, err := out.Stat(); err != nil {
+		return nil, nil
+	}
+	return in, out
+}
+
+// rejectVersion answers an envelope of an unsupported protocol version with VersionUnsupported.
+// It returns false if the envelope is fine and may be processed.
+func rejectVersion(t *transport, msg *messages.Envelope) bool {
+	if messages.SupportsVersion(msg.Version) {
+		return false
+	}
+	_, _ = t.send(msg.ID, string(codes.VersionUnsupported), t.raw(messages.NewVersionUnsupported(msg.Version)))
+	return true
+}
+
+// answerPing answers a heartbeat from the host with codes.PongMessage.
+// It returns false if the envelope is not a heartbeat and may be processed.
+func answerPing(t *transport, msg *messages.Envelope) bool {
+	if msg.Type != string(codes.PingMessage) {
+		return false
+	}
+	_, _ = t.send(msg.ID, string(codes.PongMessage), t.raw(&messages.Pong{}))
+	return true
+}
+
+// finishHandshake tells the host that the plug refuses to continue without a handshake.
+func finishHandshake(t *transport, message string) {
+	_, _ = t.send(0, string(codes.FinishMessage), t.raw(&messages.PluginFinish{
+		Reason:  codes.HostToPluginCommunicationError,
+		Message: message,
+	}))
+}
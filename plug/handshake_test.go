@@ -0,0 +1,155 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// hostStream encodes the given messages of the host with CBOR, as read by the plug.
+func hostStream(t *testing.T, msgs ...messages.Envelope) *bytes.Buffer {
+	t.Helper()
+	var b bytes.Buffer
+	enc := codec.CBOR.NewEncoder(&b)
+	for _, msg := range msgs {
+		if err := enc.Encode(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &b
+}
+
+// plugStream decodes the CBOR messages the plug wrote to r.
+func plugStream(t *testing.T, r io.Reader) []messages.Envelope {
+	t.Helper()
+	dec, err := codec.CBOR.NewDecoder(r, messages.DecoderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []messages.Envelope
+	for {
+		var msg messages.Envelope
+		if err := dec.Decode(&msg); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatal(err)
+			}
+			return msgs
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// helloFrom returns the envelope of a host Hello speaking the given protocol versions.
+func helloFrom(minVersion, version int) messages.Envelope {
+	return messages.Envelope{
+		Version: version,
+		ID:      1,
+		Type:    string(codes.HelloMessage),
+		Raw: codec.MustMarshal(codec.CBOR, &messages.Hello{
+			ProtocolVersion:    version,
+			MinProtocolVersion: minVersion,
+		}),
+	}
+}
+
+func TestAcceptHandshake(t *testing.T) {
+	var out bytes.Buffer
+	tr := newTransport(hostStream(t, helloFrom(messages.MinProtocolVersion, messages.ProtocolVersion)), &out)
+
+	host, err := acceptHandshake(tr, plugHello("test", []string{"ping"}, nil), nil)
+	if err != nil {
+		t.Fatalf("acceptHandshake: %v", err)
+	}
+	if host.ProtocolVersion != messages.ProtocolVersion {
+		t.Errorf("host version = %d, want %d", host.ProtocolVersion, messages.ProtocolVersion)
+	}
+
+	msgs := plugStream(t, &out)
+	if len(msgs) != 1 || msgs[0].Type != string(codes.HelloMessage) || msgs[0].ReplyTo != 1 {
+		t.Fatalf("plug wrote %+v, want a single hello answering message 1", msgs)
+	}
+	var hello messages.Hello
+	if err := codec.CBOR.Unmarshal(msgs[0].Raw, &hello); err != nil {
+		t.Fatal(err)
+	}
+	if hello.Name != "test" || len(hello.MessageTypes) != 1 || !hello.HasFeature(messages.FeatureHeartbeat) {
+		t.Errorf("plug hello = %+v", hello)
+	}
+}
+
+func TestAcceptHandshakeRequired(t *testing.T) {
+	var out bytes.Buffer
+	tr := newTransport(hostStream(t, messages.Envelope{
+		Version: messages.ProtocolVersion,
+		ID:      1,
+		Type:    "ping",
+	}), &out)
+
+	if _, err := acceptHandshake(tr, plugHello("test", nil, nil), nil); !errors.Is(err, ErrHandshakeRequired) {
+		t.Fatalf("acceptHandshake() = %v, want ErrHandshakeRequired", err)
+	}
+	msgs := plugStream(t, &out)
+	if len(msgs) != 1 || msgs[0].Type != string(codes.FinishMessage) {
+		t.Fatalf("plug wrote %+v, want a PluginFinish", msgs)
+	}
+	var fin messages.PluginFinish
+	if err := codec.CBOR.Unmarshal(msgs[0].Raw, &fin); err != nil {
+		t.Fatal(err)
+	}
+	if fin.Reason != codes.HostToPluginCommunicationError {
+		t.Errorf("finish reason = %v, want %v", fin.Reason, codes.HostToPluginCommunicationError)
+	}
+}
+
+func TestAcceptHandshakeNoHost(t *testing.T) {
+	tr := newTransport(&bytes.Buffer{}, io.Discard)
+	if _, err := acceptHandshake(tr, plugHello("test", nil, nil), nil); !errors.Is(err, ErrHandshakeRequired) {
+		t.Errorf("acceptHandshake() = %v, want ErrHandshakeRequired", err)
+	}
+}
+
+func TestAcceptHandshakeCodec(t *testing.T) {
+	for _, offered := range [][]string{{"cbor", "msgpack"}, {"cbor"}} {
+		hello := helloFrom(messages.MinProtocolVersion, messages.ProtocolVersion)
+		hello.Raw = codec.MustMarshal(codec.CBOR, &messages.Hello{
+			ProtocolVersion:    messages.ProtocolVersion,
+			MinProtocolVersion: messages.MinProtocolVersion,
+			Codecs:             offered,
+		})
+		switched := len(offered) > 1
+		in := hostStream(t, hello)
+		// The host switches too, and the next message may already be buffered by the plug.
+		next := codec.CBOR
+		if switched {
+			next = codec.MsgPack
+		}
+		if err := next.NewEncoder(in).Encode(&messages.Envelope{Version: messages.ProtocolVersion, ID: 2, Type: "ping"}); err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		tr := newTransport(in, &out)
+		if _, err := acceptHandshake(tr, plugHello("test", nil, nil), codec.MsgPack); err != nil {
+			t.Fatalf("offered %v: acceptHandshake: %v", offered, err)
+		}
+		var reply messages.Hello
+		if err := codec.CBOR.Unmarshal(plugStream(t, &out)[0].Raw, &reply); err != nil {
+			t.Fatal(err)
+		}
+		if switched != (reply.Codec == "msgpack") || tr.codec != next {
+			t.Errorf("offered %v: plug picked %q and speaks %s", offered, reply.Codec, tr.codec.Name())
+		}
+		var msg messages.Envelope
+		if err := tr.receive(&msg); err != nil || msg.ID != 2 {
+			t.Errorf("offered %v: message after the handshake = %+v, %v", offered, msg, err)
+		}
+	}
+}
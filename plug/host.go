@@ -0,0 +1,49 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// ErrCallsUnsupported is returned by Host.Call when the host does not serve calls,
+// see messages.FeatureCalls.
+var ErrCallsUnsupported = errors.New("host does not serve calls")
+
+// Host is the host a plug runs in, as seen from the plug's handlers.
+type Host struct {
+	transport *transport
+	hello     *messages.Hello
+}
+
+// Info returns the Hello received from the host during the handshake.
+func (h *Host) Info() *messages.Hello {
+	return h.hello
+}
+
+// Call calls the host service method with req and decodes its result into resp, which
+// must be a pointer, or nil if the result is not needed. It waits for the result until ctx ends.
+//
+// Calls may be made at any time after the handshake, also while the host waits for the
+// result of the command being served. A failure reported by the host handler is returned
+// as a *messages.Error, which matches its exit reason with errors.Is.
+func (h *Host) Call(ctx context.Context, method string, req any, resp any) error {
+	if h.hello == nil || !h.hello.HasFeature(messages.FeatureCalls) {
+		return ErrCallsUnsupported
+	}
+	res, err := h.transport.call(ctx, method, h.transport.raw(req))
+	if err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if resp == nil || len(res.Value) == 0 {
+		return nil
+	}
+	return h.transport.codec.Unmarshal(res.Value, resp)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// callingHost returns a Host serving calls, and a function reading the next call the plug
+// sends to it. Results are passed to the transport of the Host with answered.
+func callingHost(t *testing.T) (*Host, func() (messages.Envelope, *messages.Call)) {
+	t.Helper()
+	r, w := io.Pipe()
+	t.Cleanup(func() { _ = r.Close() })
+	dec, err := codec.CBOR.NewDecoder(r, messages.DecoderLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := &Host{
+		transport: newTransport(&bytes.Buffer{}, w),
+		hello:     &messages.Hello{Features: []string{messages.FeatureCalls}},
+	}
+	return host, func() (messages.Envelope, *messages.Call) {
+		t.Helper()
+		var msg messages.Envelope
+		var call messages.Call
+		if err := dec.Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := codec.CBOR.Unmarshal(msg.Raw, &call); err != nil || msg.Type != string(codes.CallMessage) {
+			t.Fatalf("plug sent %s, want a call: %v", msg.Type, err)
+		}
+		return msg, &call
+	}
+}
+
+// callResult returns the envelope answering the call with ID id with res.
+func callResult(id uint64, res *messages.CallResult) *messages.Envelope {
+	return &messages.Envelope{
+		ReplyTo: id,
+		Type:    string(codes.CallResultMessage),
+		Raw:     codec.MustMarshal(codec.CBOR, res),
+	}
+}
+
+func TestHostCall(t *testing.T) {
+	host, next := callingHost(t)
+	type config struct {
+		Key string `cbor:"key"`
+	}
+	done := make(chan error, 1)
+	var got config
+	go func() { done <- host.Call(context.Background(), "config", config{"in"}, &got) }()
+
+	msg, call := next()
+	var args config
+	if err := codec.CBOR.Unmarshal(call.Args, &args); err != nil || call.Method != "config" || args.Key != "in" {
+		t.Fatalf("plug called %q with %+v: %v", call.Method, args, err)
+	}
+	// A result answering another message is not taken for the result of the call.
+	for _, replyTo := range []uint64{msg.ID + 1, msg.ID} {
+		res := callResult(replyTo, &messages.CallResult{Value: codec.MustMarshal(codec.CBOR, config{"out"})})
+		if !host.transport.answered(res) {
+			t.Fatal("call result not taken by the transport")
+		}
+	}
+	if err := <-done; err != nil || got.Key != "out" {
+		t.Errorf("Call() = %+v, %v", got, err)
+	}
+}
+
+func TestHostCallFails(t *testing.T) {
+	host, next := callingHost(t)
+	done := make(chan error, 1)
+	go func() { done <- host.Call(context.Background(), "secret", nil, nil) }()
+
+	msg, _ := next()
+	host.transport.answered(callResult(msg.ID, &messages.CallResult{
+		Error: &messages.Error{Code: codes.CommandNotFound, Message: "no host handler"},
+	}))
+	if err := <-done; !errors.Is(err, codes.CommandNotFound) {
+		t.Errorf("Call() = %v, want %v", err, codes.CommandNotFound)
+	}
+}
+
+func TestHostCallContext(t *testing.T) {
+	host, next := callingHost(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- host.Call(ctx, "slow", nil, nil) }()
+
+	msg, _ := next()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Call() = %v, want context.Canceled", err)
+	}
+	// The late result is dropped.
+	if !host.transport.answered(callResult(msg.ID, &messages.CallResult{})) {
+		t.Error("late call result not taken by the transport")
+	}
+}
+
+func TestHostCallUnsupported(t *testing.T) {
+	for name, host := range map[string]*Host{
+		"before the handshake": {},
+		"host without calls":   {hello: &messages.Hello{Features: []string{messages.FeatureSessions}}},
+	} {
+		if err := host.Call(context.Background(), "config", nil, nil); !errors.Is(err, ErrCallsUnsupported) {
+			t.Errorf("%s: Call() = %v, want ErrCallsUnsupported", name, err)
+		}
+	}
+}
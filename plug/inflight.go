@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// inflight tracks the contexts of the host requests being served by a plug,
+// so that a codes.CancelMessage from the host reaches the right handler.
+type inflight struct {
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelFunc
+}
+
+// begin derives the context of the host request with the given ID from parent.
+// The returned function must be called once the request is served.
+func (f *inflight) begin(parent context.Context, id uint64) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	if id == 0 {
+		// Requests without an ID cannot be cancelled by the host.
+		return ctx, cancel
+	}
+
+	f.mu.Lock()
+	if f.cancels == nil {
+		f.cancels = make(map[uint64]context.CancelFunc)
+	}
+	f.cancels[id] = cancel
+	f.mu.Unlock()
+
+	return ctx, func() {
+		f.mu.Lock()
+		delete(f.cancels, id)
+		f.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels the context of the host request with the given ID, if it is still being served.
+func (f *inflight) cancel(id uint64) {
+	f.mu.Lock()
+	cancel, ok := f.cancels[id]
+	f.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// cancelled reports whether msg is a codes.CancelMessage, and returns the ID of the
+// host request it cancels.
+func cancelled(t *transport, msg *messages.Envelope) (uint64, bool) {
+	if msg.Type != string(codes.CancelMessage) {
+		return 0, false
+	}
+	var c messages.Cancel
+	if err := t.codec.Unmarshal(msg.Raw, &c); err != nil {
+		return 0, true
+	}
+	return c.ID, true
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codes"
+)
+
+func TestSmartPlugLogger(t *testing.T) {
+	var b bytes.Buffer
+	p := newPingPlug()
+	p.SetLogger(slog.New(slog.NewJSONHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	if _, err := runSession(t, p, command(2, "ping", ping{1}), command(3, string(codes.ExitMessage), nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := json.NewDecoder(&b)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		if record["msg"] == "command served" && record["type"] == "ping" && record["id"] == 2.0 {
+			return
+		}
+	}
+	t.Errorf("served command not logged: %s", b.String())
+}
@@ -1,21 +1,24 @@
 package plug
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/mjwhodur/plugkit/helpers"
-
-	"github.com/fxamacker/cbor/v2"
 	"github.com/mjwhodur/plugkit/codes"
 	"github.com/mjwhodur/plugkit/messages"
 )
 
 // RawPlugImpl is the interface that every raw plug implementation must satisfy.
 //
-// Handle receives the raw CBOR payload extracted from the envelope and returns:
+// Handle receives the raw payload extracted from the envelope and returns:
 // - a message code indicating the result (e.g., "ok", "unsupported", custom-defined, etc.),
-// - a CBOR-encoded response payload to be sent back to the host,
+// - an encoded response payload to be sent back to the host,
 // - or an error, which will cause the RawPlug to send a operation failure response to the host.
 //
 // If an error is returned from Handle, the plug is considered to have failed the request.
@@ -25,94 +28,180 @@ import (
 //
 // Mount is called once at startup and provides the plugin with access to its host context,
 // which can be used to configure or initialize internal state.
+//
+// Payloads are encoded with the codec of the session, see RawPlug.Codec; CBOR unless the plug
+// prefers another codec (see RawPlug.SetCodec) or the host chose one.
 type RawPlugImpl interface {
-	Handle(kind string, payload cbor.RawMessage) (messageCode string, response cbor.RawMessage, err error)
+	Handle(kind string, payload messages.RawMessage) (messageCode string, response messages.RawMessage, err error)
 	Mount(c *RawPlug)
 }
 
-// RawPlug provides a low-level plugin host that communicates over stdin and stdout using CBOR encoding.
+// RawPlugContextImpl is an optional extension of RawPlugImpl.
+//
+// If the implementation provides HandleContext, RawPlug calls it instead of Handle and passes
+// the context of the host request. The context is cancelled when the host abandons the request
+// with codes.CancelMessage or closes the stream, and when the plug receives SIGINT or SIGTERM.
+type RawPlugContextImpl interface {
+	RawPlugImpl
+	HandleContext(ctx context.Context, kind string, payload messages.RawMessage) (messageCode string, response messages.RawMessage, err error)
+}
+
+// RawPlug provides a low-level plugin host that communicates over stdin and stdout using CBOR encoding, or another codec, see SetCodec.
 // It reads and writes Envelope messages, and delegates the handling of payloads to the user-defined RawPlugImpl.
 // RawPlug is the most minimal building block for creating plugins with custom protocols or structure.
 type RawPlug struct {
+	common
 	PlugImpl RawPlugImpl
-	decoder  *cbor.Decoder
-	encoder  *cbor.Encoder
+
+	description *messages.Description
 }
 
 // NewRawPlug creates a new RawPlug with the given user-defined implementation.
 func NewRawPlug(impl RawPlugImpl) *RawPlug {
 	return &RawPlug{
+		common:   common{transport: newTransport(os.Stdin, os.Stdout)},
 		PlugImpl: impl,
 	}
 }
 
 // Main starts the main loop of the RawPlug.
-// It reads a single Envelope from stdin, passes its raw CBOR payload to the user-defined implementation,
+// It answers the host handshake, then reads a single Envelope from stdin, passes its raw payload to the user-defined implementation,
 // and writes a response Envelope to stdout.
-// If decoding fails, an appropriate error message is sent back immediately.
+// If decoding fails, an appropriate error message is sent back immediately, and the plug
+// waits for the next message. If the host closes stdin before sending a command, Main returns nil.
 func (p *RawPlug) Main() error {
 	p.PlugImpl.Mount(p)
-	p.decoder = cbor.NewDecoder(os.Stdin)
-	p.encoder = cbor.NewEncoder(os.Stdout)
+	if err := p.transport.limit(p.limits); err != nil {
+		return err
+	}
+
+	var types []string
+	if l, ok := p.PlugImpl.(MessageTypeLister); ok {
+		types = l.MessageTypes()
+	}
+	hostInfo, err := acceptHandshake(p.transport, plugHello(p.name, types, nil), p.codec)
+	if err != nil {
+		return err
+	}
+	p.hostInfo = hostInfo
+	p.description = describe(p.name, p.metadata, types, nil)
+
 	var msg messages.Envelope
-	if err := p.decoder.Decode(&msg); err != nil {
-		err := p.encoder.Encode(messages.Envelope{
-			Version: 1,
-			Type:    string(codes.PayloadMalformed),
-			Raw:     helpers.MustRaw(&messages.MessageUnsupported{}),
-		})
-		if err != nil {
-			panic(err)
+	for {
+		msg = messages.Envelope{}
+		if err := p.transport.receive(&msg); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				// The host closed the stream without sending a command.
+				return nil
+			}
+			if errors.Is(err, messages.ErrLimitExceeded) {
+				p.transport.reject(err)
+				return err
+			}
+			_, err := p.transport.send(0, string(codes.PayloadMalformed), p.transport.raw(&messages.MessageUnsupported{}))
+			if err != nil {
+				// The host cannot be reached any longer.
+				return err
+			}
+			// Wait for a command the plug can read.
+			continue
 		}
-
+		// Heartbeats and describe requests may arrive before the command.
+		if !answerPing(p.transport, &msg) && !answerDescribe(p.transport, &msg, p.description) {
+			break
+		}
+	}
+	if rejectVersion(p.transport, &msg) {
+		return fmt.Errorf("%w: %d", messages.ErrUnsupportedVersion, msg.Version)
 	}
+	if msg.Type == string(codes.ExitMessage) {
+		// The host closes the plug before sending a command.
+		return p.transport.finish(msg.ID, "Session closed by host", codes.OperationSuccess)
+	}
+
 	// Pass the raw payload to the implementation.
-	msgCode, res, err := p.PlugImpl.Handle(msg.Type, msg.Raw)
+	var msgCode string
+	var res messages.RawMessage
+	var crash *panicked
+	if impl, ok := p.PlugImpl.(RawPlugContextImpl); ok {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var requests inflight
+		ctx, done := requests.begin(ctx, msg.ID)
+		defer done()
+
+		go p.watch(&requests, cancel)
+		crash = recovered(func() { msgCode, res, err = impl.HandleContext(ctx, msg.Type, msg.Raw) })
+	} else {
+		// Nothing to cancel, but heartbeats are still answered.
+		go p.watch(&inflight{}, func() {})
+		crash = recovered(func() { msgCode, res, err = p.PlugImpl.Handle(msg.Type, msg.Raw) })
+	}
+	if crash != nil {
+		// The plug serves a single message, so it is finishing anyway.
+		reportCrash(p.transport, loggerOrDiscard(p.logger), &msg, crash, true)
+		return crash
+	}
+	var payloadErr *PayloadError
+	if errors.As(err, &payloadErr) {
+		// The implementation rejected the payload, e.g. with DecodePayload.
+		rejectPayload(p.transport, loggerOrDiscard(p.logger), &msg, payloadErr)
+		return err
+	}
 	if err != nil {
-		// Return a handling error with the error as payload.
-		p.respondError(string(codes.HandlingError), helpers.MustRaw(err))
+		// Return a handling error describing the failure.
+		p.respondError(msg.ID, messages.NewError(err, codes.OperationError))
 		return err
 	}
 
 	// Send the response with the provided message code and payload.
-	p.respond(msgCode, res)
+	p.respond(msg.ID, msgCode, res)
 	return nil
 }
 
-// respond sends an Envelope with the success message code and CBOR payload to stdout.
-func (p *RawPlug) respond(messageCode string, payload cbor.RawMessage) {
+// watch reads the messages the host sends while the request is being handled, passes
+// cancellations to requests and results of host calls to their callers, and answers heartbeats
+// and describe requests. When the host closes the stream, shutdown is called.
+func (p *RawPlug) watch(requests *inflight, shutdown context.CancelFunc) {
+	for {
+		var msg messages.Envelope
+		if err := p.transport.receive(&msg); err != nil {
+			shutdown()
+			return
+		}
+		if id, ok := cancelled(p.transport, &msg); ok {
+			requests.cancel(id)
+		}
+		_ = answerPing(p.transport, &msg) || answerDescribe(p.transport, &msg, p.description) || p.transport.answered(&msg)
+	}
+}
+
+// respond sends an Envelope with the success message code and payload to stdout,
+// answering the host message with the replyTo ID.
+func (p *RawPlug) respond(replyTo uint64, messageCode string, payload messages.RawMessage) {
 	// FIXME: message code name needs to be fixed
 	res := &messages.Result{ExitCode: codes.OperationSuccess, Type: messageCode, Value: payload}
 	// data, e := cbor.Marshal(res)
 	// if e != nil {
 	//	panic(e)
 	//}
-	err := p.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    string(codes.PluginResponse),
-		Raw:     helpers.MustRaw(res),
-	})
+	_, err := p.transport.send(replyTo, string(codes.PluginResponse), p.transport.raw(res))
 	if err != nil {
-		// If we can't write the response, panic — plugin cannot recover.
-		fmt.Println(err)
+		loggerOrDiscard(p.logger).LogAttrs(context.Background(), slog.LevelError, "writing response failed",
+			slog.String("type", messageCode), slog.Uint64("replyTo", replyTo), slog.Any("error", err))
 	}
 }
 
-// respondError sends an Envelope with the failure message code and CBOR payload to stdout.
-func (p *RawPlug) respondError(messageCode string, payload cbor.RawMessage) {
-	res := &messages.Result{ExitCode: codes.OperationError, Type: messageCode, Value: payload}
-	// data, e := cbor.Marshal(res)
-	// if e != nil {
-	//	panic(e)
-	//}
-	err := p.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    string(codes.PluginResponse),
-		Raw:     helpers.MustRaw(res),
-	})
+// respondError sends an Envelope with a failed result describing e to stdout,
+// answering the host message with the replyTo ID.
+func (p *RawPlug) respondError(replyTo uint64, e *messages.Error) {
+	res := &messages.Result{ExitCode: e.Code, Type: string(codes.HandlingError), Error: e}
+	_, err := p.transport.send(replyTo, string(codes.PluginResponse), p.transport.raw(res))
 	if err != nil {
-		// If we can't write the response, panic — plugin cannot recover.
-		fmt.Println(err)
+		loggerOrDiscard(p.logger).LogAttrs(context.Background(), slog.LevelError, "writing response failed",
+			slog.String("type", string(codes.HandlingError)), slog.Uint64("replyTo", replyTo), slog.Any("error", err))
 	}
 }
 
@@ -0,0 +1,73 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// rawEcho is a RawPlugImpl answering every message with its own type and payload.
+type rawEcho struct {
+	handled int
+}
+
+func (e *rawEcho) Mount(*RawPlug) {}
+
+func (e *rawEcho) Handle(kind string, payload messages.RawMessage) (string, messages.RawMessage, error) {
+	e.handled++
+	return kind, payload, nil
+}
+
+// runRawPlug runs a RawPlug of impl reading in, and returns the messages it sent after its
+// hello and the error of Main.
+func runRawPlug(t *testing.T, impl RawPlugImpl, in *bytes.Buffer) ([]messages.Envelope, error) {
+	t.Helper()
+	var out bytes.Buffer
+	p := NewRawPlug(impl)
+	p.transport = newTransport(in, &out)
+	err := p.Main()
+	sent := plugStream(t, &out)
+	if len(sent) == 0 || sent[0].Type != string(codes.HelloMessage) {
+		t.Fatalf("plug did not answer the hello: %+v", sent)
+	}
+	return sent[1:], err
+}
+
+func TestRawPlugMalformedMessage(t *testing.T) {
+	in := hostStream(t, helloFrom(messages.MinProtocolVersion, messages.ProtocolVersion))
+	// A well-formed CBOR item that is no Envelope, followed by a command.
+	in.Write(codec.MustMarshal(codec.CBOR, "garbage"))
+	in.Write(hostStream(t, command(2, "ping", ping{1})).Bytes())
+
+	impl := &rawEcho{}
+	sent, err := runRawPlug(t, impl, in)
+	if err != nil {
+		t.Fatalf("Main: %v", err)
+	}
+	if len(sent) != 2 || sent[0].Type != string(codes.PayloadMalformed) {
+		t.Fatalf("plug sent %+v, want a rejection and a result", sent)
+	}
+	if r := result(t, sent[1]); r.Type != "ping" || sent[1].ReplyTo != 2 {
+		t.Errorf("result = %+v answering %d, want ping answering 2", r, sent[1].ReplyTo)
+	}
+	if impl.handled != 1 {
+		t.Errorf("implementation handled %d messages, want 1", impl.handled)
+	}
+}
+
+func TestRawPlugClosedInput(t *testing.T) {
+	impl := &rawEcho{}
+	sent, err := runRawPlug(t, impl, hostStream(t, helloFrom(messages.MinProtocolVersion, messages.ProtocolVersion)))
+	if err != nil {
+		t.Errorf("Main() = %v, want nil once the host closed the stream", err)
+	}
+	if len(sent) != 0 || impl.handled != 0 {
+		t.Errorf("plug sent %+v and handled %d messages, want nothing", sent, impl.handled)
+	}
+}
@@ -2,39 +2,54 @@ package plug
 
 import (
 	"context"
+	"errors"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
-	"github.com/fxamacker/cbor/v2"
 	"github.com/mjwhodur/plugkit/codes"
-	"github.com/mjwhodur/plugkit/helpers"
 	"github.com/mjwhodur/plugkit/messages"
 )
 
 // RawStreamPlugImpl is the interface that every raw plug implementation must satisfy.
 //
-// Handle receives the raw CBOR payload extracted from the envelope and returns:
-// - a message code indicating the result (e.g., "ok", "unsupported", custom-defined, etc.),
-// - a CBOR-encoded response payload to be sent back to the host,
-// - or an error, which will cause the RawPlug to send a operation failure response to the host.
+// Handle receives the message type and the raw payload extracted from the envelope,
+// together with the ID the host assigned to the message and the ID of the plug message
+// it answers (zero if it answers nothing). Responses are sent with RawStreamPlug.Send
+// or RawStreamPlug.Reply; Handle itself returns nothing.
 //
-// If an error is returned from Handle, the plug is considered to have failed the request.
-// In all other cases, the message is treated as successfully handled,
+// Every message is treated as successfully handled,
 // even if the operation type was unknown or invalid — it's up to the plugin to decide how to respond.
 // This is intentional, as RawStreamPlug provides no automatic validation or dispatching — full control is left to the implementer.
 //
 // Mount is called once at startup and provides the plugin with access to its host context,
 // which can be used to configure or initialize internal state.
 // CloseSignal is called when the plug receives external shutdown signal (i.e. OS, plug host etc).
+//
+// Payloads are encoded with the codec of the session, see RawStreamPlug.Codec; CBOR unless the
+// plug prefers another codec (see RawStreamPlug.SetCodec) or the host chose one.
 type RawStreamPlugImpl interface {
-	Handle(kind string, payload cbor.RawMessage)
+	Handle(kind string, payload messages.RawMessage, id, replyTo uint64)
 	Mount(c *RawStreamPlug)
 	CloseSignal()
 }
 
-// RawStreamPlug is a low-level CBOR-based plugin communication framework.
+// RawStreamPlugContextImpl is an optional extension of RawStreamPlugImpl.
+//
+// If the implementation provides HandleContext, RawStreamPlug calls it instead of Handle and
+// passes the context of the host message. The context is cancelled when the host abandons the
+// message with codes.CancelMessage, or when the plug is shut down (see Shutdown) or receives
+// SIGINT or SIGTERM. Cancellations are consumed by RawStreamPlug and not passed to HandleContext.
+type RawStreamPlugContextImpl interface {
+	RawStreamPlugImpl
+	HandleContext(ctx context.Context, kind string, payload messages.RawMessage, id, replyTo uint64)
+}
+
+// RawStreamPlug is a low-level plugin communication framework.
 //
 // It provides raw input/output streams without automatic validation or message dispatching.
 // The plugin implementation (RawStreamPlugImpl) is fully responsible for interpreting incoming messages
@@ -49,14 +64,24 @@ type RawStreamPlugImpl interface {
 //   - Call Main() to start the event loop.
 //   - Call Shutdown() to terminate the plug from the implementation.
 type RawStreamPlug struct {
+	common
 	PlugImpl RawStreamPlugImpl
-	decoder  *cbor.Decoder
-	encoder  *cbor.Encoder
 	wg       *sync.WaitGroup
 	ossig    context.Context
 	implsig  context.Context
 	cancel   context.CancelFunc
 	osstop   context.CancelFunc
+
+	onPanic      PanicPolicy
+	requests     inflight
+	handlers     context.Context // parent of the contexts passed to HandleContext
+	stopHandlers context.CancelFunc
+	exitID       uint64        // ID of the host's codes.ExitMessage, once received
+	running      atomic.Int64  // handlers running
+	idle         chan struct{} // signalled when a handler returns
+	description  *messages.Description
+	failMu       sync.Mutex
+	failed       error // the error that broke the stream to or from the host, if any
 }
 
 func NewRawStreamPlug(impl RawStreamPlugImpl) *RawStreamPlug {
@@ -66,80 +91,260 @@ func NewRawStreamPlug(impl RawStreamPlugImpl) *RawStreamPlug {
 }
 
 // Main starts the main loop of the RawStreamPlug.
-func (p *RawStreamPlug) Main() {
+//
+// It answers the host handshake first and returns an error if the host is not a
+// compatible PlugKit host. Otherwise, it blocks until the plug is shut down.
+// When the host ends the session with codes.ExitMessage, Main waits for the running
+// handlers and reports a PluginFinish to the host before returning. If the host sent a
+// message exceeding the decoder limits (see SetDecoderLimits), Main returns a *messages.LimitError;
+// if a message cannot be written to the host, Main returns the write error.
+func (p *RawStreamPlug) Main() error {
 	p.PlugImpl.Mount(p)
-	p.decoder = cbor.NewDecoder(os.Stdin)
-	p.encoder = cbor.NewEncoder(os.Stdout)
+	p.transport = newTransport(os.Stdin, os.Stdout)
+	if err := p.transport.limit(p.limits); err != nil {
+		return err
+	}
+
+	var types []string
+	if l, ok := p.PlugImpl.(MessageTypeLister); ok {
+		types = l.MessageTypes()
+	}
+	hostInfo, err := acceptHandshake(p.transport, plugHello(p.name, types, []string{messages.FeatureSessions}), p.codec)
+	if err != nil {
+		return err
+	}
+	p.hostInfo = hostInfo
+	p.description = describe(p.name, p.metadata, types, nil)
 	p.wg = &sync.WaitGroup{}
+	p.idle = make(chan struct{}, 1)
 	p.ossig, p.osstop = signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	p.implsig, p.cancel = context.WithCancel(context.Background())
+	p.handlers, p.stopHandlers = context.WithCancel(p.implsig)
+	defer p.stopHandlers()
+	context.AfterFunc(p.ossig, p.stopHandlers)
 
 	p.wg.Add(1)
 	go p.Loop()
 	p.wg.Wait()
+
+	if p.exitID != 0 {
+		// Every handler is done, so the session can be closed as the host asked.
+		return p.transport.finish(p.exitID, "Session closed by host", codes.OperationSuccess)
+	}
+	p.failMu.Lock()
+	defer p.failMu.Unlock()
+	var crash *panicked
+	if errors.As(p.failed, &crash) {
+		// FinishOnPanic: the host was told about the crash, and now about the end of the session.
+		_ = p.transport.finish(0, crash.Error(), codes.PlugCrashed)
+	}
+	return p.failed
+}
+
+// Send sends an Envelope with the message code and encoded payload to stdout
+// and returns the ID assigned to it.
+func (p *RawStreamPlug) Send(messageCode string, payload messages.RawMessage) uint64 {
+	return p.Reply(0, messageCode, payload)
 }
 
-// Send sends an Envelope with the message code and CBOR payload to stdout.
-func (p *RawStreamPlug) Send(messageCode string, payload cbor.RawMessage) {
-	err := p.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    messageCode,
-		Raw:     payload,
-	})
+// Reply sends an Envelope answering the host message with the given ID
+// and returns the ID assigned to the response.
+//
+// If the message cannot be written, e.g. because the host went away, the error is logged
+// and the plug shuts down; Main returns the error.
+// Send and Reply are safe for concurrent use, e.g. from handlers running in parallel.
+func (p *RawStreamPlug) Reply(replyTo uint64, messageCode string, payload messages.RawMessage) uint64 {
+	id, err := p.transport.send(replyTo, messageCode, payload)
 	if err != nil {
-		// If we can't write the response, panic — plugin cannot recover.
-		panic(err)
+		loggerOrDiscard(p.logger).LogAttrs(context.Background(), slog.LevelError, "writing message failed",
+			slog.String("type", messageCode), slog.Uint64("replyTo", replyTo), slog.Any("error", err))
+		p.fail(err)
+	}
+	return id
+}
+
+// fail records err as the cause of the end of the session, unless another one was recorded
+// first, and shuts the plug down.
+func (p *RawStreamPlug) fail(err error) {
+	p.failMu.Lock()
+	if p.failed == nil {
+		p.failed = err
 	}
+	p.failMu.Unlock()
+	p.Shutdown()
 }
 
 // Loop contains the main logic of the RawStreamPlug. It takes care of decoding the incoming
-// CBOR payload and sends it to handler asynchronously.
+// payload and sends it to handler asynchronously.
 // Handler must decode the type of the message and respond accordingly. This plug type does
 // not guarantee the order of incoming and outgoing messages.
 // It is up to implementer to handle logic.
+//
+// Messages are read in the background, so the loop stops on Shutdown and on signals
+// right away, without waiting for the next message from the host. Once the host ended the
+// session with codes.ExitMessage, the loop keeps reading until the running handlers are done,
+// so cancellations, heartbeats and call results still reach them; other messages are dropped.
 func (p *RawStreamPlug) Loop() {
+	defer p.wg.Done()
+	in := make(chan received)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go p.read(in, stopped)
 
-loop:
 	for {
 		select {
 		case <-p.ossig.Done():
-
 			p.wg.Add(1)
 			go func() {
 				p.PlugImpl.CloseSignal()
 				p.osstop()
 				p.wg.Done()
 			}()
-			break loop
+			return
 		case <-p.implsig.Done():
-			p.wg.Done()
-			break loop
-		default:
-			var msg messages.Envelope
-			if err := p.decoder.Decode(&msg); err != nil {
-				err := p.encoder.Encode(messages.Envelope{
-					Version: 1,
-					Type:    string(codes.PayloadMalformed),
-					Raw:     helpers.MustRaw(&messages.MessageUnsupported{}),
-				})
+			return
+		case <-p.idle:
+			if p.exitID != 0 && p.running.Load() == 0 {
+				return
+			}
+		case r := <-in:
+			msg := r.msg
+			if err := r.err; err != nil {
+				if errors.Is(err, io.EOF) {
+					// The host closed the stream.
+					p.closeSignal()
+					return
+				}
+				if errors.Is(err, messages.ErrLimitExceeded) {
+					// The stream cannot be read any further.
+					p.transport.reject(err)
+					p.fail(err)
+					p.closeSignal()
+					return
+				}
+				_, err := p.transport.send(0, string(codes.PayloadMalformed), p.transport.raw(&messages.MessageUnsupported{}))
 				if err != nil {
-					panic(err)
+					loggerOrDiscard(p.logger).LogAttrs(context.Background(), slog.LevelError, "writing message failed",
+						slog.String("type", string(codes.PayloadMalformed)), slog.Any("error", err))
+					p.fail(err)
+					p.closeSignal()
+					return
+				}
+				continue
+			}
+
+			if rejectVersion(p.transport, &msg) || answerPing(p.transport, &msg) || answerDescribe(p.transport, &msg, p.description) || p.transport.answered(&msg) {
+				continue
+			}
+
+			if msg.Type == string(codes.ExitMessage) {
+				if p.exitID != 0 {
+					continue
 				}
+				// The host ends the session. Running handlers are left to complete,
+				// and Main reports the PluginFinish afterwards.
+				p.closeSignal()
+				p.exitID = msg.ID
+				if p.running.Load() == 0 {
+					return
+				}
+				continue
+			}
 
+			impl, ok := p.PlugImpl.(RawStreamPlugContextImpl)
+			if ok {
+				if id, ok := cancelled(p.transport, &msg); ok {
+					p.requests.cancel(id)
+					continue
+				}
+			}
+			if p.exitID != 0 && msg.Type != string(codes.CancelMessage) {
+				// The session is over; no further commands are handed to the implementation.
+				continue
 			}
 
 			p.wg.Add(1)
+			p.running.Add(1)
+			if ok {
+				ctx, done := p.requests.begin(p.handlers, msg.ID)
+				go p.contextResponseWrapper(ctx, impl, done, msg)
+				continue
+			}
 			go p.responseWrapper(msg)
-
 		}
 	}
+}
 
+// closeSignal calls CloseSignal of the implementation, unless the session was already
+// closed by the host.
+func (p *RawStreamPlug) closeSignal() {
+	if p.exitID == 0 {
+		p.PlugImpl.CloseSignal()
+	}
 }
 
-func (p *RawStreamPlug) responseWrapper(msg messages.Envelope) {
-	p.PlugImpl.Handle(msg.Type, msg.Raw)
+// handled records that a handler returned, and wakes up a draining Loop.
+func (p *RawStreamPlug) handled() {
+	p.running.Add(-1)
+	select {
+	case p.idle <- struct{}{}:
+	default:
+	}
 	p.wg.Done()
+}
+
+// received is a message read from the host, or the error that broke the stream.
+type received struct {
+	msg messages.Envelope
+	err error
+}
+
+// read reads messages from the host and passes them to Loop until the stream breaks
+// or the loop stops. Messages that cannot be decoded are passed on with their error.
+func (p *RawStreamPlug) read(in chan<- received, stopped <-chan struct{}) {
+	for {
+		var r received
+		r.err = p.transport.receive(&r.msg)
+		select {
+		case in <- r:
+		case <-stopped:
+			return
+		}
+		if errors.Is(r.err, io.EOF) || errors.Is(r.err, messages.ErrLimitExceeded) {
+			return
+		}
+	}
+}
+
+func (p *RawStreamPlug) responseWrapper(msg messages.Envelope) {
+	if crash := recovered(func() { p.PlugImpl.Handle(msg.Type, msg.Raw, msg.ID, msg.ReplyTo) }); crash != nil {
+		p.crashed(&msg, crash)
+	}
+	p.handled()
+}
+
+func (p *RawStreamPlug) contextResponseWrapper(ctx context.Context, impl RawStreamPlugContextImpl, done func(), msg messages.Envelope) {
+	if crash := recovered(func() { impl.HandleContext(ctx, msg.Type, msg.Raw, msg.ID, msg.ReplyTo) }); crash != nil {
+		p.crashed(&msg, crash)
+	}
+	done()
+	p.handled()
+}
+
+// crashed reports a panic recovered from a handler and applies the panic policy.
+// With FinishOnPanic, the plug shuts down, and Main reports a PluginFinish and returns the panic.
+func (p *RawStreamPlug) crashed(msg *messages.Envelope, crash *panicked) {
+	finishing := p.onPanic == FinishOnPanic
+	reportCrash(p.transport, loggerOrDiscard(p.logger), msg, crash, finishing)
+	if finishing {
+		p.fail(crash)
+	}
+}
 
+// SetPanicPolicy selects what the plug does after a handler panicked, see PanicPolicy.
+// The panic is always recovered and reported to the host as codes.PluginCrashed.
+func (p *RawStreamPlug) SetPanicPolicy(policy PanicPolicy) {
+	p.onPanic = policy
 }
 
 // Shutdown sends signal to shut down the plug. As the plug can be long living, it has to have a control mechanism
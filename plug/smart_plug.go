@@ -3,45 +3,84 @@
 
 // Package plug provides the default runtime for a PlugKit-compatible plugin.
 //
-// A SmartPlug is a minimal, one-shot command handler that receives a CBOR-encoded
-// Envelope from the host via stdin, processes it using a registered handler,
-// sends a response back to stdout, and terminates with a specific exit code.
+// A SmartPlug is a minimal command handler that receives CBOR-encoded
+// Envelopes from the host via stdin, processes them using registered handlers,
+// and sends responses back to stdout until the host ends the session.
+// Plugs written in other languages may speak JSON or MessagePack instead, see package codec.
+// It can also run in one-shot mode, serving a single command and terminating
+// with a specific exit code.
 //
 // This simple model allows for sandboxed, transactional plugin operations
 // using structured messaging.
 package plug
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit/codec"
 	"github.com/mjwhodur/plugkit/codes"
-	"github.com/mjwhodur/plugkit/helpers"
 	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/schema"
 )
 
-// SmartPlug is a most standard type of plug. It supports one-off comand.
+// HandlerFunc is a SmartPlug message handler that receives the context of the host request.
+//
+// The context is cancelled when the host abandons the request with codes.CancelMessage
+// (e.g. its deadline passed), or when the plug is shutting down.
+type HandlerFunc func(ctx context.Context, payload []byte) (*messages.Result, codes.PluginExitReason, error)
+
+// SmartPlug is a most standard type of plug. It serves commands in a session.
 // SmartPlug is the one of the runtime structures for a PlugKit plugin.
 //
 // It supports registering handlers for specific message types and
-// handles a single Envelope message per execution.
+// handles Envelope messages until the host ends the session, or a single
+// Envelope message per execution in one-shot mode.
 type SmartPlug struct {
+	common
 	Handlers map[string]func([]byte) (result *messages.Result, exitReason codes.PluginExitReason, e error)
-	decoder  *cbor.Decoder
-	encoder  *cbor.Encoder
+	oneShot  bool
+	served   bool // in one-shot mode: the command has been handed to its handler
+	onPanic  PanicPolicy
+	strict   bool
+	parallel int // handlers allowed to run at once, see SetConcurrency
+
+	contextHandlers map[string]HandlerFunc
+	signatures      map[string]Signature // of the handlers registered with Handle
+	description     *messages.Description
+	requests        inflight
+	ctx             context.Context
+	sem             chan struct{} // held by the running handlers
+	wg              sync.WaitGroup
+	ended           chan struct{}
+	endOnce         sync.Once
+	endErr          error
+	closing         func() error
+	draining        atomic.Bool // the host ended the session; running handlers are left to complete
 }
 
 // New creates a new SmartPlug instance wired to stdin and stdout.
+// If the host offers dedicated protocol pipes, the plug moves to them during the handshake,
+// and stdout is left for ordinary output.
 //
 // A default "exit" message handler is registered, which allows the host
 // to gracefully terminate the plugin if needed.
 func New() *SmartPlug {
 	h := &SmartPlug{}
 	h.Handlers = make(map[string]func([]byte) (result *messages.Result, exitReason codes.PluginExitReason, e error))
-	h.decoder = cbor.NewDecoder(os.Stdin)
-	h.encoder = cbor.NewEncoder(os.Stdout)
+	h.transport = newTransport(os.Stdin, os.Stdout)
 
 	// FIXME: Fix message to correctly support cleanup and disposing
 	h.Handlers["exit"] = func(_ []byte) (result *messages.Result, exitReason codes.PluginExitReason, e error) {
@@ -56,129 +95,478 @@ func New() *SmartPlug {
 // by SmartPlug.
 //
 // It performs CBOR decoding of the input and passes the resulting value to the user-defined handler.
+// Fields tagged `plugkit:"required"` must be present, and an input implementing Validator must
+// pass validation; otherwise the request is rejected with codes.PayloadMalformed, see PayloadError.
 func WrapSmartPlugTypedHandler[In any](
 	fn func(In) (*messages.Result, codes.PluginExitReason, error),
 ) func([]byte) (*messages.Result, codes.PluginExitReason, error) {
+	return wrapTyped(fn, cborCodec, func() bool { return false })
+}
+
+// cborCodec is the codec of the payloads passed to untyped handlers.
+func cborCodec() codec.Codec {
+	return codec.CBOR
+}
+
+// wrapTyped adapts a typed handler, decoding its input with the codec returned by c,
+// strictly if strict returns true.
+func wrapTyped[In any](
+	fn func(In) (*messages.Result, codes.PluginExitReason, error),
+	c func() codec.Codec,
+	strict func() bool,
+) func([]byte) (*messages.Result, codes.PluginExitReason, error) {
+	inputSchema := schema.For[In]()
 	return func(raw []byte) (*messages.Result, codes.PluginExitReason, error) {
-		var input In
-		if err := cbor.Unmarshal(raw, &input); err != nil {
-			return nil, codes.HostToPluginCommunicationError, fmt.Errorf("CBOR decode error: %w", err)
+		input, err := decodePayload[In](c(), inputSchema, raw, strict())
+		if err != nil {
+			return nil, codes.DataFormatError, err
 		}
 
 		return fn(input)
 	}
 }
 
+// HandleSmartPlugMessage registers a strongly-typed handler, see WrapSmartPlugTypedHandler.
+// Its input is decoded strictly if the plug has strict decoding on, see SetStrictDecoding.
 func HandleSmartPlugMessage[In any](
 	s *SmartPlug,
 	messageType string,
 	handler func(In) (*messages.Result, codes.PluginExitReason, error),
 ) {
-	s.HandleMessageType(messageType, WrapSmartPlugTypedHandler(handler))
+	s.HandleMessageType(messageType, wrapTyped(handler, s.Codec, s.strictDecoding))
+	s.sign(messageType, Signature{Request: reflect.TypeFor[In]()})
+}
+
+// WrapSmartPlugTypedHandlerContext is the context-aware counterpart of WrapSmartPlugTypedHandler.
+func WrapSmartPlugTypedHandlerContext[In any](
+	fn func(context.Context, In) (*messages.Result, codes.PluginExitReason, error),
+) HandlerFunc {
+	return wrapTypedContext(fn, cborCodec, func() bool { return false })
+}
+
+// wrapTypedContext is the context-aware counterpart of wrapTyped.
+func wrapTypedContext[In any](
+	fn func(context.Context, In) (*messages.Result, codes.PluginExitReason, error),
+	c func() codec.Codec,
+	strict func() bool,
+) HandlerFunc {
+	inputSchema := schema.For[In]()
+	return func(ctx context.Context, raw []byte) (*messages.Result, codes.PluginExitReason, error) {
+		input, err := decodePayload[In](c(), inputSchema, raw, strict())
+		if err != nil {
+			return nil, codes.DataFormatError, err
+		}
+
+		return fn(ctx, input)
+	}
+}
+
+// HandleSmartPlugMessageContext registers a strongly-typed, context-aware handler,
+// see HandleMessageTypeContext and HandleSmartPlugMessage.
+func HandleSmartPlugMessageContext[In any](
+	s *SmartPlug,
+	messageType string,
+	handler func(context.Context, In) (*messages.Result, codes.PluginExitReason, error),
+) {
+	s.HandleMessageTypeContext(messageType, wrapTypedContext(handler, s.Codec, s.strictDecoding))
+	s.sign(messageType, Signature{Request: reflect.TypeFor[In]()})
 }
 
 // HandleMessageType registers a function to handle a given message type.
 //
 // The handler receives raw CBOR-encoded data from the Envelope and is
-// responsible for decoding and processing it.
+// responsible for decoding and processing it. Payloads arriving in another codec
+// (see SetCodec) are converted to CBOR first; as JSON has no byte strings, binary fields
+// sent in JSON arrive as base64 text strings. Typed handlers (see Handle) decode them as usual.
 //
 // The handler must return a messages.Result (or nil), a PluginExitReason,
 // and an error (or nil). message.Result must contain status code, and value of the response.
+// The PluginExitReason is sent to the host in Result.ExitCode, unless the result sets one itself.
+// If the handler returns an error, the host receives a failed result carrying the exit reason
+// and the error (see messages.NewError); the session goes on. Return a *plugkit.RemoteError
+// to attach details or to mark the failure as retryable.
 func (h *SmartPlug) HandleMessageType(name string, handler func([]byte) (*messages.Result, codes.PluginExitReason, error)) {
 	// FIXME: Make this function more generic - it needs to have nice interface
+	delete(h.contextHandlers, name)
+	delete(h.signatures, name)
 	h.Handlers[name] = handler
 }
 
+// HandleMessageTypeContext registers a context-aware function to handle a given message type.
+//
+// It works like HandleMessageType, but the handler also receives the context of the host
+// request, which is cancelled when the host abandons the request or the plug is shutting down.
+// Long-running handlers should watch it and return early.
+func (h *SmartPlug) HandleMessageTypeContext(name string, handler HandlerFunc) {
+	if h.contextHandlers == nil {
+		h.contextHandlers = make(map[string]HandlerFunc)
+	}
+	delete(h.Handlers, name)
+	delete(h.signatures, name)
+	h.contextHandlers[name] = handler
+}
+
+// handler returns the handler registered for the given message type.
+//
+// Untyped handlers receive CBOR whatever the codec of the session, while typed ones decode
+// the payload with the codec of the session themselves, see Signatures.
+func (h *SmartPlug) handler(messageType string) (HandlerFunc, bool) {
+	handler, ok := h.contextHandlers[messageType]
+	if !ok {
+		legacy, found := h.Handlers[messageType]
+		if !found {
+			return nil, false
+		}
+		handler = func(_ context.Context, payload []byte) (*messages.Result, codes.PluginExitReason, error) {
+			return legacy(payload)
+		}
+	}
+
+	c := h.Codec()
+	if _, typed := h.signatures[messageType]; typed || c == codec.CBOR {
+		return handler, true
+	}
+	return func(ctx context.Context, payload []byte) (*messages.Result, codes.PluginExitReason, error) {
+		var v any
+		if err := c.Unmarshal(payload, &v); err != nil {
+			return nil, codes.DataFormatError, &PayloadError{Err: err}
+		}
+		data, err := cbor.Marshal(v)
+		if err != nil {
+			return nil, codes.DataFormatError, &PayloadError{Err: err}
+		}
+		return handler(ctx, data)
+	}, true
+}
+
+// messageTypes returns the sorted names of all registered handlers.
+func (h *SmartPlug) messageTypes() []string {
+	types := make([]string, 0, len(h.Handlers)+len(h.contextHandlers))
+	for t := range h.Handlers {
+		types = append(types, t)
+	}
+	for t := range h.contextHandlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// SetOneShot switches the plug between session mode (the default) and one-shot mode.
+//
+// In session mode Main serves any number of commands over a single process lifetime.
+// In one-shot mode Main returns right after the first command has been handled,
+// which matches the behaviour of PlugKit plugs prior to sessions.
+func (h *SmartPlug) SetOneShot(oneShot bool) {
+	h.oneShot = oneShot
+}
+
+// SetStrictDecoding turns strict decoding of the requests of handlers registered with
+// HandleSmartPlugMessage and HandleSmartPlugMessageContext on or off. In strict mode, requests
+// with unknown fields or duplicate map keys are rejected with codes.PayloadMalformed, instead
+// of the unknown fields being ignored. Handlers registered with Handle always decode strictly.
+func (h *SmartPlug) SetStrictDecoding(strict bool) {
+	h.strict = strict
+}
+
+// strictDecoding reports whether strict decoding is on, see SetStrictDecoding.
+func (h *SmartPlug) strictDecoding() bool {
+	return h.strict
+}
+
+// SetConcurrency sets how many handlers may run at once. The default is one: commands sent
+// while a handler runs wait for it to complete. Must be called before Main.
+func (h *SmartPlug) SetConcurrency(n int) {
+	h.parallel = max(n, 1)
+}
+
+// SetPanicPolicy selects what the plug does after a handler panicked, see PanicPolicy.
+// The panic is always recovered and reported to the host as codes.PluginCrashed.
+func (h *SmartPlug) SetPanicPolicy(policy PanicPolicy) {
+	h.onPanic = policy
+}
+
 // Main runs the main routine of the plugin.
 //
-// It waits for a single incoming message, dispatches it to the appropriate handler,
-// sends back any response, and terminates with the declared PluginExitReason.
+// It answers the host handshake first, and returns an error if the host is not
+// a compatible PlugKit host.
+// It then serves incoming messages, dispatching each one to the appropriate handler and
+// sending back its response, until the host sends codes.ExitMessage or closes stdin.
+// A handler returning a nil result also ends the session, and the plug reports a
+// PluginFinish with the handler's exit reason.
+//
+// Handlers run one at a time unless SetConcurrency allows more, while Main keeps reading from
+// the host, so a codes.CancelMessage reaches the context of a running handler (see
+// HandleMessageTypeContext).
+// On SIGINT or SIGTERM the contexts of all handlers are cancelled, and Main returns once
+// they are done, reporting codes.OperationCancelledByPlugin to the host. When the host ends
+// the session with codes.ExitMessage, running handlers are left to complete instead (the host
+// may still cancel them), and the PluginFinish is sent once they are done.
 //
-// This function is designed for one-shot plugin invocations. It should be called
-// from the plugin's main() function.
+// In one-shot mode (see SetOneShot) only a single message is served.
+// If the host sent a message exceeding the decoder limits (see SetDecoderLimits), Main
+// returns a *messages.LimitError.
+// This function should be called from the plugin's main() function.
 func (h *SmartPlug) Main() error {
-	// FIXME: Add handshake
-	// FIXME: Add exit and possibly other signals
-	exitCode := codes.OperationSuccess
+	if err := h.transport.limit(h.limits); err != nil {
+		return err
+	}
+	features := []string{}
+	if !h.oneShot {
+		features = append(features, messages.FeatureSessions)
+	}
+	hostInfo, err := acceptHandshake(h.transport, plugHello(h.name, h.messageTypes(), features), h.codec)
+	if err != nil {
+		return err
+	}
+	h.hostInfo = hostInfo
+	h.description = describe(h.name, h.metadata, h.messageTypes(), h.signatures)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h.ctx = ctx
+	h.sem = make(chan struct{}, max(h.parallel, 1))
+	h.ended = make(chan struct{})
 
-	var msg messages.Envelope
-	if err := h.decoder.Decode(&msg); err != nil {
-		h.Finish("Malformed message received", codes.HostToPluginCommunicationError)
+	go h.receive()
 
+	select {
+	case <-h.ended:
+	case <-ctx.Done():
+		h.endWith(0, "Plug interrupted", codes.OperationCancelledByPlugin)
 	}
+	if !h.draining.Load() {
+		cancel()
+	}
+	h.wg.Wait()
 
-	if msg.Type == string(codes.Unsupported) {
-		h.Finish("Unsupported message received from host", codes.PluginToHostCommunicationError)
+	if h.closing != nil {
+		if err := h.closing(); err != nil {
+			return err
+		}
 	}
+	return h.endErr
+}
 
-	if handler, ok := h.Handlers[msg.Type]; ok {
-		// endMessage := ""
-		resp, _, err := handler(msg.Raw) //FIXME: Doesn't propagate the exit code
-		if err != nil {
-			panic(err)
+// receive reads messages from the host until the session is over.
+func (h *SmartPlug) receive() {
+	for {
+		var msg messages.Envelope
+		if err := h.transport.receive(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				if h.oneShot && h.served {
+					// The handler of the only command ends the session once it is done.
+					return
+				}
+				// The host closed the session.
+				h.end(nil)
+				return
+			}
+			if errors.Is(err, messages.ErrLimitExceeded) {
+				h.transport.reject(err)
+				h.fail(err, codes.DataFormatError)
+				return
+			}
+			h.endWith(0, "Malformed message received", codes.HostToPluginCommunicationError)
+			return
 		}
-		if resp != nil {
-			h.Respond(resp)
+
+		if !h.serve(msg) {
+			return
 		}
-		// h.Finish(endMessage, exitCode)
-
-	} else {
-		err := h.encoder.Encode(messages.Envelope{
-			Version: 1,
-			Type:    string(codes.Unsupported),
-			Raw:     helpers.MustRaw(&messages.MessageUnsupported{}),
-		})
-		if err != nil {
-			return err
+	}
+}
+
+// serve processes a single message received from the host. Commands are handed over
+// to their handlers in the background.
+// It reports whether more messages should be read.
+func (h *SmartPlug) serve(msg messages.Envelope) bool {
+	if rejectVersion(h.transport, &msg) {
+		if h.oneShot {
+			h.end(fmt.Errorf("%w: %d", messages.ErrUnsupportedVersion, msg.Version))
+			return false
+		}
+		return true
+	}
+
+	if id, ok := cancelled(h.transport, &msg); ok {
+		h.requests.cancel(id)
+		return true
+	}
+	if answerPing(h.transport, &msg) || answerDescribe(h.transport, &msg, h.description) || h.transport.answered(&msg) {
+		return true
+	}
+
+	switch msg.Type {
+	case string(codes.Unsupported):
+		h.endWith(0, "Unsupported message received from host", codes.PluginToHostCommunicationError)
+		return false
+	case string(codes.ExitMessage):
+		h.draining.Store(true)
+		h.endWith(msg.ID, "Session closed by host", codes.OperationSuccess)
+		// Reading goes on, so cancellations, heartbeats and call results still reach
+		// the handlers left to complete.
+		return true
+	}
+	if h.draining.Load() {
+		// The session is over; no further commands are served.
+		return true
+	}
+
+	handler, ok := h.handler(msg.Type)
+	if !ok {
+		_, err := h.transport.send(msg.ID, string(codes.Unsupported), h.transport.raw(&messages.MessageUnsupported{}))
+		if err != nil || h.oneShot {
+			h.end(err)
+			return false
 		}
+		return true
+	}
+
+	// The context is registered before the handler starts, so a cancellation sent
+	// right after the command cannot be missed.
+	ctx, done := h.requests.begin(h.ctx, msg.ID)
+	h.served = true
+	h.wg.Add(1)
+	go h.run(ctx, done, msg, handler)
+	return true
+}
 
+// run serves a single command with its handler and answers the host.
+func (h *SmartPlug) run(ctx context.Context, done func(), msg messages.Envelope, handler HandlerFunc) {
+	defer h.wg.Done()
+	defer done()
+	if h.oneShot {
+		defer h.end(nil)
 	}
 
-	switch exitCode {
-	case codes.OperationSuccess:
-		return nil
+	select {
+	case h.sem <- struct{}{}:
+	case <-ctx.Done():
+		// Abandoned by the host before the handler started.
+		loggerOrDiscard(h.logger).LogAttrs(ctx, slog.LevelDebug, "command abandoned before it started",
+			slog.String("type", msg.Type), slog.Uint64("id", msg.ID))
+		return
+	}
+	defer func() { <-h.sem }()
+
+	started := time.Now()
+	var resp *messages.Result
+	var exitReason codes.PluginExitReason
+	var err error
+	if crash := recovered(func() { resp, exitReason, err = handler(ctx, msg.Raw) }); crash != nil {
+		finishing := h.onPanic == FinishOnPanic
+		reportCrash(h.transport, loggerOrDiscard(h.logger), &msg, crash, finishing)
+		if finishing {
+			h.endWith(0, crash.Error(), codes.PlugCrashed)
+		}
+		return
+	}
+	loggerOrDiscard(h.logger).LogAttrs(ctx, slog.LevelDebug, "command served",
+		slog.String("type", msg.Type), slog.Uint64("id", msg.ID), slog.Duration("duration", time.Since(started)),
+		slog.Bool("cancelled", ctx.Err() != nil))
+	var payloadErr *PayloadError
+	if errors.As(err, &payloadErr) {
+		rejectPayload(h.transport, loggerOrDiscard(h.logger), &msg, payloadErr)
+		return
+	}
+	if err != nil {
+		h.respond(msg.ID, failedResult(resp, exitReason, err))
+		return
+	}
+	if resp == nil {
+		h.endWith(msg.ID, "", exitReason)
+		return
+	}
+	if resp.ExitCode == codes.OperationSuccess && exitReason != codes.OperationSuccess {
+		r := *resp
+		r.ExitCode = exitReason
+		resp = &r
+	}
+	h.respond(msg.ID, resp)
+}
 
-	default:
-		// FIXME: Handle the exit codes to messages?
-		return errors.New(string(rune(exitCode)))
+// failedResult builds the result reported to the host for a handler that returned an error,
+// see messages.NewError.
+func failedResult(resp *messages.Result, exitReason codes.PluginExitReason, err error) *messages.Result {
+	r := &messages.Result{}
+	if resp != nil {
+		*r = *resp
 	}
+	r.Error = messages.NewError(err, exitReason)
+	r.ExitCode = r.Error.Code
+	return r
+}
+
+// end ends the session. err is returned from Main.
+func (h *SmartPlug) end(err error) {
+	h.endOnce.Do(func() {
+		h.endErr = err
+		close(h.ended)
+	})
+}
+
+// endWith ends the session, and reports a PluginFinish to the host once every running
+// handler has returned. replyTo is the ID of the host message that ended the session, if any.
+func (h *SmartPlug) endWith(replyTo uint64, message string, code codes.PluginExitReason) {
+	h.endOnce.Do(func() {
+		h.closing = func() error {
+			return h.finish(replyTo, message, code)
+		}
+		close(h.ended)
+	})
+}
+
+// fail ends the session like endWith, because of err, which Main returns.
+func (h *SmartPlug) fail(err error, code codes.PluginExitReason) {
+	h.endOnce.Do(func() {
+		h.closing = func() error {
+			if finishErr := h.finish(0, err.Error(), code); finishErr != nil {
+				return finishErr
+			}
+			return err
+		}
+		close(h.ended)
+	})
 }
 
 // Respond sends a typed message to the host.
 //
-// It wraps the payload into a CBOR-encoded Envelope and writes it to stdout.
-// Panics if encoding fails.
+// It wraps the payload into an Envelope and writes it to stdout.
+// Panics if encoding fails. If the message cannot be written, e.g. because the host
+// went away, the error is logged and the session ends; Main returns the error.
 //
-// Should only be used from within message handlers.
+// Should only be used from within message handlers. The response is not correlated
+// with any request; results returned from handlers are answered automatically.
 func (h *SmartPlug) Respond(r *messages.Result) {
-	err := h.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    string(codes.PluginResponse),
-		Raw:     helpers.MustRaw(r),
-	})
+	h.respond(0, r)
+}
+
+// respond sends a result answering the host message with the given ID.
+// A failed write ends the session, as the host cannot be reached any longer.
+func (h *SmartPlug) respond(replyTo uint64, r *messages.Result) {
+	_, err := h.transport.send(replyTo, string(codes.PluginResponse), h.transport.raw(r))
 	if err != nil {
-		panic(err)
+		loggerOrDiscard(h.logger).LogAttrs(context.Background(), slog.LevelError, "writing response failed",
+			slog.String("type", r.Type), slog.Uint64("replyTo", replyTo), slog.Any("error", err))
+		h.end(err)
 	}
-	// FIXME: No support for errors
-	// FIXME: Panics need to be handled on host side!
 }
 
 // Finish sends a PluginFinish message and terminates the plugin process.
 //
 // The plugin will exit with the given PluginExitReason code.
 func (h *SmartPlug) Finish(message string, code codes.PluginExitReason) {
-	val := &messages.PluginFinish{
-		Reason:  code,
-		Message: message,
-	}
-
-	err := h.encoder.Encode(messages.Envelope{
-		Version: 1,
-		Type:    string(codes.FinishMessage),
-		Raw:     helpers.MustRaw(val),
-	})
-	if err != nil {
+	if err := h.finish(0, message, code); err != nil {
 		os.Exit(int(codes.OperationError))
 	}
 	os.Exit(int(code))
 }
+
+// finish sends a PluginFinish message to the host without terminating the process.
+// replyTo is the ID of the host message that ended the session, if any.
+func (h *SmartPlug) finish(replyTo uint64, message string, code codes.PluginExitReason) error {
+	return h.transport.finish(replyTo, message, code)
+}
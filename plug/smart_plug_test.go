@@ -0,0 +1,296 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// command returns the envelope of a host command with the given ID, type and payload.
+func command(id uint64, messageType string, v any) messages.Envelope {
+	return messages.Envelope{
+		Version: messages.ProtocolVersion,
+		ID:      id,
+		Type:    messageType,
+		Raw:     codec.MustMarshal(codec.CBOR, v),
+	}
+}
+
+// runSession runs p over a session in which the host sends msgs after the handshake,
+// and returns the messages p sent after its hello and the error of Main.
+// The host keeps its end of the stream open until Main returns.
+func runSession(t *testing.T, p *SmartPlug, msgs ...messages.Envelope) ([]messages.Envelope, error) {
+	t.Helper()
+	var out bytes.Buffer
+	in := append([]messages.Envelope{helloFrom(messages.MinProtocolVersion, messages.ProtocolVersion)}, msgs...)
+	open, hold := io.Pipe()
+	p.transport = newTransport(io.MultiReader(hostStream(t, in...), open), &out)
+	err := p.Main()
+	_ = hold.Close()
+	sent := plugStream(t, &out)
+	if len(sent) == 0 || sent[0].Type != string(codes.HelloMessage) {
+		t.Fatalf("plug did not answer the hello: %+v", sent)
+	}
+	return sent[1:], err
+}
+
+// answer returns the message answering the host message with the given ID.
+// Handlers may answer in any order.
+func answer(t *testing.T, sent []messages.Envelope, id uint64) messages.Envelope {
+	t.Helper()
+	for _, msg := range sent {
+		if msg.ReplyTo == id {
+			return msg
+		}
+	}
+	t.Fatalf("no answer to message %d in %+v", id, sent)
+	return messages.Envelope{}
+}
+
+// result decodes the result carried by a codes.PluginResponse.
+func result(t *testing.T, msg messages.Envelope) *messages.Result {
+	t.Helper()
+	if msg.Type != string(codes.PluginResponse) {
+		t.Fatalf("got %q message, want %q", msg.Type, codes.PluginResponse)
+	}
+	var r messages.Result
+	if err := codec.CBOR.Unmarshal(msg.Raw, &r); err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+// finished decodes the PluginFinish of a codes.FinishMessage.
+func finished(t *testing.T, msg messages.Envelope) *messages.PluginFinish {
+	t.Helper()
+	if msg.Type != string(codes.FinishMessage) {
+		t.Fatalf("got %q message, want %q", msg.Type, codes.FinishMessage)
+	}
+	var fin messages.PluginFinish
+	if err := codec.CBOR.Unmarshal(msg.Raw, &fin); err != nil {
+		t.Fatal(err)
+	}
+	return &fin
+}
+
+type ping struct {
+	N int `cbor:"n"`
+}
+
+// newPingPlug returns a SmartPlug answering "ping" with its input.
+func newPingPlug() *SmartPlug {
+	p := New()
+	HandleSmartPlugMessage(p, "ping", func(in ping) (*messages.Result, codes.PluginExitReason, error) {
+		return &messages.Result{Type: "pong", Value: in}, codes.OperationSuccess, nil
+	})
+	return p
+}
+
+func TestSmartPlugSession(t *testing.T) {
+	sent, err := runSession(t, newPingPlug(),
+		command(2, "ping", ping{1}),
+		command(3, "ping", ping{2}),
+		command(4, string(codes.ExitMessage), nil),
+	)
+	if err != nil {
+		t.Fatalf("Main: %v", err)
+	}
+	if len(sent) != 3 {
+		t.Fatalf("plug sent %d messages, want 2 results and a finish: %+v", len(sent), sent)
+	}
+	for id := uint64(2); id <= 3; id++ {
+		if r := result(t, answer(t, sent, id)); r.Type != "pong" {
+			t.Errorf("result %d = %+v", id, r)
+		}
+	}
+	// The session ends once every handler is done.
+	if fin := finished(t, sent[2]); fin.Reason != codes.OperationSuccess || sent[2].ReplyTo != 4 {
+		t.Errorf("finish = %+v answering %d, want success answering 4", fin, sent[2].ReplyTo)
+	}
+}
+
+func TestSmartPlugOneShot(t *testing.T) {
+	p := newPingPlug()
+	p.SetOneShot(true)
+	sent, err := runSession(t, p, command(2, "ping", ping{1}))
+	if err != nil {
+		t.Fatalf("Main: %v", err)
+	}
+	if len(sent) != 1 || result(t, sent[0]).Type != "pong" {
+		t.Errorf("plug sent %+v, want a single result", sent)
+	}
+}
+
+func TestSmartPlugOneShotClosedInput(t *testing.T) {
+	p := newPingPlug()
+	p.SetOneShot(true)
+	// The host closes stdin right after its command; the command is served anyway.
+	var out bytes.Buffer
+	p.transport = newTransport(hostStream(t, helloFrom(messages.MinProtocolVersion, messages.ProtocolVersion), command(2, "ping", ping{1})), &out)
+	if err := p.Main(); err != nil {
+		t.Fatalf("Main: %v", err)
+	}
+	sent := plugStream(t, &out)[1:]
+	if len(sent) != 1 || result(t, sent[0]).Type != "pong" || sent[0].ReplyTo != 2 {
+		t.Errorf("plug sent %+v, want a single result", sent)
+	}
+}
+
+func TestSmartPlugUnsupported(t *testing.T) {
+	sent, _ := runSession(t, newPingPlug(),
+		command(2, "nope", nil),
+		command(3, string(codes.ExitMessage), nil),
+	)
+	if len(sent) != 2 || sent[0].Type != string(codes.Unsupported) || sent[0].ReplyTo != 2 {
+		t.Errorf("plug sent %+v, want Unsupported answering 2 and a finish", sent)
+	}
+}
+
+func TestSmartPlugCancel(t *testing.T) {
+	p := New()
+	HandleSmartPlugMessageContext(p, "wait", func(ctx context.Context, in ping) (*messages.Result, codes.PluginExitReason, error) {
+		<-ctx.Done()
+		return &messages.Result{Type: "pong", Value: in}, codes.OperationCancelledByClient, nil
+	})
+	// The cancellation arrives after the end of the session, while the plug drains.
+	sent, err := runSession(t, p,
+		command(2, "wait", ping{1}),
+		command(3, string(codes.ExitMessage), nil),
+		command(4, string(codes.CancelMessage), messages.Cancel{ID: 2}),
+	)
+	if err != nil {
+		t.Fatalf("Main: %v", err)
+	}
+	// The abandoned command is answered only if the handler had started before the cancellation.
+	if len(sent) == 0 || len(sent) > 2 {
+		t.Fatalf("plug sent %+v, want a finish, possibly after a result", sent)
+	}
+	if len(sent) == 2 {
+		if r := result(t, sent[0]); r.ExitCode != codes.OperationCancelledByClient || sent[0].ReplyTo != 2 {
+			t.Errorf("result = %+v answering %d, want %v answering 2", r, sent[0].ReplyTo, codes.OperationCancelledByClient)
+		}
+	}
+	if last := sent[len(sent)-1]; finished(t, last).Reason != codes.OperationSuccess || last.ReplyTo != 3 {
+		t.Errorf("plug finished with %+v, want success answering 3", last)
+	}
+}
+
+func TestSmartPlugConcurrency(t *testing.T) {
+	for _, parallel := range []int{1, 2} {
+		p := New()
+		p.SetConcurrency(parallel)
+		// Each handler waits for the other one to start, which only happens if they run in parallel.
+		var started sync.WaitGroup
+		started.Add(2)
+		all := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(all)
+		}()
+		HandleSmartPlugMessage(p, "meet", func(in ping) (*messages.Result, codes.PluginExitReason, error) {
+			started.Done()
+			select {
+			case <-all:
+				return &messages.Result{Type: "met", Value: in}, codes.OperationSuccess, nil
+			case <-time.After(100 * time.Millisecond):
+				return &messages.Result{Type: "alone", Value: in}, codes.OperationSuccess, nil
+			}
+		})
+		sent, err := runSession(t, p, command(2, "meet", ping{}), command(3, "meet", ping{}), command(4, string(codes.ExitMessage), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Run one at a time, the first handler gives up waiting before the second one starts.
+		met := 0
+		for id := uint64(2); id <= 3; id++ {
+			if result(t, answer(t, sent, id)).Type == "met" {
+				met++
+			}
+		}
+		if want := map[int]int{1: 1, 2: 2}[parallel]; met != want {
+			t.Errorf("with concurrency %d, %d handlers met, want %d", parallel, met, want)
+		}
+	}
+}
+
+func TestSmartPlugExitReason(t *testing.T) {
+	p := New()
+	HandleSmartPlugMessage(p, "partial", func(in ping) (*messages.Result, codes.PluginExitReason, error) {
+		return &messages.Result{Type: "pong", Value: in}, codes.OperationError, nil
+	})
+	HandleSmartPlugMessage(p, "own", func(in ping) (*messages.Result, codes.PluginExitReason, error) {
+		return &messages.Result{Type: "pong", Value: in, ExitCode: codes.DataFormatError}, codes.OperationError, nil
+	})
+	sent, err := runSession(t, p, command(2, "partial", ping{}), command(3, "own", ping{}), command(4, string(codes.ExitMessage), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The exit reason of the handler is reported, unless the result sets its own.
+	if r := result(t, answer(t, sent, 2)); r.ExitCode != codes.OperationError {
+		t.Errorf("exit code = %v, want %v", r.ExitCode, codes.OperationError)
+	}
+	if r := result(t, answer(t, sent, 3)); r.ExitCode != codes.DataFormatError {
+		t.Errorf("exit code = %v, want %v", r.ExitCode, codes.DataFormatError)
+	}
+
+	// A handler returning no result ends the session with its exit reason.
+	p = New()
+	HandleSmartPlugMessage(p, "done", func(ping) (*messages.Result, codes.PluginExitReason, error) {
+		return nil, codes.ErrNoInput, nil
+	})
+	sent, err = runSession(t, p, command(2, "done", ping{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("plug sent %+v, want a finish", sent)
+	}
+	if fin := finished(t, sent[0]); fin.Reason != codes.ErrNoInput || sent[0].ReplyTo != 2 {
+		t.Errorf("finish = %+v answering %d, want %v answering 2", fin, sent[0].ReplyTo, codes.ErrNoInput)
+	}
+}
+
+func TestSmartPlugDecoderLimits(t *testing.T) {
+	p := newPingPlug()
+	p.SetDecoderLimits(messages.DecoderLimits{MaxArrayElements: 16})
+	sent, err := runSession(t, p,
+		command(2, "ping", ping{1}),
+		command(3, "ping", make([]int, 100)),
+		command(4, "ping", ping{2}),
+	)
+	var limitErr *messages.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "array elements" {
+		t.Fatalf("Main() = %v, want an array elements *messages.LimitError", err)
+	}
+	// The plug tells the host, and ends the session: nothing after the oversized message is read.
+	var rejected, finishes int
+	for _, msg := range sent {
+		switch msg.Type {
+		case string(codes.PayloadMalformed):
+			rejected++
+		case string(codes.FinishMessage):
+			finishes++
+			if fin := finished(t, msg); fin.Reason != codes.DataFormatError {
+				t.Errorf("finish = %+v, want %v", fin, codes.DataFormatError)
+			}
+		case string(codes.PluginResponse):
+			if msg.ReplyTo != 2 {
+				t.Errorf("plug answered message %d after the rejection", msg.ReplyTo)
+			}
+		}
+	}
+	if rejected != 1 || finishes != 1 {
+		t.Errorf("plug sent %+v, want a rejection and a finish", sent)
+	}
+}
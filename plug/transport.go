@@ -0,0 +1,212 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+// discardLogger is used by plugs without a logger.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// loggerOrDiscard returns l, or a logger discarding every record if l is nil.
+func loggerOrDiscard(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return discardLogger
+	}
+	return l
+}
+
+// transport is the message channel between a plug and its host.
+//
+// Outgoing envelopes are stamped with the negotiated protocol version and a fresh message ID.
+// Writes are serialized, so handlers running in parallel may respond at any time.
+// Reads are not: a single goroutine is expected to receive messages.
+//
+// Messages are encoded with codec, the codec named by the host in messages.CodecEnv until
+// the handshake negotiates another one.
+type transport struct {
+	in      io.Reader
+	out     io.Writer
+	limits  messages.DecoderLimits
+	codec   codec.Codec
+	decoder codec.Decoder
+	encoder codec.Encoder
+	version int
+	ids     atomic.Uint64
+	mu      sync.Mutex
+
+	callsMu sync.Mutex
+	calls   map[uint64]chan messages.Envelope // calls to the host awaiting a result, by ID
+}
+
+// newTransport creates a transport reading from r and writing to w.
+func newTransport(r io.Reader, w io.Writer) *transport {
+	c := hostCodec()
+	// The default limits are always valid.
+	dec, _ := c.NewDecoder(r, messages.DecoderLimits{})
+	return &transport{
+		in:      r,
+		out:     w,
+		codec:   c,
+		decoder: dec,
+		encoder: c.NewEncoder(w),
+		version: messages.ProtocolVersion,
+	}
+}
+
+// hostCodec returns the codec the host named in messages.CodecEnv, or CBOR if it named none
+// this library speaks.
+func hostCodec() codec.Codec {
+	name := os.Getenv(messages.CodecEnv)
+	// Plugs started by this plug must not inherit it.
+	_ = os.Unsetenv(messages.CodecEnv)
+	if c, ok := codec.ByName(name); ok {
+		return c
+	}
+	return codec.CBOR
+}
+
+// limit sets the limits of the messages accepted from the host. It must be called before
+// the first message is received.
+func (t *transport) limit(limits messages.DecoderLimits) error {
+	dec, err := t.codec.NewDecoder(t.in, limits)
+	if err != nil {
+		return err
+	}
+	t.limits = limits
+	t.decoder = dec
+	return nil
+}
+
+// use switches the transport to another pair of streams, e.g. the dedicated protocol pipes
+// negotiated during the handshake.
+func (t *transport) use(r io.Reader, w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// The limits were validated by limit.
+	t.in, t.out = r, w
+	t.decoder, _ = t.codec.NewDecoder(r, t.limits)
+	t.encoder = t.codec.NewEncoder(w)
+}
+
+// switchCodec switches the transport to the codec negotiated during the handshake,
+// keeping the data already read from the host.
+func (t *transport) switchCodec(c codec.Codec) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.codec = c
+	t.in = io.MultiReader(t.decoder.Buffered(), t.in)
+	t.decoder, _ = c.NewDecoder(t.in, t.limits)
+	t.encoder = c.NewEncoder(t.out)
+}
+
+// raw encodes v with the codec of the transport.
+func (t *transport) raw(v any) messages.RawMessage {
+	return codec.MustMarshal(t.codec, v)
+}
+
+// reject tells the host that a message could not be read, e.g. because it exceeds the
+// decoder limits, with codes.PayloadMalformed answering no message.
+func (t *transport) reject(err error) {
+	_, _ = t.send(0, string(codes.PayloadMalformed), t.raw(&messages.Error{
+		Code:    codes.DataFormatError,
+		Message: err.Error(),
+	}))
+}
+
+// receive decodes the next message sent by the host.
+func (t *transport) receive(msg *messages.Envelope) error {
+	return t.decoder.Decode(msg)
+}
+
+// send writes a message to the host and returns the ID assigned to it.
+// replyTo is the ID of the host message being answered, or zero.
+func (t *transport) send(replyTo uint64, messageCode string, payload messages.RawMessage) (uint64, error) {
+	id := t.ids.Add(1)
+	return id, t.write(id, replyTo, messageCode, payload)
+}
+
+// write writes a message with the given ID to the host.
+func (t *transport) write(id, replyTo uint64, messageCode string, payload messages.RawMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.encoder.Encode(messages.Envelope{
+		Version: t.version,
+		ID:      id,
+		ReplyTo: replyTo,
+		Type:    messageCode,
+		Raw:     payload,
+	})
+	return err
+}
+
+// finish reports the end of the plug session to the host with a PluginFinish.
+// replyTo is the ID of the host message that ended the session, if any.
+func (t *transport) finish(replyTo uint64, message string, code codes.PluginExitReason) error {
+	_, err := t.send(replyTo, string(codes.FinishMessage), t.raw(&messages.PluginFinish{
+		Reason:  code,
+		Message: message,
+	}))
+	return err
+}
+
+// call sends a codes.CallMessage to the host and waits for its result until ctx ends.
+// The result is handed over by the goroutine receiving messages, see answered.
+func (t *transport) call(ctx context.Context, method string, args messages.RawMessage) (*messages.CallResult, error) {
+	id := t.ids.Add(1)
+	reply := make(chan messages.Envelope, 1)
+	t.callsMu.Lock()
+	if t.calls == nil {
+		t.calls = make(map[uint64]chan messages.Envelope)
+	}
+	t.calls[id] = reply
+	t.callsMu.Unlock()
+	defer func() {
+		t.callsMu.Lock()
+		delete(t.calls, id)
+		t.callsMu.Unlock()
+	}()
+
+	err := t.write(id, 0, string(codes.CallMessage), t.raw(&messages.Call{Method: method, Args: args}))
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-reply:
+		var res messages.CallResult
+		if err := t.codec.Unmarshal(msg.Raw, &res); err != nil {
+			return nil, err
+		}
+		return &res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// answered passes the result of a call to the host over to the caller waiting for it.
+// It returns false if msg is not a call result and may be processed.
+func (t *transport) answered(msg *messages.Envelope) bool {
+	if msg.Type != string(codes.CallResultMessage) {
+		return false
+	}
+	t.callsMu.Lock()
+	reply, ok := t.calls[msg.ReplyTo]
+	delete(t.calls, msg.ReplyTo)
+	t.callsMu.Unlock()
+	if ok {
+		reply <- *msg
+	}
+	// A result nobody waits for any longer is dropped.
+	return true
+}
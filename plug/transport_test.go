@@ -0,0 +1,43 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestTransportIDs(t *testing.T) {
+	var out bytes.Buffer
+	tr := newTransport(&bytes.Buffer{}, &out)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tr.send(uint64(i+1), "pong", nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ids := make(map[uint64]bool)
+	for _, msg := range plugStream(t, &out) {
+		if msg.ID == 0 || ids[msg.ID] {
+			t.Errorf("message ID %d is zero or used twice", msg.ID)
+		}
+		ids[msg.ID] = true
+		if msg.Version != messages.ProtocolVersion {
+			t.Errorf("message stamped with version %d, want %d", msg.Version, messages.ProtocolVersion)
+		}
+	}
+	if len(ids) != 20 {
+		t.Errorf("decoded %d messages, want 20", len(ids))
+	}
+}
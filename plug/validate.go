@@ -0,0 +1,237 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+// Validator may be implemented by request types of typed handlers to check a decoded request
+// before the handler runs. A request for which Validate returns an error is rejected with
+// codes.PayloadMalformed; return FieldErrors, possibly joined with errors.Join, to tell the
+// host which fields are wrong.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes an invalid field of a request. Field is the path of the field,
+// e.g. "user.emails[1]", using the names the fields have on the wire.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// PayloadError reports a request rejected before its handler ran: one that does not decode
+// into the request type, misses required fields, or fails validation (see Validator).
+//
+// Fields maps the paths of the offending fields to what is wrong with them, where known.
+// Err is the decoding or validation error. The host receives the rejection as
+// codes.PayloadMalformed, carrying a *messages.Error with codes.DataFormatError and
+// the fields in Details["fields"].
+type PayloadError struct {
+	Fields map[string]string
+	Err    error
+}
+
+func (e *PayloadError) Error() string {
+	if len(e.Fields) == 0 {
+		return "malformed payload: " + e.Err.Error()
+	}
+	problems := make([]string, 0, len(e.Fields))
+	for _, field := range slices.Sorted(maps.Keys(e.Fields)) {
+		problems = append(problems, field+": "+e.Fields[field])
+	}
+	return "malformed payload: " + strings.Join(problems, "; ")
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// WireError describes the rejection to the host, see messages.ErrorEncoder.
+func (e *PayloadError) WireError() *messages.Error {
+	fields := make(map[string]any, len(e.Fields))
+	for field, reason := range e.Fields {
+		fields[field] = reason
+	}
+	return &messages.Error{
+		Code:    codes.DataFormatError,
+		Message: e.Error(),
+		Details: map[string]any{"fields": fields},
+	}
+}
+
+// DecodePayload decodes a request payload encoded with c into In, the way typed SmartPlug
+// handlers do, e.g. for use in RawPlug implementations with the codec of RawPlug.Codec.
+// Fields tagged `plugkit:"required"` must be present, and a request implementing Validator
+// must pass validation. If strict is set, unknown fields and duplicate map keys are rejected
+// as well. The error is a *PayloadError.
+func DecodePayload[In any](c codec.Codec, payload []byte, strict bool) (In, error) {
+	return decodePayload[In](c, schema.For[In](), payload, strict)
+}
+
+// decodePayload is DecodePayload with the schema of In computed in advance.
+func decodePayload[In any](c codec.Codec, s *schema.Schema, payload []byte, strict bool) (In, error) {
+	var input In
+	problems := map[string]string{}
+	checkFields(c, s, nil, payload, "", strict, problems)
+
+	unmarshal := c.Unmarshal
+	switch {
+	case strict && c == codec.CBOR:
+		unmarshal = requestDecoder.Unmarshal
+	case strict:
+		unmarshal = func(data []byte, v any) error { return codec.UnmarshalStrict(c, data, v) }
+	}
+	if err := unmarshal(payload, &input); err != nil {
+		decodeProblem(err, problems)
+		return input, &PayloadError{Fields: problems, Err: err}
+	}
+	if len(problems) > 0 {
+		return input, &PayloadError{Fields: problems, Err: errors.New("invalid fields")}
+	}
+
+	v, ok := any(input).(Validator)
+	if !ok {
+		v, ok = any(&input).(Validator)
+	}
+	if ok {
+		if err := v.Validate(); err != nil {
+			fieldProblems(err, problems)
+			return input, &PayloadError{Fields: problems, Err: err}
+		}
+	}
+	return input, nil
+}
+
+// checkFields records required fields missing from the encoded value raw of schema s,
+// and in strict mode unknown fields, by path. Values that are not maps are left to the decoder.
+// enclosing holds the struct types being checked, to resolve references to them.
+func checkFields(c codec.Codec, s *schema.Schema, enclosing []*schema.Schema, raw messages.RawMessage, path string, strict bool, problems map[string]string) {
+	if s == nil || len(raw) == 0 {
+		return
+	}
+	if s.Ref != "" {
+		for i := len(enclosing) - 1; i >= 0; i-- {
+			if enclosing[i].Name == s.Ref {
+				s = enclosing[i]
+				break
+			}
+		}
+	}
+
+	switch s.Kind {
+	case schema.Object:
+		var m map[string]messages.RawMessage
+		if c.Unmarshal(raw, &m) != nil || m == nil {
+			return
+		}
+		enclosing = append(enclosing, s)
+		known := make(map[string]bool, len(s.Fields))
+		for _, f := range s.Fields {
+			known[f.Name] = true
+			value, ok := m[f.Name]
+			if !ok {
+				if f.Required {
+					problems[join(path, f.Name)] = "required"
+				}
+				continue
+			}
+			checkFields(c, f.Schema, enclosing, value, join(path, f.Name), strict, problems)
+		}
+		if strict {
+			for name := range m {
+				if !known[name] {
+					problems[join(path, name)] = "unknown field"
+				}
+			}
+		}
+	case schema.Array:
+		var items []messages.RawMessage
+		if c.Unmarshal(raw, &items) != nil {
+			return
+		}
+		for i, item := range items {
+			checkFields(c, s.Elem, enclosing, item, path+"["+strconv.Itoa(i)+"]", strict, problems)
+		}
+	case schema.Map:
+		var m map[string]messages.RawMessage
+		if c.Unmarshal(raw, &m) != nil {
+			return
+		}
+		for key, value := range m {
+			checkFields(c, s.Elem, enclosing, value, path+"["+strconv.Quote(key)+"]", strict, problems)
+		}
+	}
+}
+
+// join returns the path of the field name of the value at path.
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// decodeProblem records the field a decoding error refers to, if it tells.
+func decodeProblem(err error, problems map[string]string) {
+	var typeErr *cbor.UnmarshalTypeError
+	var dupErr *cbor.DupMapKeyError
+	var decodeErr *codec.DecodeError
+	var keyErr *codec.DuplicateKeyError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.StructFieldName != "":
+		// The name is qualified with the Go struct type, e.g. "main.Request.name".
+		field := typeErr.StructFieldName[strings.LastIndex(typeErr.StructFieldName, ".")+1:]
+		problems[field] = "cannot decode " + typeErr.CBORType + " into " + typeErr.GoType
+	case errors.As(err, &dupErr):
+		problems[fmt.Sprint(dupErr.Key)] = "duplicate key"
+	case errors.As(err, &keyErr):
+		problems[keyErr.Field] = "duplicate key"
+	case errors.As(err, &decodeErr) && decodeErr.Field != "":
+		problems[decodeErr.Field] = "cannot decode " + decodeErr.Msg
+	}
+}
+
+// fieldProblems records the FieldErrors found in the tree of err.
+func fieldProblems(err error, problems map[string]string) {
+	if fieldErr, ok := err.(*FieldError); ok {
+		problems[fieldErr.Field] = fieldErr.Reason
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			fieldProblems(err, problems)
+		}
+	case interface{ Unwrap() error }:
+		if err := e.Unwrap(); err != nil {
+			fieldProblems(err, problems)
+		}
+	}
+}
+
+// rejectPayload answers the host message msg with codes.PayloadMalformed describing err.
+func rejectPayload(t *transport, log *slog.Logger, msg *messages.Envelope, err *PayloadError) {
+	if _, e := t.send(msg.ID, string(codes.PayloadMalformed), t.raw(err.WireError())); e != nil {
+		log.LogAttrs(context.Background(), slog.LevelError, "writing payload rejection failed",
+			slog.String("type", msg.Type), slog.Uint64("replyTo", msg.ID), slog.Any("error", e))
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"errors"
+	"maps"
+	"strconv"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+type contact struct {
+	Kind  string `cbor:"kind" plugkit:"required"`
+	Value string `cbor:"value"`
+}
+
+type signup struct {
+	Name     string    `cbor:"name" plugkit:"required"`
+	Age      int       `cbor:"age,omitempty"`
+	Contacts []contact `cbor:"contacts"`
+	Referrer *signup   `cbor:"referrer,omitempty"`
+}
+
+// Validate rejects minors, and contacts without a value.
+func (s signup) Validate() error {
+	var errs []error
+	if s.Age < 18 {
+		errs = append(errs, &FieldError{Field: "age", Reason: "must be at least 18"})
+	}
+	for i, c := range s.Contacts {
+		if c.Value == "" {
+			errs = append(errs, &FieldError{Field: "contacts[" + strconv.Itoa(i) + "].value", Reason: "empty"})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decodeProblems decodes v, encoded with c, as a signup and returns the fields rejected.
+func decodeProblems(t *testing.T, c codec.Codec, v any, strict bool) map[string]string {
+	t.Helper()
+	_, err := DecodePayload[signup](c, codec.MustMarshal(c, v), strict)
+	if err == nil {
+		return nil
+	}
+	var payloadErr *PayloadError
+	if !errors.As(err, &payloadErr) {
+		t.Fatalf("DecodePayload() = %v, want a *PayloadError", err)
+	}
+	return payloadErr.Fields
+}
+
+func TestDecodePayload(t *testing.T) {
+	valid := map[string]any{"name": "Ada", "age": 36, "contacts": []any{map[string]any{"kind": "email", "value": "ada@example.com"}}}
+	tests := []struct {
+		name   string
+		v      any
+		strict bool
+		want   map[string]string
+	}{
+		{"valid", valid, true, nil},
+		{"missing required", map[string]any{"age": 40}, false, map[string]string{"name": "required"}},
+		{"missing nested required", map[string]any{
+			"name": "Ada", "age": 36,
+			"contacts": []any{map[string]any{"kind": "email", "value": "a"}, map[string]any{"value": "b"}},
+			"referrer": map[string]any{"age": 50},
+		}, false, map[string]string{"contacts[1].kind": "required", "referrer.name": "required"}},
+		{"unknown field allowed", map[string]any{"name": "Ada", "age": 36, "nick": "A"}, false, nil},
+		{"unknown field strict", map[string]any{"name": "Ada", "age": 36, "nick": "A"}, true, map[string]string{"nick": "unknown field"}},
+		{"wrong type", map[string]any{"name": 7, "age": 36}, false, map[string]string{"name": "cannot decode positive integer into string"}},
+		{"invalid", map[string]any{"name": "Tom", "age": 12, "contacts": []any{map[string]any{"kind": "phone"}}}, false,
+			map[string]string{"age": "must be at least 18", "contacts[0].value": "empty"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeProblems(t, codec.CBOR, tt.v, tt.strict); !maps.Equal(got, tt.want) {
+				t.Errorf("rejected fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePayloadJSON(t *testing.T) {
+	got := decodeProblems(t, codec.JSON, map[string]any{"age": 36, "nick": "A"}, true)
+	if want := map[string]string{"name": "required", "nick": "unknown field"}; !maps.Equal(got, want) {
+		t.Errorf("rejected fields = %v, want %v", got, want)
+	}
+}
+
+func TestDecodePayloadDuplicateKeys(t *testing.T) {
+	// {"name": "a", "name": "b", "age": 20}
+	payload := []byte{0xa3, 0x64, 'n', 'a', 'm', 'e', 0x61, 'a', 0x64, 'n', 'a', 'm', 'e', 0x61, 'b', 0x63, 'a', 'g', 'e', 0x14}
+	if _, err := DecodePayload[signup](codec.CBOR, payload, false); err != nil {
+		t.Errorf("DecodePayload() = %v, want duplicate keys accepted outside strict mode", err)
+	}
+	_, err := DecodePayload[signup](codec.CBOR, payload, true)
+	var payloadErr *PayloadError
+	if !errors.As(err, &payloadErr) || payloadErr.Fields["name"] != "duplicate key" {
+		t.Errorf("DecodePayload() = %v, want the duplicate name rejected", err)
+	}
+}
+
+func TestDecodePayloadDuplicateKeysJSON(t *testing.T) {
+	payload := []byte(`{"name": "a", "age": 20, "name": "b"}`)
+	if in, err := DecodePayload[signup](codec.JSON, payload, false); err != nil || in.Name != "b" {
+		t.Errorf("DecodePayload() = %+v, %v, want the last name outside strict mode", in, err)
+	}
+	_, err := DecodePayload[signup](codec.JSON, payload, true)
+	var payloadErr *PayloadError
+	if !errors.As(err, &payloadErr) || payloadErr.Fields["name"] != "duplicate key" {
+		t.Errorf("DecodePayload() = %v, want the duplicate name rejected", err)
+	}
+}
+
+func TestPayloadErrorWireError(t *testing.T) {
+	err := &PayloadError{Fields: map[string]string{"b": "required", "a": "unknown field"}, Err: errors.New("invalid fields")}
+	if want := "malformed payload: a: unknown field; b: required"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	e := err.WireError()
+	fields, _ := e.Details["fields"].(map[string]any)
+	if e.Code != codes.DataFormatError || len(fields) != 2 || fields["b"] != "required" {
+		t.Errorf("WireError() = %+v", e)
+	}
+}
+
+func TestSmartPlugStrictDecoding(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		p := New()
+		p.SetStrictDecoding(strict)
+		HandleSmartPlugMessage(p, "signup", func(in signup) (*messages.Result, codes.PluginExitReason, error) {
+			return &messages.Result{Type: "welcome", Value: in.Name}, codes.OperationSuccess, nil
+		})
+		sent, err := runSession(t, p,
+			command(2, "signup", map[string]any{"name": "Ada", "age": 36, "nick": "A"}),
+			command(3, "signup", map[string]any{"age": 36}),
+			command(4, string(codes.ExitMessage), nil),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Unknown fields are rejected in strict mode only; required fields always.
+		if msg := answer(t, sent, 2); strict != (msg.Type == string(codes.PayloadMalformed)) {
+			t.Errorf("strict %t: unknown field answered with %q", strict, msg.Type)
+		}
+		msg := answer(t, sent, 3)
+		if msg.Type != string(codes.PayloadMalformed) {
+			t.Fatalf("strict %t: missing name answered with %q, want %q", strict, msg.Type, codes.PayloadMalformed)
+		}
+		var e messages.Error
+		if err := codec.CBOR.Unmarshal(msg.Raw, &e); err != nil {
+			t.Fatal(err)
+		}
+		if fields, _ := e.Details["fields"].(map[any]any); e.Code != codes.DataFormatError || fields["name"] != "required" {
+			t.Errorf("strict %t: rejection = %+v", strict, e)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package plug
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/codec"
+	"github.com/mjwhodur/plugkit/codes"
+	"github.com/mjwhodur/plugkit/messages"
+)
+
+func TestRejectVersion(t *testing.T) {
+	var out bytes.Buffer
+	tr := newTransport(&bytes.Buffer{}, &out)
+
+	if rejectVersion(tr, &messages.Envelope{Version: messages.ProtocolVersion, ID: 1}) {
+		t.Error("rejectVersion rejected the current version")
+	}
+	if !rejectVersion(tr, &messages.Envelope{Version: messages.ProtocolVersion + 1, ID: 2}) {
+		t.Fatal("rejectVersion accepted a future version")
+	}
+
+	msgs := plugStream(t, &out)
+	if len(msgs) != 1 || msgs[0].Type != string(codes.VersionUnsupported) || msgs[0].ReplyTo != 2 {
+		t.Fatalf("plug wrote %+v, want a single VersionUnsupported answering message 2", msgs)
+	}
+	var rejected messages.VersionUnsupported
+	if err := codec.CBOR.Unmarshal(msgs[0].Raw, &rejected); err != nil {
+		t.Fatal(err)
+	}
+	if want := *messages.NewVersionUnsupported(messages.ProtocolVersion + 1); rejected != want {
+		t.Errorf("plug rejected with %+v, want %+v", rejected, want)
+	}
+}
+
+func TestAcceptHandshakeIncompatibleHost(t *testing.T) {
+	var out bytes.Buffer
+	tr := newTransport(hostStream(t, helloFrom(messages.ProtocolVersion+1, messages.ProtocolVersion+2)), &out)
+
+	if _, err := acceptHandshake(tr, plugHello("test", nil, nil), nil); !errors.Is(err, ErrIncompatibleHost) {
+		t.Fatalf("acceptHandshake() = %v, want ErrIncompatibleHost", err)
+	}
+	// The plug still answers, so the host can tell why the session failed.
+	if msgs := plugStream(t, &out); len(msgs) != 1 || msgs[0].Type != string(codes.HelloMessage) {
+		t.Errorf("plug wrote %+v, want its hello", msgs)
+	}
+}
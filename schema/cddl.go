@@ -0,0 +1,124 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package schema
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteCDDL writes the document to w in CDDL, the schema language of CBOR (RFC 8610).
+//
+// Times are described as integers, the number of seconds since the Unix epoch,
+// as they are encoded by PlugKit.
+func (d Document) WriteCDDL(w io.Writer) error {
+	r := d.collect(cddlName)
+	bw := bufio.NewWriter(w)
+	if d.Title != "" {
+		bw.WriteString("; " + d.Title + "\n\n")
+	}
+	for i, rule := range r.order {
+		if i > 0 && !(rule.alias && r.order[i-1].alias) {
+			bw.WriteString("\n")
+		}
+		if rule.alias {
+			bw.WriteString(rule.name + " = " + r.cddlType(rule.schema) + "\n")
+		} else {
+			bw.WriteString(rule.name + " = " + r.cddlObject(rule.schema, true) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// cddlType returns the CDDL type of values described by s.
+func (r *rules) cddlType(s *Schema) string {
+	if s == nil {
+		return "any"
+	}
+	t := r.cddlBase(s)
+	if s.Nullable && s.Kind != Any {
+		t += " / nil"
+	}
+	return t
+}
+
+func (r *rules) cddlBase(s *Schema) string {
+	if name, ok := r.names[s]; ok {
+		return name
+	}
+	switch s.Kind {
+	case Bool:
+		return "bool"
+	case Integer, Time:
+		return "int"
+	case Uint:
+		return "uint"
+	case Number:
+		return "float"
+	case String:
+		return "tstr"
+	case Bytes:
+		return "bstr"
+	case Array:
+		return "[* " + r.cddlType(s.Elem) + "]"
+	case Map:
+		return "{* " + r.cddlType(s.Key) + " => " + r.cddlType(s.Elem) + "}"
+	case Object:
+		return r.cddlObject(s, false)
+	}
+	return "any"
+}
+
+// cddlObject returns the CDDL map describing a struct, with one field per line if multiline is set.
+func (r *rules) cddlObject(s *Schema, multiline bool) string {
+	if len(s.Fields) == 0 {
+		return "{}"
+	}
+	open, sep, end := "{ ", ", ", " }"
+	if multiline {
+		open, sep, end = "{\n  ", ",\n  ", "\n}"
+	}
+	var b strings.Builder
+	b.WriteString(open)
+	for i, f := range s.Fields {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		if f.Optional {
+			b.WriteString("? ")
+		}
+		if cddlName(f.Name) == f.Name {
+			b.WriteString(f.Name + ": ")
+		} else {
+			b.WriteString(strconv.Quote(f.Name) + " => ")
+		}
+		b.WriteString(r.cddlType(f.Schema))
+	}
+	b.WriteString(end)
+	return b.String()
+}
+
+// cddlName turns name into a CDDL identifier, replacing the characters it may not contain.
+func cddlName(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '@', c == '$':
+		case c >= '0' && c <= '9', c == '-', c == '.':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+		default:
+			c = '_'
+		}
+		b.WriteRune(c)
+	}
+	id := b.String()
+	if id == "" || strings.HasSuffix(id, "-") || strings.HasSuffix(id, ".") {
+		id += "_"
+	}
+	return id
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package schema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+// users is the document of a plug serving users, used by the export tests.
+var users = schema.Document{Title: "users 1.0", Definitions: []schema.Definition{
+	{Name: "User", Schema: schema.For[User]()},
+	{Name: "get-request", Schema: schema.For[int]()},
+	{Name: "get-response", Schema: schema.For[*User]()},
+}}
+
+func TestWriteCDDL(t *testing.T) {
+	var b strings.Builder
+	if err := users.WriteCDDL(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `; users 1.0
+
+User = {
+  name: tstr,
+  ? emails: [* tstr] / nil,
+  home: Address / nil,
+  tags: {* tstr => uint} / nil,
+  avatar: bstr / nil,
+  seen: int,
+  score: float,
+  tree: Node,
+  extra: any
+}
+
+Address = {
+  street: tstr,
+  ? zip-code: tstr
+}
+
+Node = {
+  value: int,
+  ? children: [* Node / nil] / nil
+}
+
+get-request = int
+get-response = User / nil
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteCDDL() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteCDDLNames(t *testing.T) {
+	type odd struct {
+		Field string `cbor:"with space"`
+	}
+	doc := schema.Document{Definitions: []schema.Definition{
+		{Name: "9lives", Schema: schema.For[string]()},
+		{Name: "trailing-", Schema: schema.For[string]()},
+		{Name: "odd", Schema: schema.For[odd]()},
+	}}
+	var b strings.Builder
+	if err := doc.WriteCDDL(&b); err != nil {
+		t.Fatal(err)
+	}
+	// Names that are not CDDL identifiers are rewritten, field names are quoted.
+	for _, want := range []string{"_9lives = tstr\n", "trailing-_ = tstr\n", `"with space" => tstr`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("WriteCDDL() lacks %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWriteCDDLSharedNames(t *testing.T) {
+	// Two different types named Address are exported under different names.
+	type Address struct {
+		Lines []string `cbor:"lines"`
+	}
+	type Order struct {
+		Billing  Address  `cbor:"billing"`
+		Shipping *Address `cbor:"shipping"`
+	}
+	doc := schema.Document{Definitions: []schema.Definition{
+		{Name: "User", Schema: schema.For[User]()},
+		{Name: "Order", Schema: schema.For[Order]()},
+	}}
+	var b strings.Builder
+	if err := doc.WriteCDDL(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{"home: Address / nil", "billing: Address2,", "shipping: Address2 / nil", "Address2 = {\n  lines: [* tstr] / nil\n}"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteCDDL() lacks %q:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "Address2 = "); n != 1 {
+		t.Errorf("Address2 defined %d times:\n%s", n, out)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package schema
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// Document is a set of named schemas, e.g. the messages of a plug, that can be exported
+// as a contract for consumers written in other languages, see WriteCDDL and WriteJSONSchema.
+//
+// Named struct types reached from the definitions are exported once, under their Go name,
+// and referred to by it. Different types sharing a name are told apart by a numeric suffix.
+type Document struct {
+	Title       string
+	Definitions []Definition
+}
+
+// Definition is a named schema in a Document.
+type Definition struct {
+	Name   string
+	Schema *Schema
+}
+
+// rule is a named struct type exported on its own, or a definition referring to another type.
+type rule struct {
+	name   string
+	schema *Schema
+	alias  bool // a definition, the schema of which is exported as is
+}
+
+// rules assigns names to the definitions and to the named struct types of a document.
+type rules struct {
+	order []rule             // in the order of the document; struct types follow their first use
+	names map[*Schema]string // rule name of every named object and reference
+	taken map[string]bool
+}
+
+// collect walks the document and names every named struct type in it.
+// valid turns a name into one the output format accepts.
+func (d Document) collect(valid func(string) string) *rules {
+	r := &rules{names: map[*Schema]string{}, taken: map[string]bool{}}
+	aliases := make([]bool, len(d.Definitions))
+	for i, def := range d.Definitions {
+		s := def.Schema
+		// A definition of a named struct type under its own name is exported as that type.
+		aliases[i] = s == nil || s.Kind != Object || s.Ref != "" || s.Name != def.Name || s.Nullable
+		if aliases[i] {
+			r.taken[valid(def.Name)] = true
+		}
+	}
+	for i, def := range d.Definitions {
+		if aliases[i] {
+			r.order = append(r.order, rule{name: valid(def.Name), schema: def.Schema, alias: true})
+		}
+		r.walk(def.Schema, nil, valid)
+	}
+	return r
+}
+
+// scope maps the Go names of the struct types being walked to their rule names,
+// innermost last, to resolve references to them.
+type scope []rule
+
+func (r *rules) walk(s *Schema, enclosing scope, valid func(string) string) {
+	if s == nil {
+		return
+	}
+	switch {
+	case s.Ref != "":
+		for i := len(enclosing) - 1; i >= 0; i-- {
+			if enclosing[i].schema.Name == s.Ref {
+				r.names[s] = enclosing[i].name
+				break
+			}
+		}
+		return
+	case s.Kind == Object && s.Name != "":
+		name := r.assign(s, valid)
+		r.names[s] = name
+		enclosing = append(enclosing, rule{name: name, schema: s})
+	}
+	r.walk(s.Key, enclosing, valid)
+	r.walk(s.Elem, enclosing, valid)
+	for _, f := range s.Fields {
+		r.walk(f.Schema, enclosing, valid)
+	}
+}
+
+// assign returns the rule name of the named struct type s, adding a rule for it
+// unless a struct type of the same name and shape has one already.
+func (r *rules) assign(s *Schema, valid func(string) string) string {
+	base := valid(s.Name)
+	for _, existing := range r.order {
+		if !existing.alias && (existing.name == base || existing.schema.Name == s.Name) && sameShape(existing.schema, s) {
+			return existing.name
+		}
+	}
+	name := base
+	for n := 2; r.taken[name]; n++ {
+		name = base + strconv.Itoa(n)
+	}
+	r.taken[name] = true
+	r.order = append(r.order, rule{name: name, schema: s})
+	return name
+}
+
+// sameShape reports whether a and b describe the same struct type, regardless of
+// whether the values referring to them may be nil.
+func sameShape(a, b *Schema) bool {
+	x, y := *a, *b
+	x.Nullable, y.Nullable = false, false
+	return reflect.DeepEqual(x, y)
+}
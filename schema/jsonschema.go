@@ -0,0 +1,105 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package schema
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONSchemaDialect is the JSON Schema version WriteJSONSchema writes.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// WriteJSONSchema writes the document to w as a JSON Schema, with every definition
+// and named struct type under "$defs".
+//
+// JSON Schema describes the JSON equivalent of the CBOR values: byte strings are
+// base64-encoded strings, and times are integers, the number of seconds since the Unix epoch.
+func (d Document) WriteJSONSchema(w io.Writer) error {
+	r := d.collect(func(name string) string { return name })
+	defs := make(map[string]any, len(r.order))
+	for _, rule := range r.order {
+		if rule.alias {
+			defs[rule.name] = r.jsonType(rule.schema)
+		} else {
+			defs[rule.name] = r.jsonObject(rule.schema)
+		}
+	}
+	doc := map[string]any{
+		"$schema": JSONSchemaDialect,
+		"$defs":   defs,
+	}
+	if d.Title != "" {
+		doc["title"] = d.Title
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// jsonType returns the JSON Schema of values described by s.
+func (r *rules) jsonType(s *Schema) map[string]any {
+	if s == nil {
+		return map[string]any{}
+	}
+	t := r.jsonBase(s)
+	if s.Nullable && s.Kind != Any {
+		return map[string]any{"anyOf": []any{t, map[string]any{"type": "null"}}}
+	}
+	return t
+}
+
+func (r *rules) jsonBase(s *Schema) map[string]any {
+	if name, ok := r.names[s]; ok {
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	switch s.Kind {
+	case Bool:
+		return map[string]any{"type": "boolean"}
+	case Integer:
+		return map[string]any{"type": "integer"}
+	case Uint:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case Number:
+		return map[string]any{"type": "number"}
+	case String:
+		return map[string]any{"type": "string"}
+	case Bytes:
+		return map[string]any{"type": "string", "contentEncoding": "base64"}
+	case Time:
+		return map[string]any{"type": "integer", "description": "seconds since the Unix epoch"}
+	case Array:
+		return map[string]any{"type": "array", "items": r.jsonType(s.Elem)}
+	case Map:
+		return map[string]any{"type": "object", "additionalProperties": r.jsonType(s.Elem)}
+	case Object:
+		return r.jsonObject(s)
+	}
+	return map[string]any{}
+}
+
+// jsonObject returns the JSON Schema of a struct. Fields that are not optional are required,
+// and unknown fields are not allowed.
+func (r *rules) jsonObject(s *Schema) map[string]any {
+	properties := make(map[string]any, len(s.Fields))
+	required := []string{}
+	for _, f := range s.Fields {
+		properties[f.Name] = r.jsonType(f.Schema)
+		if !f.Optional {
+			required = append(required, f.Name)
+		}
+	}
+	o := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+	if s.Name != "" {
+		o["title"] = s.Name
+	}
+	return o
+}
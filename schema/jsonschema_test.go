@@ -0,0 +1,66 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+func TestWriteJSONSchema(t *testing.T) {
+	var b bytes.Buffer
+	if err := users.WriteJSONSchema(&b); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Schema string                    `json:"$schema"`
+		Title  string                    `json:"title"`
+		Defs   map[string]map[string]any `json:"$defs"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, b.String())
+	}
+	if doc.Schema != schema.JSONSchemaDialect || doc.Title != "users 1.0" {
+		t.Errorf("document %q titled %q", doc.Schema, doc.Title)
+	}
+	var defs []string
+	for name := range doc.Defs {
+		defs = append(defs, name)
+	}
+	if len(defs) != 5 {
+		t.Errorf("$defs = %q, want User, Address, Node and the request and response", defs)
+	}
+
+	user := doc.Defs["User"]
+	if user["type"] != "object" || user["additionalProperties"] != false || user["title"] != "User" {
+		t.Errorf("User = %v", user)
+	}
+	// Fields left out when empty are not required.
+	want := []any{"name", "home", "tags", "avatar", "seen", "score", "tree", "extra"}
+	if !reflect.DeepEqual(user["required"], want) {
+		t.Errorf("User requires %v, want %v", user["required"], want)
+	}
+
+	props := user["properties"].(map[string]any)
+	tests := map[string]string{
+		"home":   `{"anyOf":[{"$ref":"#/$defs/Address"},{"type":"null"}]}`,
+		"tree":   `{"$ref":"#/$defs/Node"}`,
+		"avatar": `{"anyOf":[{"contentEncoding":"base64","type":"string"},{"type":"null"}]}`,
+		"seen":   `{"description":"seconds since the Unix epoch","type":"integer"}`,
+		"tags":   `{"anyOf":[{"additionalProperties":{"minimum":0,"type":"integer"},"type":"object"},{"type":"null"}]}`,
+		"extra":  `{}`,
+	}
+	for field, want := range tests {
+		if got, _ := json.Marshal(props[field]); string(got) != want {
+			t.Errorf("%s = %s, want %s", field, got, want)
+		}
+	}
+	if got, _ := json.Marshal(doc.Defs["get-request"]); string(got) != `{"type":"integer"}` {
+		t.Errorf("get-request = %s", got)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+// Package schema describes the shape of the values exchanged between PlugKit hosts and plugs.
+//
+// Schemas are derived from Go types by reflection, following the rules the CBOR encoding
+// uses: struct fields are named after their "cbor" (or "json") tag, or the Go field name,
+// unexported and "-" fields are skipped, and embedded structs are flattened.
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Kind is the kind of value a Schema describes.
+type Kind string
+
+const (
+	Any     Kind = "any"     // any value, e.g. an interface or embedded CBOR
+	Bool    Kind = "bool"    // true or false
+	Integer Kind = "integer" // a signed integer
+	Uint    Kind = "uint"    // an unsigned integer
+	Number  Kind = "number"  // a floating-point number
+	String  Kind = "string"  // a UTF-8 text string
+	Bytes   Kind = "bytes"   // a byte string
+	Time    Kind = "time"    // a point in time
+	Array   Kind = "array"   // a list of Elem values
+	Map     Kind = "map"     // a map from Key to Elem values
+	Object  Kind = "object"  // a struct with named Fields
+)
+
+// Schema describes the shape of a value.
+type Schema struct {
+	Kind     Kind    `cbor:"kind"`
+	Name     string  `cbor:"name,omitempty"`     // the Go type name, for named types
+	Nullable bool    `cbor:"nullable,omitempty"` // the value may be nil
+	Fields   []Field `cbor:"fields,omitempty"`   // fields of an Object
+	Key      *Schema `cbor:"key,omitempty"`      // keys of a Map
+	Elem     *Schema `cbor:"elem,omitempty"`     // elements of an Array, values of a Map
+	Ref      string  `cbor:"ref,omitempty"`      // an Object described further up, by Name
+}
+
+// Field is a field of an Object.
+//
+// A field is Optional if it is left out of encoded values when empty ("omitempty"), and
+// Required if decoders insist on it being present, which is set with a `plugkit:"required"`
+// struct tag. A required field is never optional.
+type Field struct {
+	Name     string  `cbor:"name"`
+	Schema   *Schema `cbor:"schema"`
+	Optional bool    `cbor:"optional,omitempty"`
+	Required bool    `cbor:"required,omitempty"`
+}
+
+// For returns the schema of T.
+func For[T any]() *Schema {
+	return Of(reflect.TypeFor[T]())
+}
+
+// Of returns the schema of values of type t. A nil t describes any value.
+//
+// Recursive types are described once: further occurrences of a struct type inside its own
+// schema refer to it by name with Ref.
+func Of(t reflect.Type) *Schema {
+	return of(t, map[reflect.Type]bool{})
+}
+
+var (
+	timeType   = reflect.TypeFor[time.Time]()
+	anyMessage = "RawMessage" // cbor.RawMessage holds any embedded value
+)
+
+func of(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	if t == nil {
+		return &Schema{Kind: Any, Nullable: true}
+	}
+
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		nullable = true
+		t = t.Elem()
+	}
+	s := &Schema{Name: t.Name(), Nullable: nullable}
+
+	switch {
+	case t == timeType:
+		s.Kind = Time
+		return s
+	case t.Name() == anyMessage && t.Kind() == reflect.Slice:
+		s.Kind = Any
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Kind = Bool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Kind = Integer
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.Kind = Uint
+	case reflect.Float32, reflect.Float64:
+		s.Kind = Number
+	case reflect.String:
+		s.Kind = String
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s.Kind = Bytes
+		} else {
+			s.Kind = Array
+			s.Elem = of(t.Elem(), visiting)
+		}
+		s.Nullable = s.Nullable || t.Kind() == reflect.Slice
+	case reflect.Map:
+		s.Kind = Map
+		s.Key = of(t.Key(), visiting)
+		s.Elem = of(t.Elem(), visiting)
+		s.Nullable = true
+	case reflect.Struct:
+		s.Kind = Object
+		if visiting[t] {
+			s.Ref = t.Name()
+			return s
+		}
+		visiting[t] = true
+		s.Fields = fields(t, visiting)
+		delete(visiting, t)
+	default:
+		// Interfaces, and kinds that cannot be encoded, such as channels and functions.
+		s.Kind = Any
+		s.Nullable = true
+	}
+	return s
+}
+
+// fields returns the fields of the struct type t, flattening embedded structs.
+func fields(t reflect.Type, visiting map[reflect.Type]bool) []Field {
+	var out []Field
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, tagged := fieldTag(f)
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				out = append(out, fields(ft, visiting)...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		required := hasOption(f.Tag.Get("plugkit"), "required")
+		out = append(out, Field{
+			Name:     name,
+			Schema:   of(f.Type, visiting),
+			Optional: !required && (hasOption(opts, "omitempty") || hasOption(opts, "omitzero")),
+			Required: required,
+		})
+	}
+	return out
+}
+
+// hasOption reports whether the comma-separated tag options contain option.
+func hasOption(opts, option string) bool {
+	for opt := range strings.SplitSeq(opts, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldTag returns the name and options from the "cbor" or "json" tag of f,
+// and whether f has such a tag.
+func fieldTag(f reflect.StructField) (name, opts string, ok bool) {
+	tag, ok := f.Tag.Lookup("cbor")
+	if !ok {
+		tag, ok = f.Tag.Lookup("json")
+	}
+	name, opts, _ = strings.Cut(tag, ",")
+	return name, opts, ok
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2025 Michał Hodur
+// SPDX-License-Identifier: MIT
+
+package schema_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mjwhodur/plugkit/schema"
+)
+
+type Address struct {
+	Street string `cbor:"street"`
+	Zip    string `cbor:"zip-code,omitempty"`
+}
+
+type Node struct {
+	Value    int     `cbor:"value"`
+	Children []*Node `cbor:"children,omitempty"`
+}
+
+type User struct {
+	Name   string          `cbor:"name" plugkit:"required"`
+	Emails []string        `cbor:"emails,omitempty"`
+	Home   *Address        `cbor:"home"`
+	Tags   map[string]uint `cbor:"tags"`
+	Avatar []byte          `cbor:"avatar"`
+	Seen   time.Time       `cbor:"seen"`
+	Score  float64         `json:"score"`
+	Tree   Node            `cbor:"tree"`
+	Extra  any             `cbor:"extra"`
+}
+
+type Audited struct {
+	Created time.Time `cbor:"created"`
+}
+
+type Record struct {
+	Audited
+	ID      int    `cbor:"id"`
+	Secret  string `cbor:"-"`
+	private string
+	Legacy  string
+	Raw     cbor.RawMessage `cbor:"raw"`
+}
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		t    reflect.Type
+		want schema.Schema
+	}{
+		{nil, schema.Schema{Kind: schema.Any, Nullable: true}},
+		{reflect.TypeFor[bool](), schema.Schema{Kind: schema.Bool, Name: "bool"}},
+		{reflect.TypeFor[int8](), schema.Schema{Kind: schema.Integer, Name: "int8"}},
+		{reflect.TypeFor[uint64](), schema.Schema{Kind: schema.Uint, Name: "uint64"}},
+		{reflect.TypeFor[float32](), schema.Schema{Kind: schema.Number, Name: "float32"}},
+		{reflect.TypeFor[*string](), schema.Schema{Kind: schema.String, Name: "string", Nullable: true}},
+		{reflect.TypeFor[[]byte](), schema.Schema{Kind: schema.Bytes, Nullable: true}},
+		{reflect.TypeFor[[4]byte](), schema.Schema{Kind: schema.Bytes}},
+		{reflect.TypeFor[time.Time](), schema.Schema{Kind: schema.Time, Name: "Time"}},
+		{reflect.TypeFor[cbor.RawMessage](), schema.Schema{Kind: schema.Any, Name: "RawMessage"}},
+		{reflect.TypeFor[chan int](), schema.Schema{Kind: schema.Any, Nullable: true}},
+		{reflect.TypeFor[[]int](), schema.Schema{Kind: schema.Array, Nullable: true, Elem: &schema.Schema{Kind: schema.Integer, Name: "int"}}},
+		{reflect.TypeFor[map[string]any](), schema.Schema{
+			Kind:     schema.Map,
+			Nullable: true,
+			Key:      &schema.Schema{Kind: schema.String, Name: "string"},
+			Elem:     &schema.Schema{Kind: schema.Any, Nullable: true},
+		}},
+	}
+	for _, tt := range tests {
+		if got := schema.Of(tt.t); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("Of(%v) = %+v, want %+v", tt.t, *got, tt.want)
+		}
+	}
+}
+
+func TestOfStruct(t *testing.T) {
+	s := schema.For[User]()
+	if s.Kind != schema.Object || s.Name != "User" || s.Nullable {
+		t.Fatalf("For[User]() = %+v", s)
+	}
+	want := []struct {
+		name               string
+		kind               schema.Kind
+		optional, required bool
+	}{
+		{"name", schema.String, false, true},
+		{"emails", schema.Array, true, false},
+		{"home", schema.Object, false, false},
+		{"tags", schema.Map, false, false},
+		{"avatar", schema.Bytes, false, false},
+		{"seen", schema.Time, false, false},
+		{"score", schema.Number, false, false},
+		{"tree", schema.Object, false, false},
+		{"extra", schema.Any, false, false},
+	}
+	if len(s.Fields) != len(want) {
+		t.Fatalf("User has %d fields, want %d: %+v", len(s.Fields), len(want), s.Fields)
+	}
+	for i, w := range want {
+		f := s.Fields[i]
+		if f.Name != w.name || f.Schema.Kind != w.kind || f.Optional != w.optional || f.Required != w.required {
+			t.Errorf("field %d = %+v of kind %s, want %+v", i, f, f.Schema.Kind, w)
+		}
+	}
+}
+
+func TestOfFieldNames(t *testing.T) {
+	// Embedded structs are flattened; "-", unexported fields are skipped; untagged fields keep their Go name.
+	var names []string
+	for _, f := range schema.For[Record]().Fields {
+		names = append(names, f.Name)
+	}
+	if want := []string{"created", "id", "Legacy", "raw"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Record fields = %q, want %q", names, want)
+	}
+}
+
+func TestOfRecursive(t *testing.T) {
+	s := schema.For[Node]()
+	children := s.Fields[1].Schema
+	if children.Kind != schema.Array || children.Elem.Kind != schema.Object || children.Elem.Ref != "Node" || children.Elem.Fields != nil {
+		t.Errorf("children of Node = %+v of %+v, want references to Node", children, children.Elem)
+	}
+	if !children.Elem.Nullable {
+		t.Error("pointer to Node not nullable")
+	}
+}